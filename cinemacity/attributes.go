@@ -0,0 +1,93 @@
+package cinemacity
+
+import (
+	"strings"
+)
+
+// Attributes are a film's or a screening's `attributeIds`, grouped by meaning.
+type Attributes struct {
+	Formats           []string
+	Genres            []string
+	AgeRating         string
+	OriginalLanguage  string
+	DubbedLanguages   []string
+	SubtitleLanguages []string
+}
+
+// formats maps the attribute ids describing the projection formats to their display names.
+var formats = map[string]string{
+	"2d":          "2D",
+	"3d":          "3D",
+	"4dx":         "4DX",
+	"imax":        "IMAX",
+	"screenx":     "ScreenX",
+	"vip":         "VIP",
+	"dolby-atmos": "Dolby Atmos",
+}
+
+var genres = map[string]string{
+	"action":      "Action",
+	"adventure":   "Adventure",
+	"animation":   "Animation",
+	"biography":   "Biography",
+	"comedy":      "Comedy",
+	"crime":       "Crime",
+	"documentary": "Documentary",
+	"drama":       "Drama",
+	"family":      "Family",
+	"fantasy":     "Fantasy",
+	"history":     "History",
+	"horror":      "Horror",
+	"music":       "Music",
+	"musical":     "Musical",
+	"mystery":     "Mystery",
+	"romance":     "Romance",
+	"sci-fi":      "Sci-Fi",
+	"thriller":    "Thriller",
+	"war":         "War",
+	"western":     "Western",
+}
+
+// ageRatings lists the age rating attribute ids used by the national sites.
+var ageRatings = map[string]bool{
+	"ag": true, "ap-12": true, "n-15": true, "im-18": true, "im-18-xxx": true, "ic": true,
+	"12": true, "15": true, "16": true, "18": true,
+	"7": true, "13": true, "g": true, "pg": true, "pg-13": true, "r": true,
+}
+
+const (
+	originalLanguagePrefix = "original-lang-"
+	dubbedLanguagePrefix   = "dubbed-lang-"
+	subtitleLanguagePrefix = "subbed-lang-"
+)
+
+// ParseAttributes groups the given attribute ids; the unknown ones are ignored.
+func ParseAttributes(ids []string) Attributes {
+	var a Attributes
+
+	for _, id := range ids {
+		id = strings.ToLower(strings.TrimSpace(id))
+
+		if name, ok := formats[id]; ok {
+			a.Formats = append(a.Formats, name)
+		} else if name, ok := genres[id]; ok {
+			a.Genres = append(a.Genres, name)
+		} else if ageRatings[id] {
+			a.AgeRating = strings.ToUpper(id)
+		} else if strings.HasPrefix(id, originalLanguagePrefix) {
+			a.OriginalLanguage = languageCode(strings.TrimPrefix(id, originalLanguagePrefix))
+		} else if strings.HasPrefix(id, dubbedLanguagePrefix) {
+			a.DubbedLanguages = append(a.DubbedLanguages, languageCode(strings.TrimPrefix(id, dubbedLanguagePrefix)))
+		} else if i := strings.Index(id, subtitleLanguagePrefix); i >= 0 {
+			// e.g. `first-subbed-lang-ro` and `second-subbed-lang-hu`
+			a.SubtitleLanguages = append(a.SubtitleLanguages, languageCode(id[i+len(subtitleLanguagePrefix):]))
+		}
+	}
+
+	return a
+}
+
+// languageCode turns the language part of an attribute id, e.g. `en-gb`, into a language code, e.g. `en`.
+func languageCode(s string) string {
+	return strings.SplitN(s, "-", 2)[0]
+}
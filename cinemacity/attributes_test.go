@@ -0,0 +1,46 @@
+package cinemacity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAttributes(t *testing.T) {
+	tables := []struct {
+		ids      []string
+		expected Attributes
+	}{
+		{
+			ids: []string{"2d", "imax", "action", "sci-fi", "n-15", "original-lang-en-gb", "first-subbed-lang-ro", "second-subbed-lang-hu", "unknown"},
+			expected: Attributes{
+				Formats:           []string{"2D", "IMAX"},
+				Genres:            []string{"Action", "Sci-Fi"},
+				AgeRating:         "N-15",
+				OriginalLanguage:  "en",
+				SubtitleLanguages: []string{"ro", "hu"},
+			},
+		},
+		{
+			ids: []string{"3D", "animation", "AG", "original-lang-en-us", "dubbed-lang-ro"},
+			expected: Attributes{
+				Formats:          []string{"3D"},
+				Genres:           []string{"Animation"},
+				AgeRating:        "AG",
+				OriginalLanguage: "en",
+				DubbedLanguages:  []string{"ro"},
+			},
+		},
+		{
+			ids:      nil,
+			expected: Attributes{},
+		},
+	}
+
+	for _, table := range tables {
+		got := ParseAttributes(table.ids)
+
+		if !reflect.DeepEqual(got, table.expected) {
+			t.Errorf("Expected %+v, got %+v", table.expected, got)
+		}
+	}
+}
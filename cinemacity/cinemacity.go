@@ -1,30 +1,44 @@
-// Package cinemacity offers functionality for fetching films from a JSON resource
-// and for fetching the romanian names by scraping movies' HTML pages.
+// Package cinemacity offers functionality for fetching films and their screenings from the JSON resources
+// of Cinema City's national sites and for fetching the local names by scraping movies' HTML pages.
 package cinemacity
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"time"
 )
 
 type Film struct {
-	Id         string `json:"code"`
-	Name       string `json:"featureTitle"`
-	Link       string `json:"url"`
-	PosterLink string `json:"posterSrc"`
+	Id          string `json:"code"`
+	Name        string `json:"featureTitle"`
+	Link        string `json:"url"`
+	PosterLink  string `json:"posterSrc"`
+	DateStarted string `json:"dateStarted"`
+}
+
+// FilmDetails is a film as described by the quickbook API.
+type FilmDetails struct {
+	Id           string   `json:"id"`
+	Name         string   `json:"name"`
+	Length       int      `json:"length"`
+	ReleaseYear  string   `json:"releaseYear"`
+	AttributeIds []string `json:"attributeIds"`
 }
 
 type Event struct {
-	Id            string `json:"id"`
-	FilmId        string `json:"filmId"`
-	CinemaId      string `json:"cinemaId"`
-	BusinessDay   string `json:"businessDay"`
-	EventDateTime string `json:"eventDateTime"`
-	BookingLink   string `json:"bookingLink"`
-	Auditorium    string `json:"auditorium"`
+	Id            string   `json:"id"`
+	FilmId        string   `json:"filmId"`
+	CinemaId      string   `json:"cinemaId"`
+	BusinessDay   string   `json:"businessDay"`
+	EventDateTime string   `json:"eventDateTime"`
+	BookingLink   string   `json:"bookingLink"`
+	Auditorium    string   `json:"auditorium"`
+	AttributeIds  []string `json:"attributeIds"`
 }
 
 type Body struct {
@@ -35,22 +49,51 @@ type FilmsList struct {
 	Body `json:"body"`
 }
 
-func GetFilms() ([]Film, error) {
-	url := "https://www.cinemacity.ro/ro/data-api-service/v1/feed/10107/byName/now-playing?lang=en_GB"
+type FilmDetailsBody struct {
+	Films []FilmDetails `json:"films"`
+}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
+type FilmDetailsList struct {
+	FilmDetailsBody `json:"body"`
+}
 
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+type EventsBody struct {
+	Events []Event `json:"events"`
+}
+
+type EventsList struct {
+	EventsBody `json:"body"`
+}
+
+type DatesBody struct {
+	Dates []string `json:"dates"`
+}
+
+type DatesList struct {
+	DatesBody `json:"body"`
+}
+
+// DateLayout is the layout of the dates used by the data API.
+const DateLayout = "2006-01-02"
+
+// defaultLang is the language the films' original titles are requested in.
+const defaultLang = "en_GB"
+
+// GetFilms returns the films currently playing at the given cinema, with their titles in the given language.
+func GetFilms(ctx context.Context, country Country, cinemaId string, lang string) ([]Film, error) {
+	return getFeed(ctx, country, cinemaId, "now-playing", lang)
+}
+
+// GetComingSoonFilms returns the films announced for the given cinema, with their titles in the given language.
+func GetComingSoonFilms(ctx context.Context, country Country, cinemaId string, lang string) ([]Film, error) {
+	return getFeed(ctx, country, cinemaId, "coming-soon", lang)
+}
+
+func getFeed(ctx context.Context, country Country, cinemaId string, list string, lang string) ([]Film, error) {
+	url := country.apiUrl(fmt.Sprintf("feed/%s/byName/%s?lang=%s", cinemaId, list, lang))
 
 	var films FilmsList
-	if err := json.Unmarshal(body, &films); err != nil {
+	if err := getJSON(ctx, country.httpClient(), url, &films); err != nil {
 		return nil, err
 	}
 
@@ -63,8 +106,76 @@ func GetFilms() ([]Film, error) {
 	return filmsToReturn, nil
 }
 
-func GetRomanianName(url string) (string, error) {
-	resp, err := http.Get(url)
+// GetFilmsDetails returns the details of the films having screenings in the country, up to and including `until`.
+func GetFilmsDetails(ctx context.Context, country Country, until time.Time) ([]FilmDetails, error) {
+	url := country.apiUrl(fmt.Sprintf("quickbook/%s/films/until/%s?attr=&lang=%s", country.Tenant, until.Format(DateLayout), defaultLang))
+
+	var films FilmDetailsList
+	if err := getJSON(ctx, country.httpClient(), url, &films); err != nil {
+		return nil, err
+	}
+
+	return films.Films, nil
+}
+
+// GetDates returns the dates, up to and including `until`, having screenings at the given cinema.
+func GetDates(ctx context.Context, country Country, cinemaId string, until time.Time) ([]string, error) {
+	url := country.apiUrl(fmt.Sprintf("quickbook/%s/dates/in-cinema/%s/until/%s?attr=&lang=%s", country.Tenant, cinemaId, until.Format(DateLayout), defaultLang))
+
+	var dates DatesList
+	if err := getJSON(ctx, country.httpClient(), url, &dates); err != nil {
+		return nil, err
+	}
+
+	return dates.Dates, nil
+}
+
+// GetEvents returns the screenings scheduled at the given cinema on the given date.
+func GetEvents(ctx context.Context, country Country, cinemaId string, date string) ([]Event, error) {
+	url := country.apiUrl(fmt.Sprintf("quickbook/%s/film-events/in-cinema/%s/at-date/%s?attr=&lang=%s", country.Tenant, cinemaId, date, defaultLang))
+
+	var events EventsList
+	if err := getJSON(ctx, country.httpClient(), url, &events); err != nil {
+		return nil, err
+	}
+
+	return events.Events, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	resp, err := get(ctx, client, url)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	// the sites answer the failed requests with HTML error pages, which aren't worth decoding
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// get requests the URL, unless the context is done.
+func get(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(req)
+}
+
+// GetFeatureName scrapes the film's local name from its HTML page, found on the given country's site.
+func GetFeatureName(ctx context.Context, country Country, url string) (string, error) {
+	resp, err := get(ctx, country.httpClient(), url)
 	if err != nil {
 		return "", err
 	}
@@ -79,7 +190,7 @@ func GetRomanianName(url string) (string, error) {
 	matches := re.FindStringSubmatch(string(body))
 
 	if len(matches) != 2 {
-		return "", errors.New("couldn't scrape the film's romanian name")
+		return "", errors.New("couldn't scrape the film's local name")
 	}
 
 	return matches[1], err
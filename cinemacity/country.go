@@ -0,0 +1,85 @@
+package cinemacity
+
+import (
+	"net/http"
+)
+
+// TitleStrategy is the way a film's local title is determined.
+type TitleStrategy int
+
+const (
+	// ScrapeFeatureName scrapes the `featureName` variable from the film's HTML page.
+	ScrapeFeatureName TitleStrategy = iota
+	// LocalFeed reads the title from the now-playing feed requested in the country's language.
+	LocalFeed
+)
+
+// Country is a Cinema City national site.
+type Country struct {
+	Code          string
+	BaseUrl       string
+	Tenant        string
+	Lang          string
+	TitleStrategy TitleStrategy
+	// Client makes the requests to the site; http.DefaultClient is used when it's nil.
+	Client *http.Client
+}
+
+// Countries lists the national sites, keyed by country code.
+var Countries = map[string]Country{
+	"bg": {
+		Code:          "bg",
+		BaseUrl:       "https://www.cinemacity.bg/bg",
+		Tenant:        "10106",
+		Lang:          "bg_BG",
+		TitleStrategy: LocalFeed,
+	},
+	"cz": {
+		Code:          "cz",
+		BaseUrl:       "https://www.cinemacity.cz/cz",
+		Tenant:        "10101",
+		Lang:          "cs_CZ",
+		TitleStrategy: LocalFeed,
+	},
+	"hu": {
+		Code:          "hu",
+		BaseUrl:       "https://www.cinemacity.hu/hu",
+		Tenant:        "10102",
+		Lang:          "hu_HU",
+		TitleStrategy: LocalFeed,
+	},
+	"pl": {
+		Code:          "pl",
+		BaseUrl:       "https://www.cinema-city.pl/pl",
+		Tenant:        "10103",
+		Lang:          "pl_PL",
+		TitleStrategy: LocalFeed,
+	},
+	"ro": {
+		Code:          "ro",
+		BaseUrl:       "https://www.cinemacity.ro/ro",
+		Tenant:        "10107",
+		Lang:          "ro_RO",
+		TitleStrategy: ScrapeFeatureName,
+	},
+	"sk": {
+		Code:          "sk",
+		BaseUrl:       "https://www.cinemacity.sk/sk",
+		Tenant:        "10105",
+		Lang:          "sk_SK",
+		TitleStrategy: LocalFeed,
+	},
+}
+
+// apiUrl returns the URL of the country's data API endpoint having the given path.
+func (c Country) apiUrl(path string) string {
+	return c.BaseUrl + "/data-api-service/v1/" + path
+}
+
+func (c Country) httpClient() *http.Client {
+	if c.Client == nil {
+		return http.DefaultClient
+	}
+
+	return c.Client
+}
@@ -0,0 +1,187 @@
+package cinemacity
+
+import (
+	"context"
+	"github.com/e10k/matheque/source"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ProviderNamePrefix prefixes the country code in the names the national sites are registered under
+// in the `source` package, e.g. `cinemacity.ro`.
+const ProviderNamePrefix = "cinemacity."
+
+func init() {
+	var codes []string
+	for code := range Countries {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		source.Register(Provider{Country: Countries[code]})
+	}
+}
+
+// Provider adapts the package's functions for one of the national sites to the `source.Provider` interface.
+type Provider struct {
+	Country Country
+}
+
+var _ source.HTTPProvider = Provider{}
+
+// WithClient returns the provider making its requests to the site with the given client.
+func (p Provider) WithClient(client *http.Client) source.Provider {
+	p.Country.Client = client
+
+	return p
+}
+
+func (p Provider) Name() string {
+	return ProviderNamePrefix + p.Country.Code
+}
+
+func (p Provider) CountryCode() string {
+	return p.Country.Code
+}
+
+func (p Provider) GetFilms(ctx context.Context, cinemaId string) ([]source.Film, error) {
+	return p.getFilms(ctx, GetFilms, cinemaId)
+}
+
+func (p Provider) GetComingSoon(ctx context.Context, cinemaId string) ([]source.Film, error) {
+	return p.getFilms(ctx, GetComingSoonFilms, cinemaId)
+}
+
+func (p Provider) getFilms(ctx context.Context, getFeed func(context.Context, Country, string, string) ([]Film, error), cinemaId string) ([]source.Film, error) {
+	films, err := getFeed(ctx, p.Country, cinemaId, defaultLang)
+	if err != nil {
+		return nil, err
+	}
+
+	localNames := make(map[string]string)
+
+	if p.Country.TitleStrategy == LocalFeed {
+		localFilms, err := getFeed(ctx, p.Country, cinemaId, p.Country.Lang)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, film := range localFilms {
+			localNames[film.Id] = film.Name
+		}
+	}
+
+	details, err := GetFilmsDetails(ctx, p.Country, time.Now().AddDate(1, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	detailsById := make(map[string]source.Details)
+	for _, d := range details {
+		attributes := ParseAttributes(d.AttributeIds)
+
+		detailsById[d.Id] = source.Details{
+			Length:            d.Length,
+			ReleaseYear:       d.ReleaseYear,
+			Genres:            attributes.Genres,
+			AgeRating:         attributes.AgeRating,
+			Formats:           attributes.Formats,
+			OriginalLanguage:  attributes.OriginalLanguage,
+			DubbedLanguages:   attributes.DubbedLanguages,
+			SubtitleLanguages: attributes.SubtitleLanguages,
+		}
+	}
+
+	var result []source.Film
+
+	for _, film := range films {
+		var releaseDate string
+		if len(film.DateStarted) >= len(DateLayout) {
+			releaseDate = film.DateStarted[:len(DateLayout)]
+		}
+
+		result = append(result, source.Film{
+			Id:          film.Id,
+			Name:        film.Name,
+			LocalName:   localNames[film.Id],
+			Link:        film.Link,
+			PosterLink:  film.PosterLink,
+			ReleaseDate: releaseDate,
+			Details:     detailsById[film.Id],
+		})
+	}
+
+	return result, nil
+}
+
+func (p Provider) GetLocalName(ctx context.Context, film source.Film) (string, error) {
+	if len(film.LocalName) > 0 {
+		return film.LocalName, nil
+	}
+
+	if p.Country.TitleStrategy == LocalFeed {
+		// the film is missing from the local feed, so there's nothing better than the original name
+		return film.Name, nil
+	}
+
+	return GetFeatureName(ctx, p.Country, film.Link)
+}
+
+func (p Provider) GetEvents(ctx context.Context, cinemaId string, until time.Time) ([]source.Event, error) {
+	dates, err := GetDates(ctx, p.Country, cinemaId, until)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []source.Event
+
+	for i, date := range dates {
+		if i > 0 {
+			// be respectful to the server, there's one request for each date
+			err = sleep(ctx, time.Duration(rand.Intn(3))*time.Second)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		events, err := GetEvents(ctx, p.Country, cinemaId, date)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range events {
+			attributes := ParseAttributes(event.AttributeIds)
+
+			result = append(result, source.Event{
+				Id:                event.Id,
+				FilmId:            event.FilmId,
+				CinemaId:          event.CinemaId,
+				BusinessDay:       event.BusinessDay,
+				DateTime:          event.EventDateTime,
+				BookingLink:       event.BookingLink,
+				Auditorium:        event.Auditorium,
+				Formats:           attributes.Formats,
+				DubbedLanguages:   attributes.DubbedLanguages,
+				SubtitleLanguages: attributes.SubtitleLanguages,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// sleep pauses for the given duration, unless the context is done first, in which case it returns the context's error.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,147 @@
+package cinemacity
+
+import (
+	"context"
+	"fmt"
+	"github.com/e10k/matheque/source"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replayProvider returns the Romanian provider, replaying the responses recorded in `testdata`.
+func replayProvider() source.Provider {
+	return Provider{Country: Countries["ro"]}.WithClient(&http.Client{Transport: source.Replayer{Dir: "testdata"}})
+}
+
+func TestProviderGetFilms(t *testing.T) {
+	films, err := replayProvider().GetFilms(context.Background(), "1806")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []source.Film{
+		{
+			Id:          "5376s2r",
+			Name:        "Dune: Part Two",
+			Link:        "https://www.cinemacity.ro/films/dune-part-two/5376s2r",
+			PosterLink:  "https://www.cinemacity.ro/xmedia-cw/repo/feats/posters/5376S2R-md.jpg",
+			ReleaseDate: "2024-03-01",
+			Details: source.Details{Length: 166, ReleaseYear: "2024", Genres: []string{"Action", "Sci-Fi"}, AgeRating: "N-15",
+				Formats: []string{"2D", "IMAX"}, OriginalLanguage: "en", SubtitleLanguages: []string{"ro"}},
+		},
+		{
+			Id:          "6270s2r",
+			Name:        "Kung Fu Panda 4",
+			Link:        "https://www.cinemacity.ro/films/kung-fu-panda-4/6270s2r",
+			PosterLink:  "https://www.cinemacity.ro/xmedia-cw/repo/feats/posters/6270S2R-md.jpg",
+			ReleaseDate: "2024-03-08",
+			Details: source.Details{Length: 94, ReleaseYear: "2024", Genres: []string{"Animation"}, AgeRating: "AG",
+				Formats: []string{"2D", "3D"}, OriginalLanguage: "en", DubbedLanguages: []string{"ro"}},
+		},
+	}
+
+	if fmt.Sprintf("%+v", films) != fmt.Sprintf("%+v", expected) {
+		t.Errorf("Expected %+v, got %+v", expected, films)
+	}
+
+	name, err := replayProvider().GetLocalName(context.Background(), films[0])
+	if err != nil || name != "Dune: Partea a doua" {
+		t.Errorf("Expected the scraped local name, got %q and %v", name, err)
+	}
+
+	// the film's page wasn't recorded
+	_, err = replayProvider().GetLocalName(context.Background(), films[1])
+	if err == nil {
+		t.Errorf("Expected an error for a film page missing from the fixtures")
+	}
+}
+
+func TestProviderGetComingSoon(t *testing.T) {
+	films, err := replayProvider().GetComingSoon(context.Background(), "1806")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(films) != 1 || films[0].Name != "Deadpool & Wolverine" || films[0].ReleaseDate != "2024-07-26" {
+		t.Errorf("Expected the announced film, got %+v", films)
+	}
+}
+
+func TestProviderGetEvents(t *testing.T) {
+	events, err := replayProvider().GetEvents(context.Background(), "1806", time.Now().AddDate(0, 0, 7))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []source.Event{
+		{Id: "101", FilmId: "5376s2r", CinemaId: "1806", BusinessDay: "2030-03-01", DateTime: "2030-03-01T20:30:00",
+			BookingLink: "https://www.cinemacity.ro/booking/101", Auditorium: "Sala 7", Formats: []string{"IMAX"}, SubtitleLanguages: []string{"ro"}},
+		{Id: "102", FilmId: "6270s2r", CinemaId: "1806", BusinessDay: "2030-03-01", DateTime: "2030-03-01T12:00:00",
+			BookingLink: "https://www.cinemacity.ro/booking/102", Auditorium: "Sala 2", Formats: []string{"2D"}, DubbedLanguages: []string{"ro"}},
+	}
+
+	if fmt.Sprintf("%+v", events) != fmt.Sprintf("%+v", expected) {
+		t.Errorf("Expected %+v, got %+v", expected, events)
+	}
+}
+
+func TestGetFilmsFromBaseUrl(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		fmt.Fprint(w, `{"body":{"posters":[{"code":"1","featureTitle":"Fight Club"}]}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	country := Country{Code: "ro", BaseUrl: server.URL + "/ro", Client: server.Client()}
+
+	films, err := GetFilms(context.Background(), country, "1806", defaultLang)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if requested != "/ro/data-api-service/v1/feed/1806/byName/now-playing?lang=en_GB" {
+		t.Errorf("Expected the feed to be requested from the base URL, got %q", requested)
+	}
+	if len(films) != 1 || films[0].Name != "Fight Club" {
+		t.Errorf("Expected the film served, got %+v", films)
+	}
+}
+
+func TestGetFilmsFailedRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the error pages may be valid JSON, which would pass for an empty feed
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{}`)
+	}))
+	t.Cleanup(server.Close)
+
+	country := Country{Code: "hu", BaseUrl: server.URL + "/hu", Client: server.Client()}
+
+	films, err := GetFilms(context.Background(), country, "1806", defaultLang)
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden") {
+		t.Errorf("Expected an error telling the status, got %+v and %v", films, err)
+	}
+}
+
+func TestGetFilmsCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the site hangs until the request is abandoned
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	country := Country{Code: "ro", BaseUrl: server.URL + "/ro", Client: server.Client()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := GetFilms(ctx, country, "1806", defaultLang)
+	if err == nil || time.Since(start) > time.Second {
+		t.Errorf("Expected the request to be abandoned along with the context, got %v after %v", err, time.Since(start))
+	}
+}
@@ -3,7 +3,8 @@ package config
 
 import (
 	"bufio"
-	"database/sql"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -13,14 +14,75 @@ import (
 )
 
 type Conf struct {
-	DB               *sql.DB
+	Mode             string
 	URL              string
 	PORT             int
 	TelegramBotToken string
+	Providers        []string
+	Cinemas          []Cinema
+	// NotificationWorkers is how many notifications are sent concurrently.
+	NotificationWorkers int
+	// DBDriver is the kind of database the records are kept in, one of the `Driver...` constants.
+	DBDriver string
+	// DBPath is the location of the sqlite database, created if it doesn't exist.
+	DBPath string
+	// DBURL is the connection URL of the PostgreSQL database.
+	DBURL string
+	// SourceMode tells whether the providers' requests are made, recorded or replayed, one of the `Source...` constants.
+	SourceMode string
+	// FixturesPath is the directory the providers' responses are recorded in and replayed from.
+	FixturesPath string
 }
 
+// Cinema is a venue whose program is checked for new films.
+type Cinema struct {
+	Provider string
+	Id       string
+	Name     string
+}
+
+// The ways of receiving updates from Telegram.
+const (
+	// ModeWebhook has Telegram push the updates to the public URL.
+	ModeWebhook = "webhook"
+	// ModePolling has the bot pull the updates, for deployments without a public URL.
+	ModePolling = "polling"
+)
+
+// The kinds of databases the records can be kept in.
+const (
+	// DriverSQLite keeps the records in a sqlite file, found at DB_PATH.
+	DriverSQLite = "sqlite"
+	// DriverPostgres keeps the records in the PostgreSQL database found at DB_URL.
+	DriverPostgres = "postgres"
+)
+
+// The ways the providers get the films.
+const (
+	// SourceLive has the providers make their requests to the cinemas' sites.
+	SourceLive = "live"
+	// SourceRecord is like SourceLive, but the responses are also saved to FIXTURES_PATH.
+	SourceRecord = "record"
+	// SourceReplay serves the responses saved to FIXTURES_PATH, without any requests being made to the cinemas' sites.
+	SourceReplay = "replay"
+)
+
+const (
+	// defaultProviders is used when the `.config` file doesn't list any provider.
+	defaultProviders = "cinemacity.ro"
+	// defaultCinemas is used when the `.config` file doesn't list any venue.
+	defaultCinemas = "10107"
+	// defaultDBPath is used when the `.config` file doesn't set DB_PATH.
+	defaultDBPath = "./data/matheque.sqlite"
+	// defaultFixturesPath is used when the `.config` file doesn't set FIXTURES_PATH.
+	defaultFixturesPath = "./testdata"
+	// defaultNotificationWorkers is used when the `.config` file doesn't set NOTIFICATION_WORKERS.
+	defaultNotificationWorkers = 4
+)
+
 // NewConfig parses a `.config` file, reads/sanitizes its variables, then populates and returns a `Config` struct.
-func NewConfig(db *sql.DB) *Conf {
+// The database is left for the caller to open, as described by `DBDriver`.
+func NewConfig() *Conf {
 
 	values, err := getValues()
 
@@ -28,18 +90,30 @@ func NewConfig(db *sql.DB) *Conf {
 		log.Fatal(err)
 	}
 
+	mode, ok := values["MODE"]
+	if !ok || len(mode) == 0 {
+		mode = ModeWebhook
+	}
+	if mode != ModeWebhook && mode != ModePolling {
+		log.Fatal("config: invalid MODE")
+	}
+
+	// the URL and the port are only needed for receiving updates through the webhook
 	url, ok := values["URL"]
-	if !ok || len(url) == 0 {
+	if mode == ModeWebhook && (!ok || len(url) == 0) {
 		log.Fatal("config: invalid URL")
 	}
 
+	var port int
 	p, ok := values["PORT"]
-	if !ok || len(p) == 0 {
+	if mode == ModeWebhook && (!ok || len(p) == 0) {
 		log.Fatal("config: invalid PORT")
 	}
-	port, err := strconv.Atoi(p)
-	if err != nil {
-		log.Fatal("config: invalid PORT value")
+	if len(p) > 0 {
+		port, err = strconv.Atoi(p)
+		if err != nil {
+			log.Fatal("config: invalid PORT value")
+		}
 	}
 
 	telegramBotToken, ok := values["TELEGRAM_BOT_TOKEN"]
@@ -47,12 +121,158 @@ func NewConfig(db *sql.DB) *Conf {
 		log.Fatal("config: invalid TELEGRAM_BOT_TOKEN")
 	}
 
+	pr, ok := values["PROVIDERS"]
+	if !ok || len(pr) == 0 {
+		pr = defaultProviders
+	}
+	providers, err := parseProviders(pr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c, ok := values["CINEMAS"]
+	if !ok || len(c) == 0 {
+		c = defaultCinemas
+	}
+	cinemas, err := parseCinemas(c, providers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dbDriver, ok := values["DB_DRIVER"]
+	if !ok || len(dbDriver) == 0 {
+		dbDriver = DriverSQLite
+	}
+	if dbDriver != DriverSQLite && dbDriver != DriverPostgres {
+		log.Fatal("config: invalid DB_DRIVER")
+	}
+
+	dbPath, ok := values["DB_PATH"]
+	if !ok || len(dbPath) == 0 {
+		dbPath = defaultDBPath
+	}
+
+	dbURL, ok := values["DB_URL"]
+	if dbDriver == DriverPostgres && (!ok || len(dbURL) == 0) {
+		log.Fatal("config: invalid DB_URL")
+	}
+
+	sourceMode, ok := values["SOURCE_MODE"]
+	if !ok || len(sourceMode) == 0 {
+		sourceMode = SourceLive
+	}
+	if sourceMode != SourceLive && sourceMode != SourceRecord && sourceMode != SourceReplay {
+		log.Fatal("config: invalid SOURCE_MODE")
+	}
+
+	fixturesPath, ok := values["FIXTURES_PATH"]
+	if !ok || len(fixturesPath) == 0 {
+		fixturesPath = defaultFixturesPath
+	}
+
+	notificationWorkers := defaultNotificationWorkers
+	if w, ok := values["NOTIFICATION_WORKERS"]; ok && len(w) > 0 {
+		notificationWorkers, err = strconv.Atoi(w)
+		if err != nil || notificationWorkers < 1 {
+			log.Fatal("config: invalid NOTIFICATION_WORKERS value")
+		}
+	}
+
 	return &Conf{
-		DB:               db,
+		Mode:             mode,
 		URL:              url,
 		PORT:             port,
 		TelegramBotToken: telegramBotToken,
+		Providers:        providers,
+		Cinemas:          cinemas,
+
+		NotificationWorkers: notificationWorkers,
+		DBDriver:            dbDriver,
+		DBPath:              dbPath,
+		DBURL:               dbURL,
+		SourceMode:          sourceMode,
+		FixturesPath:        fixturesPath,
+	}
+}
+
+// parseProviders parses a comma separated list of provider names.
+func parseProviders(value string) ([]string, error) {
+	var providers []string
+
+	seen := make(map[string]bool)
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 || seen[item] {
+			continue
+		}
+		seen[item] = true
+
+		providers = append(providers, item)
+	}
+
+	if len(providers) == 0 {
+		return nil, errors.New("config: invalid PROVIDERS")
+	}
+
+	return providers, nil
+}
+
+// parseCinemas parses a comma separated list of cinemas, each given as `[provider/]id[:name]`.
+// When the provider is missing, the first of the given providers is used; when the name is missing, the id is used instead.
+func parseCinemas(value string, providers []string) ([]Cinema, error) {
+	var cinemas []Cinema
+
+	seen := make(map[string]bool)
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(item, ":", 2)
+
+		provider := providers[0]
+		id := strings.TrimSpace(parts[0])
+		if i := strings.Index(id, "/"); i >= 0 {
+			provider = strings.TrimSpace(id[:i])
+			id = strings.TrimSpace(id[i+1:])
+		}
+
+		if len(id) == 0 || !contains(providers, provider) {
+			return nil, fmt.Errorf("config: invalid CINEMAS entry %q", item)
+		}
+
+		key := provider + "/" + id
+		if seen[key] {
+			return nil, fmt.Errorf("config: duplicate cinema %q in CINEMAS", key)
+		}
+		seen[key] = true
+
+		name := id
+		if len(parts) == 2 && len(strings.TrimSpace(parts[1])) > 0 {
+			name = strings.TrimSpace(parts[1])
+		}
+
+		cinemas = append(cinemas, Cinema{Provider: provider, Id: id, Name: name})
+	}
+
+	if len(cinemas) == 0 {
+		return nil, errors.New("config: invalid CINEMAS")
 	}
+
+	return cinemas, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
 }
 
 func getValues() (map[string]string, error) {
@@ -56,3 +56,35 @@ HAS_VARIOUS_CHARS_IN_QUOTES = "±!@#$%^&*()\")~<>?|👁:" # comment
 		}
 	}
 }
+
+func TestParseCinemas(t *testing.T) {
+	providers := []string{"cinemacity", "other"}
+
+	cinemas, err := parseCinemas(" 10107 , 1806:Iulius Mall Cluj,1825: , other/1806:Elsewhere", providers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Cinema{
+		{Provider: "cinemacity", Id: "10107", Name: "10107"},
+		{Provider: "cinemacity", Id: "1806", Name: "Iulius Mall Cluj"},
+		{Provider: "cinemacity", Id: "1825", Name: "1825"},
+		{Provider: "other", Id: "1806", Name: "Elsewhere"},
+	}
+
+	if len(cinemas) != len(expected) {
+		t.Fatalf("Expected %d cinemas, got %d", len(expected), len(cinemas))
+	}
+
+	for i, c := range expected {
+		if cinemas[i] != c {
+			t.Errorf("Expected %v, got %v", c, cinemas[i])
+		}
+	}
+
+	for _, invalid := range []string{"", " , ", "1806,1806:Cluj", ":Cluj", "unknown/1806", "other/"} {
+		if _, err := parseCinemas(invalid, providers); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
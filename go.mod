@@ -2,4 +2,7 @@ module github.com/e10k/matheque
 
 go 1.18
 
-require github.com/mattn/go-sqlite3 v1.14.13 // indirect
+require (
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.13
+)
@@ -0,0 +1,862 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/e10k/matheque/config"
+	"github.com/e10k/matheque/source"
+	"github.com/e10k/matheque/storage"
+	"github.com/e10k/matheque/telegram"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// webhookHandler receives the updates sent by Telegram and responds to them.
+func webhookHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		return
+	}
+
+	body, _ := ioutil.ReadAll(req.Body)
+
+	var u telegram.WebhookUpdate
+	err := json.Unmarshal(body, &u)
+	if err != nil {
+		log.Println("unmarshal error", err)
+		return
+	}
+
+	response, err := handleUpdate(u)
+	if err != nil {
+		// let Telegram deliver the update again later
+		log.Printf("handling update %d: %v", u.UpdateId, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// respond to the telegram update
+	if response != nil {
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			log.Printf("handling update %d: %v", u.UpdateId, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(jsonData)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// handleUpdate reacts to an update received from Telegram and returns the method to be called in response, if any;
+// an update delivered again after having been handled is skipped.
+func handleUpdate(u telegram.WebhookUpdate) (interface{}, error) {
+	processed, err := store.IsUpdateProcessed(u.UpdateId)
+	if err != nil {
+		return nil, err
+	}
+
+	if processed {
+		log.Printf("skipping update %d, handled already", u.UpdateId)
+		return nil, nil
+	}
+
+	response, err := dispatchUpdate(u)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = store.SetUpdateProcessed(u.UpdateId)
+	if err != nil {
+		log.Printf("marking update %d as processed: %v", u.UpdateId, err)
+	}
+
+	return response, nil
+}
+
+// dispatchUpdate hands the update over to the handler of its kind.
+func dispatchUpdate(u telegram.WebhookUpdate) (interface{}, error) {
+	if u.CallbackQuery != nil {
+		return handleCallbackQuery(*u.CallbackQuery)
+	}
+
+	if u.Message != nil {
+		return handleMessage(*u.Message)
+	}
+
+	if u.EditedMessage != nil {
+		return handleMessage(*u.EditedMessage)
+	}
+
+	return nil, nil
+}
+
+// handleMessage reacts to a message sent by a user, be it a command or a response to a previous command.
+func handleMessage(m telegram.WebhookUpdateMessage) (interface{}, error) {
+	inserted, err := store.InsertMessage(&storage.Message{
+		MessageId:     m.MessageId,
+		FromId:        m.From.Id,
+		FromFirstName: m.From.FirstName,
+		ChatId:        m.Chat.Id,
+		ChatFirstName: m.Chat.FirstName,
+		Text:          m.Text,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the message is stored already when its update failed halfway and got delivered again
+	redelivered := inserted == 0
+
+	var response interface{}
+
+	text := m.Text
+	chatId := m.Chat.Id
+	userId := m.From.Id
+
+	if strings.HasPrefix(text, "/start") {
+		_, err = store.UpdateChatStatus(chatId, userId, storage.ChatIdle)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = store.Subscribe(chatId, userId)
+		if err != nil {
+			return nil, err
+		}
+
+		response = telegram.MakeResponseForStartCommand(chatId)
+	} else if strings.HasPrefix(text, "/stop") {
+		_, err = store.UpdateChatStatus(chatId, userId, storage.ChatIdle)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = store.Unsubscribe(chatId, userId)
+		if err != nil {
+			return nil, err
+		}
+
+		response = telegram.MakeResponseForStopCommand(chatId)
+	} else if strings.HasPrefix(text, "/list") {
+		_, err = store.UpdateChatStatus(chatId, userId, storage.ChatIdle)
+		if err != nil {
+			return nil, err
+		}
+		watchers, err := listWatchers(chatId)
+		if err != nil {
+			return nil, err
+		}
+		response = telegram.MakeResponseForListCommand(watchers, chatId)
+	} else if strings.HasPrefix(text, "/add") {
+		_, err := store.UpdateChatStatus(chatId, userId, storage.ChatWaitingForWatcherToAdd)
+		if err != nil {
+			return nil, err
+		}
+		response = telegram.MakeResponseForAddCommand(chatId)
+	} else if strings.HasPrefix(text, "/remove") {
+		_, err = store.UpdateChatStatus(chatId, userId, storage.ChatWaitingForWatcherToRemove)
+		if err != nil {
+			return nil, err
+		}
+
+		watchers, err := store.GetWatchers(chatId)
+		if err != nil {
+			return nil, err
+		}
+		response = telegram.MakeResponseForRemoveCommand(&watchers, chatId)
+	} else if strings.HasPrefix(text, "/updates") {
+		_, err = store.UpdateChatStatus(chatId, userId, storage.ChatWaitingForWatcherToToggleUpdates)
+		if err != nil {
+			return nil, err
+		}
+
+		watchers, err := store.GetWatchers(chatId)
+		if err != nil {
+			return nil, err
+		}
+
+		enabledWatchers, err := store.GetWatchersWithNewScreenings(chatId)
+		if err != nil {
+			return nil, err
+		}
+
+		enabled := make(map[string]bool)
+		for _, w := range enabledWatchers {
+			enabled[w] = true
+		}
+		response = telegram.MakeResponseForUpdatesCommand(&watchers, enabled, chatId)
+	} else if strings.HasPrefix(text, "/matching") {
+		_, err = store.UpdateChatStatus(chatId, userId, storage.ChatWaitingForWatcherToSetStrictness)
+		if err != nil {
+			return nil, err
+		}
+
+		watchers, err := store.GetWatchers(chatId)
+		if err != nil {
+			return nil, err
+		}
+		response = telegram.MakeResponseForMatchingCommand(&watchers, chatId)
+	} else if strings.HasPrefix(text, "/cinemas") {
+		_, err = store.UpdateChatStatus(chatId, userId, storage.ChatWaitingForCinemaToToggle)
+		if err != nil {
+			return nil, err
+		}
+
+		chatCinemas, err := store.GetChatCinemas(chatId)
+		if err != nil {
+			return nil, err
+		}
+
+		country, err := store.GetChatCountry(chatId, userId)
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		selected := make(map[string]bool)
+		for _, cinema := range conf.Cinemas {
+			if len(country) > 0 && providers[cinema.Provider].CountryCode() != country {
+				continue
+			}
+
+			names = append(names, cinema.Name)
+			for _, c := range chatCinemas {
+				if c.Provider == cinema.Provider && c.CinemaId == cinema.Id {
+					selected[cinema.Name] = true
+				}
+			}
+		}
+		response = telegram.MakeResponseForCinemasCommand(chatId, names, selected)
+	} else if strings.HasPrefix(text, "/alerts") {
+		_, err = store.UpdateChatStatus(chatId, userId, storage.ChatWaitingForAlertToToggle)
+		if err != nil {
+			return nil, err
+		}
+
+		alerts, err := store.GetChatAlerts(chatId, userId)
+		if err != nil {
+			return nil, err
+		}
+		response = telegram.MakeResponseForAlertsCommand(chatId, alerts[storage.AlertAnnouncement], alerts[storage.AlertOnSale])
+	} else if strings.HasPrefix(text, "/country") {
+		_, err = store.UpdateChatStatus(chatId, userId, storage.ChatWaitingForCountry)
+		if err != nil {
+			return nil, err
+		}
+
+		country, err := store.GetChatCountry(chatId, userId)
+		if err != nil {
+			return nil, err
+		}
+		response = telegram.MakeResponseForCountryCommand(chatId, getCountries(), country)
+	} else if strings.HasPrefix(text, "/history") {
+		_, err = store.UpdateChatStatus(chatId, userId, storage.ChatIdle)
+		if err != nil {
+			return nil, err
+		}
+
+		history, err := store.GetNotificationHistory(chatId, historyLength)
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []telegram.HistoryEntry
+		for _, n := range history {
+			cinemaName := n.CinemaId
+			if cinema, ok := findCinema(n.Provider, n.CinemaId); ok {
+				cinemaName = cinema.Name
+			}
+
+			entries = append(entries, telegram.HistoryEntry{
+				FilmName:   n.FilmName,
+				FilmLink:   n.FilmLink,
+				CinemaName: cinemaName,
+				Reason:     describeReason(n.Reason),
+				Date:       n.SentAt.Format("02 Jan"),
+			})
+		}
+		response = telegram.MakeResponseForHistoryCommand(chatId, entries)
+	} else {
+		// at this point it is clear that the message received is not a command,
+		// so the way it is handled will depend on the chat status
+		chatStatus, err := store.GetChatStatus(chatId, userId)
+		if err != nil {
+			return nil, err
+		}
+		nextStatus := storage.ChatIdle
+
+		if chatStatus == storage.ChatWaitingForWatcherToAdd {
+			// the message is a response to an /add command, so add the new watcher if it doesn't exist
+			reason, err := checkPatternWatcher(chatId, text)
+			if err != nil {
+				return nil, err
+			}
+
+			added := false
+			if len(reason) == 0 {
+				rowsAffected, err := store.InsertWatcher(chatId, text)
+				if err != nil {
+					return nil, err
+				}
+				added = rowsAffected > 0
+
+				if !added && redelivered {
+					// the watcher was added while handling the message the first time
+					_, added, err = findWatcher(chatId, text)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+
+			if len(reason) > 0 {
+				response = telegram.MakeResponseForWatcherAdded(chatId, reason)
+			} else if !added {
+				response = telegram.MakeResponseForWatcherAdded(chatId, "This looks like an invalid or already existing watcher. 🧐")
+			} else {
+				// go on with setting up the watcher's filters
+				_, err = store.SetPendingWatcher(chatId, userId, strings.TrimSpace(text))
+				if err != nil {
+					return nil, err
+				}
+
+				nextStatus = storage.ChatWaitingForFormatFilter
+				response = telegram.MakeResponseForFormatFilter(chatId, "Watcher added ✨")
+			}
+		} else if chatStatus == storage.ChatWaitingForFormatFilter ||
+			chatStatus == storage.ChatWaitingForAudioFilter ||
+			chatStatus == storage.ChatWaitingForSubtitlesFilter ||
+			chatStatus == storage.ChatWaitingForAgeRatingFilter {
+			// the message is a response to one of the questions asked after adding a watcher
+			response, nextStatus, err = handleFilterResponse(chatId, userId, chatStatus, text)
+			if err != nil {
+				return nil, err
+			}
+		} else if chatStatus == storage.ChatWaitingForWatcherToRemove {
+			// the message is a response to a /remove command, so remove the specified watcher, if found
+			rowsAffected, err := store.RemoveWatcher(chatId, text)
+			var msg string
+			if err != nil {
+				return nil, err
+			} else if rowsAffected == 0 {
+				msg = "Couldn't find a watcher named like that."
+			}
+			response = telegram.MakeResponseForWatcherRemoved(chatId, msg)
+		} else if chatStatus == storage.ChatWaitingForWatcherToToggleUpdates {
+			// the message is a response to an /updates command, so toggle the new screenings notifications of the specified watcher, if found
+			watcher := strings.TrimSpace(strings.TrimPrefix(text, telegram.NewScreeningsMark))
+			rowsAffected, enabled, err := store.ToggleWatcherNewScreenings(chatId, watcher)
+			var msg string
+			if err != nil {
+				return nil, err
+			} else if rowsAffected == 0 {
+				msg = "Couldn't find a watcher named like that."
+			}
+			response = telegram.MakeResponseForWatcherUpdatesToggled(chatId, watcher, enabled, msg)
+		} else if chatStatus == storage.ChatWaitingForWatcherToSetStrictness {
+			// the message is a response to a /matching command, so ask how closely the specified watcher has to match, if found
+			watcher, found, err := findWatcher(chatId, text)
+			if err != nil {
+				return nil, err
+			}
+
+			if found {
+				_, err = store.SetPendingWatcher(chatId, userId, watcher.Keywords)
+				if err != nil {
+					return nil, err
+				}
+
+				nextStatus = storage.ChatWaitingForStrictness
+				response = telegram.MakeResponseForStrictnessQuestion(chatId, watcher.Keywords, strictnessLabels[watcher.Strictness], "")
+			} else {
+				response = telegram.MakeResponseForStrictnessSet(chatId, "", "", "Couldn't find a watcher named like that.")
+			}
+		} else if chatStatus == storage.ChatWaitingForStrictness {
+			// the message is a response to the question asked after picking a watcher to change the matching of
+			pending, err := store.GetPendingWatcher(chatId, userId)
+			if err != nil {
+				return nil, err
+			}
+
+			watcher, found, err := findWatcher(chatId, pending)
+			if err != nil {
+				return nil, err
+			}
+
+			strictness, valid := findStrictnessByLabel(text)
+			if !found {
+				response = telegram.MakeResponseForStrictnessSet(chatId, "", "", "Couldn't find a watcher named like that.")
+			} else if valid {
+				_, err = store.SetWatcherStrictness(chatId, watcher.Keywords, strictness)
+				if err != nil {
+					return nil, err
+				}
+				response = telegram.MakeResponseForStrictnessSet(chatId, watcher.Keywords, strictnessLabels[strictness], "")
+			} else {
+				nextStatus = storage.ChatWaitingForStrictness
+				response = telegram.MakeResponseForStrictnessQuestion(chatId, watcher.Keywords, strictnessLabels[watcher.Strictness], "Please pick one of the options below.")
+			}
+		} else if chatStatus == storage.ChatWaitingForAlertToToggle {
+			// the message is a response to an /alerts command, so toggle the specified alert, if found
+			var msg, label string
+			var enabled bool
+			alert, found := findAlertByLabel(text)
+			if found {
+				enabled, err = store.ToggleChatAlert(chatId, userId, alert)
+				if err != nil {
+					return nil, err
+				}
+				label = alertLabels[alert]
+			} else {
+				msg = "Couldn't find an option named like that."
+			}
+			response = telegram.MakeResponseForAlertToggled(chatId, label, enabled, msg)
+		} else if chatStatus == storage.ChatWaitingForCountry {
+			// the message is a response to a /country command, so set the specified country, if available
+			var msg string
+			country, found := findCountryByLabel(text)
+			if found {
+				_, err = store.SetChatCountry(chatId, userId, country)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				msg = "Sorry, there are no cinemas available for that country."
+			}
+			response = telegram.MakeResponseForCountrySet(chatId, country, msg)
+		} else if chatStatus == storage.ChatWaitingForCinemaToToggle {
+			// the message is a response to a /cinemas command, so toggle the specified cinema, if found
+			name := strings.TrimSpace(strings.TrimPrefix(text, telegram.SelectedCinemaMark))
+			var msg string
+			var selected bool
+			cinema, found := findCinemaByName(name)
+			if found {
+				selected, err = store.ToggleChatCinema(chatId, cinema.Provider, cinema.Id)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				msg = "Couldn't find a cinema named like that."
+			}
+			response = telegram.MakeResponseForCinemaToggled(chatId, cinema.Name, selected, msg)
+		} else {
+			// the message is a random one
+			response = telegram.MakeResponseForUnknownCommand(chatId)
+		}
+
+		// set the chat as idle, unless a follow-up message is expected
+		_, err = store.UpdateChatStatus(chatId, userId, nextStatus)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+// handleCallbackQuery reacts to a press of an inline keyboard button by editing the message the button is attached to.
+func handleCallbackQuery(q telegram.CallbackQuery) (interface{}, error) {
+	var response interface{}
+	var notice string
+
+	action, id, ok := telegram.ParseCallbackData(q.Data)
+
+	if ok && q.Message != nil {
+		chatId := q.Message.Chat.Id
+		messageId := q.Message.MessageId
+
+		var keyboard telegram.InlineKeyboardMarkup
+		if q.Message.ReplyMarkup != nil {
+			keyboard = *q.Message.ReplyMarkup
+		}
+
+		switch action {
+		case telegram.CallbackDeleteWatcher:
+			rowsAffected, err := store.RemoveWatcherById(chatId, id)
+			if err != nil {
+				return nil, err
+			}
+
+			notice = "Watcher removed 🗑"
+			if rowsAffected == 0 {
+				notice = "This watcher was already removed."
+			}
+
+			watchers, err := listWatchers(chatId)
+			if err != nil {
+				return nil, err
+			}
+			response = telegram.MakeResponseForWatcherDeleted(watchers, chatId, messageId)
+		case telegram.CallbackMuteFilm, telegram.CallbackUnmuteFilm, telegram.CallbackMuteUpcomingFilm, telegram.CallbackUnmuteUpcomingFilm:
+			film, err := getCallbackFilm(action, id)
+			if err != nil {
+				return nil, err
+			}
+
+			if film == nil {
+				notice = "This film is no longer available."
+				break
+			}
+
+			muted, err := store.ToggleMutedFilm(chatId, film.Provider, film.Id)
+			if err != nil {
+				return nil, err
+			}
+
+			notice = "You won't be notified about this film anymore 🔇"
+			if !muted {
+				notice = "You will be notified about this film again 🔔"
+			}
+			response = telegram.MakeResponseForFilmMuteToggled(chatId, messageId, keyboard, id, muted)
+		case telegram.CallbackMoreShowtimes, telegram.CallbackMoreUpcomingShowtimes:
+			film, err := getCallbackFilm(action, id)
+			if err != nil {
+				return nil, err
+			}
+
+			if film == nil {
+				notice = "This film is no longer available."
+				break
+			}
+
+			events, err := store.GetUpcomingEvents(film.Provider, film.Id, film.CinemaId, time.Now().Format(source.DateTimeLayout), screeningsPerUpdate)
+			if err != nil {
+				return nil, err
+			}
+
+			cinemaName := film.CinemaId
+			if cinema, ok := findCinema(film.Provider, film.CinemaId); ok {
+				cinemaName = cinema.Name
+			}
+
+			isPhoto := len(q.Message.Caption) > 0
+			response = telegram.MakeResponseForMoreShowtimes(chatId, messageId, isPhoto, keyboard, film.OriginalName, film.Link, cinemaName, makeScreenings(events, screeningsPerUpdate))
+		}
+	}
+
+	// the edit is sent as the response to the update, so the button press is acknowledged separately
+	err := client.Call(telegram.NewCallbackAnswer(q.Id, notice), nil)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return response, nil
+}
+
+// getCallbackFilm returns the film the button pressed refers to by its row id, which is the one of an upcoming film
+// for the buttons of the announcements.
+func getCallbackFilm(action string, rowId int64) (*storage.Film, error) {
+	if telegram.IsUpcomingFilmCallback(action) {
+		return store.GetUpcomingFilmByRowId(rowId)
+	}
+
+	return store.GetFilmByRowId(rowId)
+}
+
+// historyLength is how many notifications are listed by the `/history` command
+const historyLength = 10
+
+func describeReason(r storage.NotificationReason) string {
+	switch {
+	case r == storage.ReasonOnSale:
+		return "on sale"
+	case r == storage.ReasonAnnouncement:
+		return "announced"
+	case r.IsNewScreenings():
+		return "new showtimes"
+	}
+
+	return string(r)
+}
+
+// listWatchers returns the chat's watchers, as shown by the `/list` command.
+func listWatchers(chatId int) ([]telegram.ListedWatcher, error) {
+	watchers, err := store.GetWatcherList(chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	var listed []telegram.ListedWatcher
+	for _, w := range watchers {
+		description := describeFilters(w.Filters)
+		if w.Strictness != storage.StrictnessPhrase {
+			description = strings.TrimSuffix(strings.ToLower(strictnessLabels[w.Strictness])+" · "+description, " · ")
+		}
+
+		listed = append(listed, telegram.ListedWatcher{
+			Id:       w.Id,
+			Keywords: w.Keywords,
+			Filters:  description,
+		})
+	}
+
+	return listed, nil
+}
+
+// findWatcher returns the chat's watcher having the given keywords, ignoring the case.
+func findWatcher(chatId int, keywords string) (storage.Watcher, bool, error) {
+	watchers, err := store.GetWatcherList(chatId)
+	if err != nil {
+		return storage.Watcher{}, false, err
+	}
+
+	for _, w := range watchers {
+		if strings.EqualFold(w.Keywords, strings.TrimSpace(keywords)) {
+			return w, true, nil
+		}
+	}
+
+	return storage.Watcher{}, false, nil
+}
+
+// checkPatternWatcher tells why the keywords of a pattern watcher can't be added, if that's the case:
+// their pattern is invalid, or the chat has as many pattern watchers as allowed already.
+func checkPatternWatcher(chatId int, keywords string) (string, error) {
+	pattern, ok := storage.ParsePattern(keywords)
+	if !ok {
+		return "", nil
+	}
+
+	if _, err := storage.CompilePattern(pattern); err != nil {
+		return fmt.Sprintf("This pattern can't be used: %s. 🧐", telegram.EscapeMarkdown(err.Error())), nil
+	}
+
+	count, err := store.CountPatternWatchers(chatId)
+	if err != nil {
+		return "", err
+	}
+
+	if count >= storage.MaxPatternWatchers {
+		return fmt.Sprintf("You can have up to %d pattern watchers. 🧐", storage.MaxPatternWatchers), nil
+	}
+
+	return "", nil
+}
+
+var strictnessLabels = map[storage.Strictness]string{
+	storage.StrictnessExact:  telegram.StrictnessExactLabel,
+	storage.StrictnessPhrase: telegram.StrictnessPhraseLabel,
+	storage.StrictnessFuzzy:  telegram.StrictnessFuzzyLabel,
+}
+
+// findStrictnessByLabel returns the strictness having the given keyboard button label, ignoring the case.
+func findStrictnessByLabel(label string) (storage.Strictness, bool) {
+	for strictness, l := range strictnessLabels {
+		if strings.EqualFold(strings.TrimSpace(label), l) {
+			return strictness, true
+		}
+	}
+
+	return 0, false
+}
+
+var alertLabels = map[storage.Alert]string{
+	storage.AlertAnnouncement: telegram.AnnouncementAlertsLabel,
+	storage.AlertOnSale:       telegram.OnSaleAlertsLabel,
+}
+
+// findAlertByLabel returns the alert whose keyboard button label starts the given text.
+func findAlertByLabel(text string) (storage.Alert, bool) {
+	for alert, label := range alertLabels {
+		if strings.HasPrefix(strings.TrimSpace(text), label) {
+			return alert, true
+		}
+	}
+
+	return 0, false
+}
+
+// getCountries returns the sorted codes of the countries the configured cinemas are in.
+func getCountries() []string {
+	var countries []string
+
+	seen := make(map[string]bool)
+	for _, cinema := range conf.Cinemas {
+		country := providers[cinema.Provider].CountryCode()
+		if !seen[country] {
+			seen[country] = true
+			countries = append(countries, country)
+		}
+	}
+
+	sort.Strings(countries)
+
+	return countries
+}
+
+// findCountryByLabel returns the code of the available country having the given keyboard button label;
+// an empty code stands for all the countries.
+func findCountryByLabel(label string) (string, bool) {
+	label = strings.TrimSpace(label)
+
+	if label == telegram.AllCountriesLabel {
+		return "", true
+	}
+
+	for _, country := range getCountries() {
+		if strings.EqualFold(label, telegram.CountryLabel(country)) || strings.EqualFold(label, country) {
+			return country, true
+		}
+	}
+
+	return "", false
+}
+
+// filterSteps describes the questions asked, in order, for setting up a new watcher's filters.
+var filterSteps = []struct {
+	status  storage.ChatStatus
+	filter  storage.WatcherFilter
+	options map[string]string // keyboard button labels mapped to filter values
+}{
+	{storage.ChatWaitingForFormatFilter, storage.FilterFormat, nil},
+	{storage.ChatWaitingForAudioFilter, storage.FilterAudio, map[string]string{
+		telegram.AudioOriginalLabel: storage.AudioOriginal,
+		telegram.AudioDubbedLabel:   storage.AudioDubbed,
+	}},
+	{storage.ChatWaitingForSubtitlesFilter, storage.FilterSubtitles, map[string]string{
+		telegram.SubtitlesYesLabel: storage.SubtitlesYes,
+		telegram.SubtitlesNoLabel:  storage.SubtitlesNo,
+	}},
+	{storage.ChatWaitingForAgeRatingFilter, storage.FilterAgeRating, nil},
+}
+
+// handleFilterResponse stores the filter value picked by the chat for its pending watcher,
+// then returns the next question along with the chat's next status.
+func handleFilterResponse(chatId int, userId int, status storage.ChatStatus, text string) (interface{}, storage.ChatStatus, error) {
+	watcher, err := store.GetPendingWatcher(chatId, userId)
+	if err != nil {
+		return nil, storage.ChatIdle, err
+	}
+
+	ageRatings, err := store.GetAgeRatings()
+	if err != nil {
+		return nil, storage.ChatIdle, err
+	}
+
+	step := 0
+	for i, s := range filterSteps {
+		if s.status == status {
+			step = i
+		}
+	}
+
+	text = strings.TrimSpace(text)
+
+	value, valid := "", strings.EqualFold(text, telegram.AnyOptionLabel)
+	if !valid {
+		options := filterSteps[step].options
+		if filterSteps[step].filter == storage.FilterFormat {
+			options = labelsAsOptions(telegram.FormatOptions)
+		} else if filterSteps[step].filter == storage.FilterAgeRating {
+			options = labelsAsOptions(ageRatings)
+		}
+
+		for label, v := range options {
+			if strings.EqualFold(text, label) {
+				value, valid = v, true
+			}
+		}
+	}
+
+	if !valid {
+		return askFilter(chatId, step, "Please pick one of the options below.", ageRatings), status, nil
+	}
+
+	_, err = store.SetWatcherFilter(chatId, watcher, filterSteps[step].filter, value)
+	if err != nil {
+		return nil, storage.ChatIdle, err
+	}
+
+	step++
+	if step == len(filterSteps)-1 && len(ageRatings) == 0 {
+		// there's nothing to pick from yet
+		step++
+	}
+
+	if step < len(filterSteps) {
+		return askFilter(chatId, step, "", ageRatings), filterSteps[step].status, nil
+	}
+
+	filters, err := store.GetWatchersFilters(chatId)
+	if err != nil {
+		return nil, storage.ChatIdle, err
+	}
+
+	return telegram.MakeResponseForWatcherFiltersSet(chatId, watcher, describeFilters(filters[watcher])), storage.ChatIdle, nil
+}
+
+func askFilter(chatId int, step int, intro string, ageRatings []string) interface{} {
+	switch filterSteps[step].filter {
+	case storage.FilterFormat:
+		return telegram.MakeResponseForFormatFilter(chatId, intro)
+	case storage.FilterAudio:
+		return telegram.MakeResponseForAudioFilter(chatId, intro)
+	case storage.FilterSubtitles:
+		return telegram.MakeResponseForSubtitlesFilter(chatId, intro)
+	default:
+		return telegram.MakeResponseForAgeRatingFilter(chatId, intro, ageRatings)
+	}
+}
+
+func labelsAsOptions(labels []string) map[string]string {
+	options := make(map[string]string)
+	for _, label := range labels {
+		options[label] = label
+	}
+
+	return options
+}
+
+// describeFilters returns a short, human readable, description of the watcher's filters.
+func describeFilters(f storage.WatcherFilters) string {
+	var parts []string
+
+	if len(f.Format) > 0 {
+		parts = append(parts, f.Format)
+	}
+
+	for _, s := range filterSteps {
+		for label, value := range s.options {
+			if (s.filter == storage.FilterAudio && value == f.Audio) || (s.filter == storage.FilterSubtitles && value == f.Subtitles) {
+				parts = append(parts, strings.ToLower(label))
+			}
+		}
+	}
+
+	if len(f.AgeRating) > 0 {
+		parts = append(parts, f.AgeRating)
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+// findCinemaByName returns the configured cinema having the given name, ignoring the case.
+func findCinemaByName(name string) (config.Cinema, bool) {
+	for _, cinema := range conf.Cinemas {
+		if strings.EqualFold(cinema.Name, name) {
+			return cinema, true
+		}
+	}
+
+	return config.Cinema{}, false
+}
+
+// findCinema returns the configured cinema having the given provider and id.
+func findCinema(provider string, id string) (config.Cinema, bool) {
+	for _, cinema := range conf.Cinemas {
+		if cinema.Provider == provider && cinema.Id == id {
+			return cinema, true
+		}
+	}
+
+	return config.Cinema{}, false
+}
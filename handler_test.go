@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/e10k/matheque/config"
+	"github.com/e10k/matheque/source"
+	"github.com/e10k/matheque/storage"
+	"github.com/e10k/matheque/telegram"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testChatId = 1
+	testUserId = 2
+)
+
+// exchange is a message sent to the bot, along with a fragment of the text expected in the response.
+type exchange struct {
+	text     string
+	expected string
+}
+
+func TestWebhookHandler(t *testing.T) {
+	tables := []struct {
+		name       string
+		exchanges  []exchange
+		watchers   []string
+		subscribed bool
+	}{
+		{"start", []exchange{
+			{"/start", "You are now subscribed"},
+		}, nil, true},
+		{"stop", []exchange{
+			{"/start", "You are now subscribed"},
+			{"/stop", "You are now unsubscribed"},
+		}, nil, false},
+		{"add", []exchange{
+			{"/start", "You are now subscribed"},
+			{"/add", "What's the film name?"},
+			{" Fight Club ", "Watcher added ✨\n\nWhich format"},
+			{"IMAX", "Original language or dubbed?"},
+			{"Any", "Subtitles?"},
+			{telegram.SubtitlesYesLabel, "All set ✨ You will be notified about films matching _Fight Club_ (IMAX · with subtitles)."},
+		}, []string{"Fight Club"}, true},
+		{"add, invalid filter", []exchange{
+			{"/add", "What's the film name?"},
+			{"Fight Club", "Which format"},
+			{"8K", "Please pick one of the options below.\n\nWhich format"},
+			{"/list", "✔︎ _Fight Club_\n"},
+		}, []string{"Fight Club"}, true},
+		{"add with exclusions", []exchange{
+			{"/add", "To skip the films having a word in their names"},
+			{`Batman -lego, "Tick, Tick... Boom!"`, "Watcher added ✨"},
+			{"/list", "✔︎ _Batman -lego, \"Tick, Tick... Boom!\"_\n"},
+		}, []string{`Batman -lego, "Tick, Tick... Boom!"`}, true},
+		{"add exclusions only", []exchange{
+			{"/add", "What's the film name?"},
+			{"-lego", "invalid or already existing watcher"},
+		}, nil, true},
+		{"add pattern", []exchange{
+			{"/add", "start with re:"},
+			{"re: ^Star Wars", "Watcher added ✨"},
+			{"/list", "✔︎ _re: ^Star Wars_\n"},
+		}, []string{"re: ^Star Wars"}, true},
+		{"add title starting like a pattern", []exchange{
+			{"/add", "What's the film name?"},
+			{"re: ^Star Wars", "Watcher added ✨"},
+			{"/add", "What's the film name?"},
+			{"re: Ghibli", "Watcher added ✨"},
+			{"/add", "What's the film name?"},
+			{"re: ^Dune", "Watcher added ✨"},
+			{"/add", "What's the film name?"},
+			{"Re:Zero", "Watcher added ✨"},
+			{"/list", "✔︎ _Re:Zero_\n"},
+		}, []string{"re: ^Dune", "re: ^Star Wars", "re: Ghibli", "Re:Zero"}, true},
+		{"add invalid pattern", []exchange{
+			{"/add", "What's the film name?"},
+			{"re: (Star Wars", "This pattern can't be used: missing closing ). 🧐"},
+		}, nil, true},
+		{"add too many patterns", []exchange{
+			{"/add", "What's the film name?"},
+			{"re: ^Star Wars", "Watcher added ✨"},
+			{"/add", "What's the film name?"},
+			{"re: Ghibli", "Watcher added ✨"},
+			{"/add", "What's the film name?"},
+			{"re: ^Dune", "Watcher added ✨"},
+			{"/add", "What's the film name?"},
+			{"re: Miyazaki", "You can have up to 3 pattern watchers. 🧐"},
+		}, []string{"re: ^Dune", "re: ^Star Wars", "re: Ghibli"}, true},
+		{"add existing", []exchange{
+			{"/add", "What's the film name?"},
+			{"Fight Club", "Watcher added ✨"},
+			{"/add", "What's the film name?"},
+			{"fight club", "already existing watcher"},
+		}, []string{"Fight Club"}, true},
+		{"list", []exchange{
+			{"/list", "You have no watchers"},
+			{"/add", "What's the film name?"},
+			{"Fight Club", "Watcher added ✨"},
+			{"/add", "What's the film name?"},
+			{"Avatar", "Watcher added ✨"},
+			{"/list", "These are your watchers:\n\n✔︎ _Avatar_\n✔︎ _Fight Club_\n"},
+		}, []string{"Avatar", "Fight Club"}, true},
+		{"remove", []exchange{
+			{"/add", "What's the film name?"},
+			{"Fight Club", "Watcher added ✨"},
+			{"/remove", "Which watcher do you want to remove?"},
+			{"Fight Club", "Watcher removed 🗑."},
+			{"/list", "You have no watchers"},
+		}, nil, true},
+		{"remove unknown", []exchange{
+			{"/remove", "You have no watchers"},
+			{"Fight Club", "Couldn't find a watcher named like that."},
+		}, nil, true},
+		{"matching", []exchange{
+			{"/add", "What's the film name?"},
+			{"Avatr", "Which format"},
+			{"/matching", "Which watcher do you want to change the matching of?"},
+			{"avatr", "How closely should the films' names match _Avatr_? It's currently set to _Anywhere in the name_."},
+			{"Loosely", "Please pick one of the options below."},
+			{telegram.StrictnessFuzzyLabel, "_Avatr_ is now matched by: _Allow typos_."},
+			{"/list", "✔︎ _Avatr_ (allow typos)\n"},
+		}, []string{"Avatr"}, true},
+		{"matching unknown", []exchange{
+			{"/matching", "You have no watchers"},
+			{"Avatr", "Couldn't find a watcher named like that."},
+		}, nil, true},
+		{"unknown", []exchange{
+			{"Fight Club", "Sorry, I didn't understand that."},
+		}, nil, true},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			s := setupTest(t)
+
+			for i, e := range table.exchanges {
+				response := postMessage(t, i+1, e.text)
+
+				if response.ChatId != testChatId || !strings.Contains(response.Text, e.expected) {
+					t.Errorf("Expected a response to %q containing %q, got %+v", e.text, e.expected, response)
+				}
+			}
+
+			watchers, err := store.GetWatchers(testChatId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(watchers) != fmt.Sprint(table.watchers) {
+				t.Errorf("Expected watchers %v, got %v", table.watchers, watchers)
+			}
+
+			if s.IsSubscribed(testChatId, testUserId) != table.subscribed {
+				t.Errorf("Expected the chat to be subscribed: %v", table.subscribed)
+			}
+
+			status, err := store.GetChatStatus(testChatId, testUserId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != storage.ChatIdle {
+				t.Errorf("Expected the chat to be idle once done, got status %d", status)
+			}
+		})
+	}
+}
+
+// flakyStore fails setting the pending watcher as many times as given, and counts the messages stored,
+// on top of the memory store.
+type flakyStore struct {
+	storage.Store
+	failures int
+	messages int64
+}
+
+func (s *flakyStore) SetPendingWatcher(chatId int, userId int, keywords string) (int64, error) {
+	if s.failures > 0 {
+		s.failures--
+		return 0, errors.New("database is locked")
+	}
+
+	return s.Store.SetPendingWatcher(chatId, userId, keywords)
+}
+
+func (s *flakyStore) InsertMessage(m *storage.Message) (int64, error) {
+	rowsAffected, err := s.Store.InsertMessage(m)
+	s.messages += rowsAffected
+
+	return rowsAffected, err
+}
+
+func TestWebhookHandlerRedeliveredUpdate(t *testing.T) {
+	s := setupTest(t)
+	flaky := &flakyStore{Store: s, failures: 1}
+	store = flaky
+
+	postMessage(t, 1, "/start")
+	postMessage(t, 2, "/add")
+
+	// the update fails halfway, so Telegram delivers it again
+	update := testUpdate(3, "Dune")
+	recorder := postUpdate(t, update)
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d", recorder.Code)
+	}
+
+	recorder = postUpdate(t, update)
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "Watcher added") {
+		t.Errorf("Expected the watcher to be added, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	// once handled, the update is skipped
+	recorder = postUpdate(t, update)
+	if recorder.Code != http.StatusOK || recorder.Body.Len() != 0 {
+		t.Errorf("Expected an empty response, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	watchers, err := s.GetWatchers(testChatId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(watchers) != "[Dune]" {
+		t.Errorf("Expected watchers [Dune], got %v", watchers)
+	}
+
+	if flaky.messages != 3 {
+		t.Errorf("Expected 3 messages stored, got %d", flaky.messages)
+	}
+
+	status, err := s.GetChatStatus(testChatId, testUserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != storage.ChatWaitingForFormatFilter {
+		t.Errorf("Expected the chat to wait for the format filter, got status %d", status)
+	}
+}
+
+// setupTestCinemas configures two Romanian cinemas and a Hungarian one, each country having its own provider.
+func setupTestCinemas() {
+	providers["fake.ro"] = &fakeProvider{}
+	providers["fake.hu"] = &fakeProvider{country: "hu"}
+	conf.Cinemas = []config.Cinema{
+		{Provider: "fake.ro", Id: "1", Name: "Cotroceni"},
+		{Provider: "fake.ro", Id: "2", Name: "Cluj"},
+		{Provider: "fake.hu", Id: "1", Name: "Budapest"},
+	}
+}
+
+func TestCinemasCommand(t *testing.T) {
+	s := setupTest(t)
+	setupTestCinemas()
+
+	steps := []struct {
+		text     string
+		expected string
+		keyboard string
+	}{
+		{"/cinemas", "You are following all the cinemas.", "[[Cotroceni] [Cluj] [Budapest]]"},
+		{"cluj", "You will get notifications for films playing at _Cluj_.", "[]"},
+		{"/cinemas", "You are following the cinemas marked with ✅.", "[[Cotroceni] [✅ Cluj] [Budapest]]"},
+		{"Budapest", "You will get notifications for films playing at _Budapest_.", "[]"},
+		{"/cinemas", "You are following the cinemas marked with ✅.", "[[Cotroceni] [✅ Cluj] [✅ Budapest]]"},
+		{"✅ Cluj", "_Cluj_ was removed from your selection.", "[]"},
+		{"/cinemas", "You are following the cinemas marked with ✅.", "[[Cotroceni] [Cluj] [✅ Budapest]]"},
+		{"Mall", "Couldn't find a cinema named like that.", "[]"},
+	}
+
+	for i, step := range steps {
+		response := postMessage(t, i+1, step.text)
+
+		if !strings.Contains(response.Text, step.expected) || fmt.Sprint(response.ReplyMarkup.Keyboard) != step.keyboard {
+			t.Errorf("Expected a response to %q containing %q with keyboard %s, got %q with keyboard %v",
+				step.text, step.expected, step.keyboard, response.Text, response.ReplyMarkup.Keyboard)
+		}
+	}
+
+	cinemas, err := s.GetChatCinemas(testChatId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(cinemas) != "[{fake.hu 1}]" {
+		t.Errorf("Expected the chat to follow Budapest only, got %v", cinemas)
+	}
+}
+
+func TestCountryCommand(t *testing.T) {
+	s := setupTest(t)
+	setupTestCinemas()
+
+	steps := []struct {
+		text     string
+		expected string
+		keyboard string
+	}{
+		{"/country", "You are getting notifications for: _🌍 All countries_.", "[[🌍 All countries] [🇭🇺 Hungary] [🇷🇴 Romania]]"},
+		{"🇭🇺 Hungary", "You will get notifications for: _🇭🇺 Hungary_.", "[]"},
+		// only the cinemas of the country are listed
+		{"/cinemas", "You are following all the cinemas.", "[[Budapest]]"},
+		{"/country", "You are getting notifications for: _🇭🇺 Hungary_.", "[[🌍 All countries] [🇭🇺 Hungary] [🇷🇴 Romania]]"},
+		{"ro", "You will get notifications for: _🇷🇴 Romania_.", "[]"},
+		{"/cinemas", "You are following all the cinemas.", "[[Cotroceni] [Cluj]]"},
+		{"/country", "Which country do you want notifications for?", "[[🌍 All countries] [🇭🇺 Hungary] [🇷🇴 Romania]]"},
+		{"🇵🇱 Poland", "Sorry, there are no cinemas available for that country.", "[]"},
+		{"/country", "You are getting notifications for: _🇷🇴 Romania_.", "[[🌍 All countries] [🇭🇺 Hungary] [🇷🇴 Romania]]"},
+		{"🌍 All countries", "You will get notifications for: _🌍 All countries_.", "[]"},
+		{"/cinemas", "You are following all the cinemas.", "[[Cotroceni] [Cluj] [Budapest]]"},
+	}
+
+	for i, step := range steps {
+		response := postMessage(t, i+1, step.text)
+
+		if !strings.Contains(response.Text, step.expected) || fmt.Sprint(response.ReplyMarkup.Keyboard) != step.keyboard {
+			t.Errorf("Expected a response to %q containing %q with keyboard %s, got %q with keyboard %v",
+				step.text, step.expected, step.keyboard, response.Text, response.ReplyMarkup.Keyboard)
+		}
+	}
+
+	country, err := s.GetChatCountry(testChatId, testUserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if country != "" {
+		t.Errorf("Expected no country, got %q", country)
+	}
+}
+
+func TestWebhookHandlerIgnoresOtherMethods(t *testing.T) {
+	setupTest(t)
+
+	recorder := httptest.NewRecorder()
+	webhookHandler(recorder, httptest.NewRequest(http.MethodGet, "/webhook", nil))
+
+	if recorder.Code != http.StatusOK || recorder.Body.Len() != 0 {
+		t.Errorf("Expected an empty response, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+// setupTest replaces the config and the store with empty ones, for the duration of the test.
+func setupTest(t *testing.T) *storage.MemoryStore {
+	s := storage.NewMemoryStore()
+
+	previousConf, previousStore, previousProviders := conf, store, providers
+	t.Cleanup(func() {
+		conf, store, providers = previousConf, previousStore, previousProviders
+	})
+
+	conf = &config.Conf{}
+	store = s
+	providers = make(map[string]source.Provider)
+
+	return s
+}
+
+// testResponse holds the fields shared by the methods returned in response to the messages.
+type testResponse struct {
+	Method      string `json:"method"`
+	ChatId      int    `json:"chat_id"`
+	Text        string `json:"text"`
+	ReplyMarkup struct {
+		Keyboard [][]string `json:"keyboard"`
+	} `json:"reply_markup"`
+}
+
+// testUpdate returns the update of a message sent to the bot in the test chat; the update has the id of the message.
+func testUpdate(messageId int, text string) telegram.WebhookUpdate {
+	return telegram.WebhookUpdate{
+		UpdateId: messageId,
+		Message: &telegram.WebhookUpdateMessage{
+			MessageId: messageId,
+			From:      telegram.WebhookUpdateMessageFrom{Id: testUserId, FirstName: "Tyler"},
+			Chat:      telegram.WebhookUpdateMessageChat{Id: testChatId, FirstName: "Tyler", Type: "private"},
+			Text:      text,
+		},
+	}
+}
+
+// postUpdate sends the update to the webhook handler, as Telegram would, and returns the handler's response.
+func postUpdate(t *testing.T, u telegram.WebhookUpdate) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	webhookHandler(recorder, httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body)))
+
+	return recorder
+}
+
+// postMessage sends the message to the webhook handler, as Telegram would, and returns the method it responds with.
+func postMessage(t *testing.T, messageId int, text string) testResponse {
+	t.Helper()
+
+	recorder := postUpdate(t, testUpdate(messageId, text))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for %q, got %d", text, recorder.Code)
+	}
+
+	var response testResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("Expected a JSON response to %q, got %q", text, recorder.Body.String())
+	}
+
+	if response.Method != "sendMessage" {
+		t.Errorf("Expected a message in response to %q, got %q", text, response.Method)
+	}
+
+	return response
+}
+
+// setupTestClient replaces the Telegram client with one calling a fake Bot API, for the duration of the test;
+// it returns the texts the callback queries are answered with.
+func setupTestClient(t *testing.T) *[]string {
+	var answers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var answer telegram.MethodAnswerCallbackQuery
+		err := json.NewDecoder(r.Body).Decode(&answer)
+		if err != nil {
+			t.Errorf("Expected a JSON request, got %v", err)
+		}
+		answers = append(answers, answer.Text)
+
+		fmt.Fprint(w, `{"ok":true,"result":true}`)
+	}))
+	t.Cleanup(server.Close)
+
+	previousClient := client
+	t.Cleanup(func() {
+		client = previousClient
+	})
+
+	client = telegram.NewClient(telegram.BotConfig{ApiUrl: server.URL + "/"})
+
+	return &answers
+}
+
+func TestHandleCallbackQuery(t *testing.T) {
+	s := setupTest(t)
+	answers := setupTestClient(t)
+
+	_, err := s.InsertWatcher(testChatId, "Dune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	watchers, err := s.GetWatcherList(testChatId)
+	if err != nil || len(watchers) != 1 {
+		t.Fatalf("Expected the watcher, got %+v and %v", watchers, err)
+	}
+
+	film := storage.Film{Provider: "cc", Id: "1", CinemaId: "10", Name: "Dune", OriginalName: "Dune", Link: "l"}
+	_, err = s.InsertFilm(&film)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upcoming := storage.Film{Provider: "cc", Id: "2", CinemaId: "10", Name: "Arrival", OriginalName: "Arrival", Link: "l2"}
+	_, err = s.InsertUpcomingFilm(&upcoming)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		data   string
+		notice string
+		// method edits the message the button is attached to, if any; expected is a fragment of the method
+		method   string
+		expected string
+	}{
+		{telegram.MakeCallbackData(telegram.CallbackDeleteWatcher, watchers[0].Id), "Watcher removed 🗑", "editMessageText", "You have no watchers"},
+		{telegram.MakeCallbackData(telegram.CallbackDeleteWatcher, watchers[0].Id), "This watcher was already removed.", "editMessageText", "You have no watchers"},
+		{telegram.MakeCallbackData(telegram.CallbackMuteFilm, film.RowId), "You won't be notified about this film anymore 🔇", "editMessageReplyMarkup",
+			fmt.Sprintf(`"unmute:%d"`, film.RowId)},
+		{telegram.MakeCallbackData(telegram.CallbackUnmuteFilm, film.RowId), "You will be notified about this film again 🔔", "editMessageReplyMarkup",
+			fmt.Sprintf(`"mute:%d"`, film.RowId)},
+		{telegram.MakeCallbackData(telegram.CallbackMoreShowtimes, film.RowId), "", "editMessageCaption", "There are no upcoming screenings."},
+		{telegram.MakeCallbackData(telegram.CallbackMuteUpcomingFilm, upcoming.RowId), "You won't be notified about this film anymore 🔇", "editMessageReplyMarkup",
+			fmt.Sprintf(`"uunmute:%d"`, upcoming.RowId)},
+		{telegram.MakeCallbackData(telegram.CallbackMoreUpcomingShowtimes, upcoming.RowId), "", "editMessageCaption", "[Arrival](l2)"},
+		{telegram.MakeCallbackData(telegram.CallbackMuteFilm, 999), "This film is no longer available.", "", ""},
+		{telegram.MakeCallbackData(telegram.CallbackMoreUpcomingShowtimes, 999), "This film is no longer available.", "", ""},
+		{"more", "", "", ""},
+		{"mute:x", "", "", ""},
+		{"bogus:1", "", "", ""},
+	}
+
+	for i, step := range steps {
+		keyboard := telegram.NewNotificationKeyboard(film.RowId, "l")
+		if action, _, _ := telegram.ParseCallbackData(step.data); telegram.IsUpcomingFilmCallback(action) {
+			keyboard = telegram.NewAnnouncementKeyboard(upcoming.RowId, "l2")
+		}
+
+		recorder := postUpdate(t, telegram.WebhookUpdate{
+			UpdateId: i + 1,
+			CallbackQuery: &telegram.CallbackQuery{
+				Id:   fmt.Sprint(i + 1),
+				From: telegram.WebhookUpdateMessageFrom{Id: testUserId, FirstName: "Tyler"},
+				Message: &telegram.WebhookUpdateMessage{
+					MessageId:   100,
+					Chat:        telegram.WebhookUpdateMessageChat{Id: testChatId, FirstName: "Tyler", Type: "private"},
+					Caption:     "🎉 Tickets for a film matching one of your watchers are now on sale",
+					ReplyMarkup: &keyboard,
+				},
+				Data: step.data,
+			},
+		})
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %q, got %d", step.data, recorder.Code)
+		}
+
+		var response testResponse
+		if recorder.Body.Len() > 0 {
+			err = json.Unmarshal(recorder.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatalf("Expected a JSON response to %q, got %q", step.data, recorder.Body.String())
+			}
+		}
+
+		if response.Method != step.method || !strings.Contains(recorder.Body.String(), step.expected) {
+			t.Errorf("Expected %q to be answered by %s with %q, got %q", step.data, step.method, step.expected, recorder.Body.String())
+		}
+
+		if len(*answers) != i+1 || (*answers)[i] != step.notice {
+			t.Errorf("Expected %q to be acknowledged with %q, got %q", step.data, step.notice, *answers)
+		}
+	}
+}
@@ -1,307 +1,766 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/e10k/matheque/cinemacity"
+	_ "github.com/e10k/matheque/cinemacity"
 	"github.com/e10k/matheque/config"
+	"github.com/e10k/matheque/source"
 	"github.com/e10k/matheque/storage"
 	"github.com/e10k/matheque/telegram"
 	_ "github.com/mattn/go-sqlite3"
-	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
-	"strings"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
 	"time"
 )
 
-// backgroundTask checks Cinemacity for new movies at a varying interval;
+// backgroundTask checks the configured cinemas for new movies at a varying interval;
 // whenever a new movie is found, it is added to the database and, if it matches any existing watchers,
-// it sends notifications to the relevant users.
-func backgroundTask() {
-	fetchMoviesAndSendUpdates()
+// it queues notifications for the relevant users. It returns once the context is done, abandoning the requests being made.
+func backgroundTask(ctx context.Context) {
+	fetchMoviesAndSendUpdates(ctx)
 
 	intervalMin, intervalMax := 5*60, 10*60+1
 	ticker := time.NewTicker(time.Duration(intervalMin) * time.Second)
-	for range ticker.C {
-		fetchMoviesAndSendUpdates()
+	defer ticker.Stop()
 
-		// vary the ticker duration
-		ticker.Reset(time.Duration(intervalMin+rand.Intn(intervalMax)) * time.Second)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fetchMoviesAndSendUpdates(ctx)
+
+			// vary the ticker duration
+			ticker.Reset(time.Duration(intervalMin+rand.Intn(intervalMax)) * time.Second)
+		}
+	}
+}
+
+func fetchMoviesAndSendUpdates(ctx context.Context) {
+	// localized names already determined during this run, keyed by provider and film id
+	localNames := make(map[string]string)
+
+	for _, cinema := range conf.Cinemas {
+		if ctx.Err() != nil {
+			return
+		}
+
+		err := fetchCinemaMoviesAndSendUpdates(ctx, providers[cinema.Provider], cinema, localNames)
+		if err != nil && ctx.Err() == nil {
+			// the cinema will be checked again on the next run
+			log.Printf("checking cinema %s: %v", cinema.Name, err)
+		}
 	}
 }
 
-func fetchMoviesAndSendUpdates() {
-	log.Print("Fetching movies...")
+func fetchCinemaMoviesAndSendUpdates(ctx context.Context, provider source.Provider, cinema config.Cinema, localNames map[string]string) error {
+	log.Printf("Fetching movies for cinema %s...", cinema.Name)
 
-	films, err := cinemacity.GetFilms()
+	films, err := provider.GetFilms(ctx, cinema.Id)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("fetching films: %v", err)
 	}
 
 	log.Printf("%d movies found", len(films))
 
+	newEvents, filmsWithNewEvents, err := fetchEvents(ctx, provider, cinema)
+	if err != nil {
+		// the films are checked anyway, their screenings will be fetched on the next run
+		log.Printf("fetching screenings at %s: %v", cinema.Name, err)
+	}
+
 	for _, film := range films {
-		exists, err := storage.FilmExists(conf, film.Id)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		scraped, err := processFilm(ctx, provider, cinema, film, localNames, filmsWithNewEvents[film.Id])
 		if err != nil {
-			log.Fatal(err)
+			// the film will be processed again on the next run
+			log.Printf("processing movie %s at %s: %v", film.Name, cinema.Name, err)
 		}
 
-		if exists {
-			continue
+		if scraped {
+			// be respectful to the server, in case multiple new movies have been found;
+			// determining the movies' localized names may require making a http request for each
+			sleep(ctx, time.Duration(rand.Intn(5))*time.Second)
 		}
+	}
 
-		romanianName, err := cinemacity.GetRomanianName(film.Link)
+	for filmId, events := range newEvents {
+		err = sendNewScreeningsUpdates(provider, cinema, filmId, events)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("sending new screenings of movie %s at %s: %v", filmId, cinema.Name, err)
+		}
+	}
+
+	err = fetchCinemaUpcomingMoviesAndSendUpdates(ctx, provider, cinema, localNames)
+	if err != nil {
+		return fmt.Errorf("fetching upcoming films: %v", err)
+	}
+
+	return nil
+}
+
+// processFilm stores the film, if it's new, and notifies the chats watching for it; the film is stored before notifying the chats,
+// but it's only marked as notified afterwards, so the notifications are sent on the next run if something fails meanwhile.
+// The watchers filtering the screenings are checked again whenever screenings are added for a film already notified,
+// since the screenings they wait for may not have been scheduled yet.
+// It also reports whether the provider had to be asked for the film's localized name.
+func processFilm(ctx context.Context, provider source.Provider, cinema config.Cinema, film source.Film, localNames map[string]string, eventsAdded bool) (bool, error) {
+	stored, err := store.GetFilm(provider.Name(), film.Id, cinema.Id)
+	if err != nil {
+		return false, err
+	}
+
+	recheck := stored != nil && stored.Notified
+	if recheck && !eventsAdded {
+		return false, nil
+	}
+
+	localName, scraped, err := getLocalName(ctx, provider, film, localNames)
+	if err != nil {
+		return false, err
+	}
+
+	if stored == nil {
+		stored = &storage.Film{
+			Provider:     provider.Name(),
+			Id:           film.Id,
+			CinemaId:     cinema.Id,
+			Name:         localName,
+			OriginalName: film.Name,
+			Link:         film.Link,
+			PosterLink:   film.PosterLink,
+			ReleaseDate:  film.ReleaseDate,
+			FilmDetails:  storage.FilmDetails(film.Details),
+		}
+
+		_, err = store.InsertFilm(stored)
+		if err != nil {
+			return scraped, err
+		}
+
+		log.Printf("new movie at %s: %s (%s)", cinema.Name, film.Name, localName)
+	}
+
+	events, err := store.GetUpcomingEvents(provider.Name(), film.Id, cinema.Id, time.Now().Format(source.DateTimeLayout), -1)
+	if err != nil {
+		return scraped, err
+	}
+
+	watcherMatches, err := store.GetWatchersMatchingQuery(storage.MatchQuery{
+		Provider:     provider.Name(),
+		FilmId:       film.Id,
+		CinemaId:     cinema.Id,
+		Country:      provider.CountryCode(),
+		Names:        []string{film.Name, localName},
+		AgeRating:    film.AgeRating,
+		Events:       events,
+		FilteredOnly: recheck,
+	})
+	if err != nil {
+		return scraped, err
+	}
+
+	screenings := makeScreenings(events, screeningsPerNotification)
+
+	about := storage.NotifiedFilm{
+		Provider: provider.Name(),
+		FilmId:   film.Id,
+		CinemaId: cinema.Id,
+		FilmName: film.Name,
+		FilmLink: film.Link,
+		Reason:   storage.ReasonOnSale,
+	}
+
+	for _, m := range watcherMatches {
+		log.Printf("notify %d for movie %s, matching %q (score %.2f)\n", m.ChatId, film.Name, m.Term, m.Score)
+
+		err = queueNotification(m, telegram.NewNotification(m.ChatId, stored.RowId, film.Name, film.Link, film.PosterLink, cinema.Name, telegram.FilmDetails(film.Details), screenings, describeMatch(m)), about)
+		if err != nil {
+			return scraped, err
+		}
+	}
+
+	if recheck {
+		return scraped, nil
+	}
+
+	_, err = store.SetFilmNotified(stored.RowId)
+
+	return scraped, err
+}
+
+// fetchCinemaUpcomingMoviesAndSendUpdates checks the cinema's coming soon films; whenever a new one is found,
+// it is stored and the chats that opted in for announcements are notified about it.
+func fetchCinemaUpcomingMoviesAndSendUpdates(ctx context.Context, provider source.Provider, cinema config.Cinema, localNames map[string]string) error {
+	films, err := provider.GetComingSoon(ctx, cinema.Id)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%d upcoming movies found", len(films))
+
+	for _, film := range films {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		scraped, err := processUpcomingFilm(ctx, provider, cinema, film, localNames)
+		if err != nil {
+			// the film will be processed again on the next run
+			log.Printf("processing upcoming movie %s at %s: %v", film.Name, cinema.Name, err)
 		}
 
-		_, err = storage.InsertFilm(conf, &storage.Film{
+		if scraped {
+			// be respectful to the server, see above
+			sleep(ctx, time.Duration(rand.Intn(5))*time.Second)
+		}
+	}
+
+	return nil
+}
+
+// processUpcomingFilm is like processFilm, but for the films announced as coming soon.
+func processUpcomingFilm(ctx context.Context, provider source.Provider, cinema config.Cinema, film source.Film, localNames map[string]string) (bool, error) {
+	stored, err := store.GetUpcomingFilm(provider.Name(), film.Id, cinema.Id)
+	if err != nil {
+		return false, err
+	}
+
+	if stored != nil && stored.Notified {
+		return false, nil
+	}
+
+	// there's no point in announcing films that are already available for booking
+	onSale, err := store.FilmExists(provider.Name(), film.Id, cinema.Id)
+	if err != nil {
+		return false, err
+	}
+
+	localName, scraped, err := getLocalName(ctx, provider, film, localNames)
+	if err != nil {
+		return false, err
+	}
+
+	if stored == nil {
+		stored = &storage.Film{
+			Provider:     provider.Name(),
 			Id:           film.Id,
-			Name:         romanianName,
+			CinemaId:     cinema.Id,
+			Name:         localName,
 			OriginalName: film.Name,
 			Link:         film.Link,
 			PosterLink:   film.PosterLink,
+			ReleaseDate:  film.ReleaseDate,
+		}
+
+		_, err = store.InsertUpcomingFilm(stored)
+		if err != nil {
+			return scraped, err
+		}
+	}
+
+	if !onSale {
+		log.Printf("new upcoming movie at %s: %s (%s)", cinema.Name, film.Name, localName)
+
+		watcherMatches, err := store.GetAnnouncementWatchersMatchingQuery(storage.MatchQuery{
+			Provider:  provider.Name(),
+			FilmId:    film.Id,
+			CinemaId:  cinema.Id,
+			Country:   provider.CountryCode(),
+			Names:     []string{film.Name, localName},
+			AgeRating: film.AgeRating,
 		})
+		if err != nil {
+			return scraped, err
+		}
+
+		about := storage.NotifiedFilm{
+			Provider: provider.Name(),
+			FilmId:   film.Id,
+			CinemaId: cinema.Id,
+			FilmName: film.Name,
+			FilmLink: film.Link,
+			Reason:   storage.ReasonAnnouncement,
+		}
+
+		for _, m := range watcherMatches {
+			log.Printf("notify %d about upcoming movie %s, matching %q (score %.2f)\n", m.ChatId, film.Name, m.Term, m.Score)
+
+			err = queueNotification(m, telegram.NewAnnouncementNotification(m.ChatId, stored.RowId, film.Name, film.Link, film.PosterLink, cinema.Name, formatReleaseDate(film.ReleaseDate), describeMatch(m)), about)
+			if err != nil {
+				return scraped, err
+			}
+		}
+	}
+
+	_, err = store.SetUpcomingFilmNotified(stored.RowId)
+
+	return scraped, err
+}
+
+// describeMatch returns the reason for notifying a chat, as told in the notification.
+func describeMatch(m storage.WatcherMatch) telegram.WatcherMatch {
+	return telegram.WatcherMatch{Keywords: m.Keywords, Term: m.Term, Approximate: m.Score < 1}
+}
+
+func formatReleaseDate(date string) string {
+	t, err := time.Parse(source.DateLayout, date)
+	if err != nil {
+		return date
+	}
+
+	return t.Format("02 Jan 2006")
+}
+
+// sendNewScreeningsUpdates notifies the opted in watchers about screenings added for an already announced film.
+func sendNewScreeningsUpdates(provider source.Provider, cinema config.Cinema, filmId string, events []storage.Event) error {
+	film, err := store.GetFilm(provider.Name(), filmId, cinema.Id)
+	if err != nil {
+		return err
+	}
+
+	if film == nil {
+		return nil
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].DateTime < events[j].DateTime
+	})
+
+	now := time.Now().Format(source.DateTimeLayout)
+
+	var upcomingEvents []storage.Event
+	for _, event := range events {
+		if event.DateTime > now {
+			upcomingEvents = append(upcomingEvents, event)
+		}
+	}
+
+	if len(upcomingEvents) == 0 {
+		return nil
+	}
+
+	log.Printf("%d new screenings at %s for movie %s", len(upcomingEvents), cinema.Name, film.OriginalName)
+
+	watcherMatches, err := store.GetNewScreeningsWatchersMatchingQuery(storage.MatchQuery{
+		Provider:  provider.Name(),
+		FilmId:    filmId,
+		CinemaId:  cinema.Id,
+		Country:   provider.CountryCode(),
+		Names:     []string{film.OriginalName, film.Name},
+		AgeRating: film.AgeRating,
+		Events:    upcomingEvents,
+	})
+	if err != nil {
+		return err
+	}
+
+	screenings := makeScreenings(upcomingEvents, screeningsPerUpdate)
+	more := len(upcomingEvents) - len(screenings)
+
+	about := storage.NotifiedFilm{
+		Provider: provider.Name(),
+		FilmId:   film.Id,
+		CinemaId: cinema.Id,
+		FilmName: film.OriginalName,
+		FilmLink: film.Link,
+		Reason:   storage.ReasonNewScreenings(upcomingEvents),
+	}
 
+	for _, m := range watcherMatches {
+		log.Printf("notify %d about new screenings for movie %s, matching %q (score %.2f)\n", m.ChatId, film.OriginalName, m.Term, m.Score)
+
+		err = queueNotification(m, telegram.NewScreeningsNotification(m.ChatId, film.RowId, film.OriginalName, film.Link, cinema.Name, screenings, more, describeMatch(m)), about)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+	}
+
+	return nil
+}
+
+// fetchEvents stores the screenings scheduled at the cinema during the following `eventsLookaheadDays` days.
+// It returns the newly found screenings of the films whose screenings were already being tracked, grouped by film id;
+// only the screenings on the days fetched before are new, since each day brought in by the rolling lookahead
+// comes with screenings that were scheduled long ago. It also returns the ids of all the films having screenings stored
+// for the first time, whichever the day.
+func fetchEvents(ctx context.Context, provider source.Provider, cinema config.Cinema) (map[string][]storage.Event, map[string]bool, error) {
+	trackedFilms, err := store.GetFilmsWithEvents(provider.Name(), cinema.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	horizon, err := store.GetEventsHorizon(provider.Name(), cinema.Id)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		log.Printf("new movie: %s (%s)", film.Name, romanianName)
+	until := time.Now().AddDate(0, 0, eventsLookaheadDays)
 
-		watcherMatches, err := storage.GetWatchersMatchingQuery(conf, film.Name, romanianName)
+	// nothing is stored unless every day was fetched, since the screenings stored wouldn't be new next time
+	events, err := provider.GetEvents(ctx, cinema.Id, until)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	newEvents := make(map[string][]storage.Event)
+	filmsWithNewEvents := make(map[string]bool)
+
+	for _, event := range events {
+		e := storage.Event{
+			Provider:          provider.Name(),
+			Id:                event.Id,
+			FilmId:            event.FilmId,
+			CinemaId:          cinema.Id,
+			BusinessDay:       event.BusinessDay,
+			DateTime:          event.DateTime,
+			BookingLink:       event.BookingLink,
+			Auditorium:        event.Auditorium,
+			Formats:           event.Formats,
+			DubbedLanguages:   event.DubbedLanguages,
+			SubtitleLanguages: event.SubtitleLanguages,
+		}
+
+		rowsAffected, err := store.InsertEvent(&e)
 		if err != nil {
-			log.Fatal(err)
+			return nil, nil, err
 		}
 
-		for _, chatId := range watcherMatches {
-			log.Printf("notify %d for movie %s\n", chatId, film.Name)
+		if rowsAffected == 0 {
+			continue
+		}
+		filmsWithNewEvents[e.FilmId] = true
 
-			sendNotification(telegram.NewNotification(chatId, film.Name, film.Link, film.PosterLink))
+		if trackedFilms[e.FilmId] && eventDay(e) <= horizon {
+			newEvents[e.FilmId] = append(newEvents[e.FilmId], e)
 		}
+	}
+
+	log.Printf("%d screenings found", len(events))
 
-		// be respectful to the server, in case multiple new movies have been found;
-		// determining the movies' romanian names requires making a http request for each
-		time.Sleep(time.Duration(rand.Intn(5)) * time.Second)
+	if day := until.Format(source.DateLayout); day > horizon {
+		_, err = store.SetEventsHorizon(provider.Name(), cinema.Id, day)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
+
+	return newEvents, filmsWithNewEvents, nil
 }
 
+// eventDay returns the day the event belongs to, formatted like `source.DateLayout`.
+func eventDay(e storage.Event) string {
+	if len(e.BusinessDay) >= len(source.DateLayout) {
+		return e.BusinessDay[:len(source.DateLayout)]
+	}
+
+	if len(e.DateTime) >= len(source.DateLayout) {
+		return e.DateTime[:len(source.DateLayout)]
+	}
+
+	return e.DateTime
+}
+
+// makeScreenings turns the first `limit` events into screenings, ready to be included in notifications.
+func makeScreenings(events []storage.Event, limit int) []telegram.Screening {
+	var screenings []telegram.Screening
+
+	for i, event := range events {
+		if i == limit {
+			break
+		}
+
+		screenings = append(screenings, makeScreening(event))
+	}
+
+	return screenings
+}
+
+func makeScreening(event storage.Event) telegram.Screening {
+	displayTime := event.DateTime
+	t, err := time.Parse(source.DateTimeLayout, event.DateTime)
+	if err == nil {
+		displayTime = t.Format("Mon 02 Jan, 15:04")
+	}
+
+	return telegram.Screening{
+		Time:        displayTime,
+		BookingLink: event.BookingLink,
+		Auditorium:  event.Auditorium,
+	}
+}
+
+// getLocalName returns the film's localized name, looking it up in the cache and in the database
+// before asking the provider; it also reports whether the provider had to be asked.
+func getLocalName(ctx context.Context, provider source.Provider, film source.Film, cache map[string]string) (string, bool, error) {
+	key := provider.Name() + "/" + film.Id
+
+	if name, ok := cache[key]; ok {
+		return name, false, nil
+	}
+
+	name, err := store.GetFilmName(provider.Name(), film.Id)
+	if err != nil {
+		return "", false, err
+	}
+
+	scraped := false
+	if len(name) == 0 {
+		name, err = provider.GetLocalName(ctx, film)
+		if err != nil {
+			return "", false, err
+		}
+		scraped = len(film.LocalName) == 0
+	}
+
+	cache[key] = name
+
+	return name, scraped, nil
+}
+
+const (
+	// eventsLookaheadDays is how many days ahead screenings are fetched for
+	eventsLookaheadDays = 7
+	// screeningsPerNotification is how many screenings are listed in a notification
+	screeningsPerNotification = 3
+	// screeningsPerUpdate is how many screenings are listed in a notification about new screenings
+	screeningsPerUpdate = 10
+	// shutdownTimeout is how long to wait for the updates being handled when shutting down
+	shutdownTimeout = 10 * time.Second
+)
+
 var botConfig telegram.BotConfig
+var client *telegram.Client
 var conf *config.Conf
+var store storage.Store
+
+// providers holds the providers enabled in the config, keyed by name
+var providers map[string]source.Provider
 
 func init() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
+}
+
+// setup reads the config, opens the database and sets up the providers and the Telegram client;
+// it isn't done by `init`, so that the tests can set up their own.
+func setup() {
+	conf = config.NewConfig()
+
+	var err error
+	store, err = openStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	providerClient := newProviderClient()
+
+	providers = make(map[string]source.Provider)
+	for _, name := range conf.Providers {
+		provider, err := source.Get(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if p, ok := provider.(source.HTTPProvider); ok && providerClient != nil {
+			provider = p.WithClient(providerClient)
+		}
 
-	conf = config.NewConfig(storage.GetDB())
+		providers[name] = provider
+	}
 
 	botConfig = telegram.NewBotConfig(
 		conf.TelegramBotToken,
 		conf.URL+"/webhook",
 	)
+	client = telegram.NewClient(botConfig)
+}
+
+// newProviderClient returns the client the providers make their requests with, as set by the source mode;
+// it returns nil in live mode, leaving the providers' own client in place.
+func newProviderClient() *http.Client {
+	switch conf.SourceMode {
+	case config.SourceRecord:
+		log.Printf("recording the providers' responses to %s", conf.FixturesPath)
+		return &http.Client{Transport: source.Recorder{Dir: conf.FixturesPath, Transport: http.DefaultTransport}}
+	case config.SourceReplay:
+		log.Printf("replaying the providers' responses from %s", conf.FixturesPath)
+		return &http.Client{Transport: source.Replayer{Dir: conf.FixturesPath}}
+	}
+
+	return nil
+}
+
+// openStore opens the database described by the config.
+func openStore() (storage.Store, error) {
+	if conf.DBDriver == config.DriverPostgres {
+		return storage.OpenPostgres(conf.DBURL)
+	}
+
+	return storage.OpenSQLite(conf.DBPath)
 }
 
 func main() {
-	go backgroundTask()
+	setup()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := migrateCommand(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	err := telegram.SetWebhook(botConfig)
+		return
+	}
+
+	applied, err := store.Migrate()
+	for _, m := range applied {
+		log.Printf("applied migration %04d_%s", m.Version, m.Name)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = telegram.SetCommands(botConfig)
+
+	err = claimLegacyFilms()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	http.HandleFunc("/webhook", func(w http.ResponseWriter, req *http.Request) {
-		if req.Method == "POST" {
-			body, _ := ioutil.ReadAll(req.Body)
-			var payload map[string]interface{}
-			err := json.Unmarshal(body, &payload)
-			if err != nil {
-				log.Println("unmarshal error", err)
-				return
-			}
+	// the bot stops on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// the outbox is stopped last, so it can send the notifications queued meanwhile
+	outboxCtx, stopOutbox := context.WithCancel(context.Background())
+	outboxDone := make(chan struct{})
+	go func() {
+		runOutbox(outboxCtx, client, conf.NotificationWorkers)
+		close(outboxDone)
+	}()
+
+	backgroundTaskDone := make(chan struct{})
+	go func() {
+		backgroundTask(ctx)
+		close(backgroundTaskDone)
+	}()
+
+	// the commands are merely suggestions shown to the users, so the bot can do without them
+	err = client.SetCommands()
+	if err != nil {
+		log.Println(err)
+	}
 
-			var u telegram.WebhookUpdate
+	if conf.Mode == config.ModePolling {
+		err = client.DeleteWebhook()
+		if err != nil {
+			log.Fatal(err)
+		}
 
-			_, isMessage := payload["message"]
-			_, isEditedMessage := payload["edited_message"]
+		pollUpdates(ctx, client, pollingRetryDelay)
+	} else {
+		err = client.SetWebhook(botConfig.WebhookUrl)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-			if isMessage {
-				err = json.Unmarshal(body, &u)
-			} else if isEditedMessage {
-				var e telegram.WebhookUpdateEdited
-				err = json.Unmarshal(body, &e)
+		serve(ctx)
+	}
 
-				u.UpdateId = e.UpdateId
-				u.Message = e.Message
-			}
+	log.Println("shutting down...")
 
-			_, err = storage.InsertMessage(conf, &storage.Message{
-				MessageId:     u.Message.MessageId,
-				FromId:        u.Message.From.Id,
-				FromFirstName: u.Message.From.FirstName,
-				ChatId:        u.Message.Chat.Id,
-				ChatFirstName: u.Message.Chat.FirstName,
-				Text:          u.Message.Text,
-			})
+	<-backgroundTaskDone
+	stopOutbox()
+	<-outboxDone
 
-			if err != nil {
-				log.Fatal(err)
-			}
+	err = store.Close()
+	if err != nil {
+		log.Println(err)
+	}
+}
 
-			var response interface{}
-
-			text := u.Message.Text
-			chatId := u.Message.Chat.Id
-			userId := u.Message.From.Id
-
-			if strings.HasPrefix(text, "/start") {
-				_, err = storage.UpdateChatStatus(conf, chatId, userId, storage.ChatIdle)
-				if err != nil {
-					log.Fatal(err)
-				}
-
-				_, err = storage.Subscribe(conf, chatId, userId)
-				if err != nil {
-					log.Fatal(err)
-				}
-
-				response = telegram.MakeResponseForStartCommand(chatId)
-			} else if strings.HasPrefix(text, "/stop") {
-				_, err = storage.UpdateChatStatus(conf, chatId, userId, storage.ChatIdle)
-				if err != nil {
-					log.Fatal(err)
-				}
-
-				_, err = storage.Unsubscribe(conf, chatId, userId)
-				if err != nil {
-					log.Fatal(err)
-				}
-
-				response = telegram.MakeResponseForStopCommand(chatId)
-			} else if strings.HasPrefix(text, "/list") {
-				_, err = storage.UpdateChatStatus(conf, chatId, userId, storage.ChatIdle)
-				if err != nil {
-					log.Fatal(err)
-				}
-				watchers, err := storage.GetWatchers(conf, chatId)
-				if err != nil {
-					log.Fatal(err)
-				}
-				response = telegram.MakeResponseForListCommand(&watchers, chatId)
-			} else if strings.HasPrefix(text, "/add") {
-				_, err := storage.UpdateChatStatus(conf, chatId, userId, storage.ChatWaitingForWatcherToAdd)
-				if err != nil {
-					log.Fatal(err)
-				}
-				response = telegram.MakeResponseForAddCommand(chatId)
-			} else if strings.HasPrefix(text, "/remove") {
-				_, err = storage.UpdateChatStatus(conf, chatId, userId, storage.ChatWaitingForWatcherToRemove)
-				if err != nil {
-					log.Fatal(err)
-				}
-
-				watchers, err := storage.GetWatchers(conf, chatId)
-				if err != nil {
-					log.Fatal(err)
-				}
-				response = telegram.MakeResponseForRemoveCommand(&watchers, chatId)
-			} else {
-				// at this point it is clear that the message received is not a command,
-				// so the way it is handled will depend on the chat status
-				chatStatus := storage.GetChatStatus(conf, chatId, userId)
-
-				if chatStatus == storage.ChatWaitingForWatcherToAdd {
-					// the message is a response to an /add command, so add the new watcher if it doesn't exist
-					rowsAffected, err := storage.InsertWatcher(conf, chatId, text)
-					var msg string
-					if err != nil {
-						log.Fatal(err)
-					} else if rowsAffected == 0 {
-						msg = "This looks like an invalid or already existing watcher. 🧐"
-					}
-
-					response = telegram.MakeResponseForWatcherAdded(chatId, msg)
-				} else if chatStatus == storage.ChatWaitingForWatcherToRemove {
-					// the message is a response to a /remove command, so remove the specified watcher, if found
-					rowsAffected, err := storage.RemoveWatcher(conf, chatId, text)
-					var msg string
-					if err != nil {
-						log.Fatal(err)
-					} else if rowsAffected == 0 {
-						msg = "Couldn't find a watcher named like that."
-					}
-					response = telegram.MakeResponseForWatcherRemoved(chatId, msg)
-				} else {
-					// the message is a random one
-					response = telegram.MakeResponseForUnknownCommand(chatId)
-				}
-
-				// set the chat as idle
-				_, err = storage.UpdateChatStatus(conf, chatId, userId, storage.ChatIdle)
-				if err != nil {
-					log.Fatal(err)
-				}
-			}
+// claimLegacyFilms hands the films stored before the films were tracked per cinema over to the configured cinemas,
+// so that the cinemas don't announce them again.
+func claimLegacyFilms() error {
+	cinemaIds := make(map[string][]string)
+	for _, cinema := range conf.Cinemas {
+		cinemaIds[cinema.Provider] = append(cinemaIds[cinema.Provider], cinema.Id)
+	}
 
-			// respond to the telegram message
-			if response != nil {
-				jsonData, err := json.Marshal(response)
-				if err != nil {
-					log.Fatal(err)
-				}
-
-				w.Header().Set("Content-Type", "application/json")
-				_, err = w.Write(jsonData)
-				if err != nil {
-					log.Fatal(err)
-				}
-			}
+	for provider, ids := range cinemaIds {
+		claimed, err := store.ClaimLegacyFilms(provider, ids)
+		if err != nil {
+			return err
 		}
-	})
 
-	http.HandleFunc("/webhook-info", func(w http.ResponseWriter, req *http.Request) {
-		resp, err := http.Get(botConfig.ApiUrl + "getWebhookInfo")
-		if err != nil {
-			log.Fatal(err)
+		if claimed > 0 {
+			log.Printf("%d legacy films claimed by the %s cinemas", claimed, provider)
 		}
+	}
+
+	return nil
+}
 
-		body, err := ioutil.ReadAll(resp.Body)
+// serve receives the updates sent by Telegram until the context is done, then waits for the updates being handled.
+func serve(ctx context.Context) {
+	http.HandleFunc("/webhook", webhookHandler)
+
+	http.HandleFunc("/webhook-info", func(w http.ResponseWriter, req *http.Request) {
+		var info json.RawMessage
+		err := client.Call(telegram.MethodGetWebhookInfo{Method: "getWebhookInfo"}, &info)
 		if err != nil {
-			log.Fatal(err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
 		}
 
-		fmt.Fprintf(w, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(info)
 	})
 
-	err = http.ListenAndServe(fmt.Sprintf(":%d", conf.PORT), nil)
-	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
-	}
-}
+	server := &http.Server{Addr: fmt.Sprintf(":%d", conf.PORT)}
 
-func sendNotification(notification telegram.MethodSendPhoto) {
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal("ListenAndServe: ", err)
+		}
+	}()
 
-	jsonData, err := json.Marshal(notification)
-	if err != nil {
-		log.Fatal(err)
-	}
+	<-ctx.Done()
 
-	resp, err := http.Post(botConfig.ApiUrl, "application/json", bytes.NewBuffer(jsonData))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
+	err := server.Shutdown(shutdownCtx)
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
 	}
+}
 
-	var res map[string]interface{}
+// sendNotification sends a message to the chat with the given client; chats that blocked the bot are marked as such, so they aren't notified anymore.
+func sendNotification(client apiClient, chatId int, notification interface{}) {
+	err := client.Call(notification, nil)
+	if err == nil {
+		return
+	}
 
-	err = json.NewDecoder(resp.Body).Decode(&res)
-	if err != nil {
-		log.Println(err)
+	if telegram.IsForbidden(err) {
+		log.Printf("chat %d blocked the bot: %v", chatId, err)
+
+		_, err = store.SetChatBlocked(chatId)
+		if err != nil {
+			log.Println(err)
+		}
+
+		return
 	}
+
+	log.Printf("notifying %d: %v", chatId, err)
 }
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/e10k/matheque/config"
+	"github.com/e10k/matheque/source"
+	"github.com/e10k/matheque/storage"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProvider serves the films and screenings it is given, without making any requests.
+type fakeProvider struct {
+	films      []source.Film
+	comingSoon []source.Film
+	events     []source.Event
+	// failingDay is the day the screenings can't be fetched for, if any
+	failingDay string
+	// country is the code of the country of the provider's cinemas; "ro" when empty
+	country string
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) CountryCode() string {
+	if len(p.country) > 0 {
+		return p.country
+	}
+
+	return "ro"
+}
+
+func (p *fakeProvider) GetFilms(ctx context.Context, cinemaId string) ([]source.Film, error) {
+	return p.films, nil
+}
+
+func (p *fakeProvider) GetComingSoon(ctx context.Context, cinemaId string) ([]source.Film, error) {
+	return p.comingSoon, nil
+}
+
+func (p *fakeProvider) GetLocalName(ctx context.Context, film source.Film) (string, error) {
+	return film.Name, nil
+}
+
+func (p *fakeProvider) GetEvents(ctx context.Context, cinemaId string, until time.Time) ([]source.Event, error) {
+	var events []source.Event
+	for _, e := range p.events {
+		if e.BusinessDay <= until.Format(source.DateLayout) {
+			events = append(events, e)
+		}
+	}
+
+	if len(p.failingDay) > 0 {
+		// like a provider fetching one day at a time, the screenings of the days before the failing one are returned too
+		var fetched []source.Event
+		for _, e := range events {
+			if e.BusinessDay < p.failingDay {
+				fetched = append(fetched, e)
+			}
+		}
+
+		return fetched, fmt.Errorf("fetching the screenings of %s: 502 Bad Gateway", p.failingDay)
+	}
+
+	return events, nil
+}
+
+// testEvent returns the film's screening scheduled the given number of days from now.
+func testEvent(id string, filmId string, days int) source.Event {
+	day := time.Now().AddDate(0, 0, days)
+
+	return source.Event{
+		Id:          id,
+		FilmId:      filmId,
+		CinemaId:    "10",
+		BusinessDay: day.Format(source.DateLayout),
+		DateTime:    day.Format(source.DateLayout) + "T20:00:00",
+	}
+}
+
+func TestFetchEvents(t *testing.T) {
+	s := setupTest(t)
+
+	provider := &fakeProvider{}
+	cinema := config.Cinema{Provider: provider.Name(), Id: "10", Name: "Test"}
+
+	// the first fetch only tracks the films' screenings
+	provider.events = []source.Event{testEvent("a", "1", 1), testEvent("b", "1", 7)}
+
+	newEvents, _, err := fetchEvents(context.Background(), provider, cinema)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(newEvents) != 0 {
+		t.Errorf("Expected no new screenings on the first fetch, got %+v", newEvents)
+	}
+
+	horizon, err := s.GetEventsHorizon(provider.Name(), cinema.Id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if expected := time.Now().AddDate(0, 0, eventsLookaheadDays).Format(source.DateLayout); horizon != expected {
+		t.Errorf("Expected horizon %s, got %s", expected, horizon)
+	}
+
+	// a day later, the day brought in by the lookahead isn't new, unlike the screenings added to the days fetched before
+	_, err = s.SetEventsHorizon(provider.Name(), cinema.Id, time.Now().AddDate(0, 0, eventsLookaheadDays-1).Format(source.DateLayout))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	provider.events = append(provider.events, testEvent("c", "1", 2), testEvent("d", "1", 7), testEvent("e", "2", 2))
+
+	// a failing day leaves the screenings and the horizon as they were, so the new screenings are found next time
+	provider.failingDay = time.Now().AddDate(0, 0, 3).Format(source.DateLayout)
+	_, _, err = fetchEvents(context.Background(), provider, cinema)
+	if err == nil {
+		t.Fatalf("Expected an error for the failing day")
+	}
+
+	horizon, err = s.GetEventsHorizon(provider.Name(), cinema.Id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if expected := time.Now().AddDate(0, 0, eventsLookaheadDays-1).Format(source.DateLayout); horizon != expected {
+		t.Errorf("Expected horizon %s after failing, got %s", expected, horizon)
+	}
+
+	provider.failingDay = ""
+	newEvents, _, err = fetchEvents(context.Background(), provider, cinema)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var ids []string
+	for filmId, events := range newEvents {
+		for _, e := range events {
+			ids = append(ids, filmId+"/"+e.Id)
+		}
+	}
+	if fmt.Sprint(ids) != "[1/c]" {
+		t.Errorf("Expected the screening added to a tracked film within the horizon only, got %v", ids)
+	}
+
+	newEvents, _, err = fetchEvents(context.Background(), provider, cinema)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(newEvents) != 0 {
+		t.Errorf("Expected no new screenings when fetching again, got %+v", newEvents)
+	}
+}
+
+func TestProcessFilmScreeningFilters(t *testing.T) {
+	s := setupTest(t)
+
+	provider := &fakeProvider{}
+	cinema := config.Cinema{Provider: provider.Name(), Id: "10", Name: "Test"}
+	film := source.Film{Id: "1", Name: "Dune", LocalName: "Dune"}
+
+	// chat 1 wants any screening, chat 2 IMAX screenings only
+	for chatId := 1; chatId <= 2; chatId++ {
+		_, err := s.InsertWatcher(chatId, "Dune")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	_, err := s.SetWatcherFilter(2, "Dune", storage.FilterFormat, "IMAX")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	steps := []struct {
+		name        string
+		event       *source.Event
+		eventsAdded bool
+		expected    string
+	}{
+		// the filtered watchers aren't notified about a film having no screenings yet
+		{"no screenings", nil, false, "[1]"},
+		{"2D screenings added", &source.Event{Id: "a", Formats: []string{"2D"}}, true, "[]"},
+		{"IMAX screenings added", &source.Event{Id: "b", Formats: []string{"IMAX"}}, true, "[2]"},
+		{"nothing added", nil, false, "[]"},
+	}
+
+	for i, step := range steps {
+		if i == 1 {
+			// the watchers added meanwhile aren't notified about the films checked before
+			_, err = s.InsertWatcher(3, "Dune")
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+
+		if step.event != nil {
+			e := testEvent(step.event.Id, film.Id, 1)
+			_, err = s.InsertEvent(&storage.Event{Provider: provider.Name(), Id: e.Id, FilmId: film.Id, CinemaId: cinema.Id,
+				BusinessDay: e.BusinessDay, DateTime: e.DateTime, Formats: step.event.Formats})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+
+		_, err = processFilm(context.Background(), provider, cinema, film, make(map[string]string), step.eventsAdded)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", step.name, err)
+		}
+
+		notifications, err := s.ClaimNotifications(10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var chats []int
+		for _, n := range notifications {
+			chats = append(chats, n.ChatId)
+		}
+		sort.Ints(chats)
+
+		if fmt.Sprint(chats) != step.expected {
+			t.Errorf("%s: expected chats %s to be notified, got %v", step.name, step.expected, chats)
+		}
+	}
+}
+
+func TestFetchCinemaUpcomingMovies(t *testing.T) {
+	s := setupTest(t)
+
+	provider := &fakeProvider{}
+	cinema := config.Cinema{Provider: provider.Name(), Id: "10", Name: "Test"}
+	arrival := source.Film{Id: "1", Name: "Arrival", LocalName: "Sosirea"}
+	dune := source.Film{Id: "2", Name: "Dune", LocalName: "Dune"}
+
+	// chat 1 wants the announcements, chat 2 doesn't
+	for chatId := 1; chatId <= 2; chatId++ {
+		_, err := s.UpdateChatStatus(chatId, chatId, storage.ChatIdle)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		for _, keywords := range []string{"Arrival", "Dune"} {
+			_, err := s.InsertWatcher(chatId, keywords)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+	}
+	_, err := s.ToggleChatAlert(1, 1, storage.AlertAnnouncement)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// a film already on sale isn't announced
+	_, err = s.InsertFilm(&storage.Film{Provider: provider.Name(), Id: dune.Id, CinemaId: cinema.Id, Name: dune.Name, OriginalName: dune.Name})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	steps := []struct {
+		name       string
+		comingSoon []source.Film
+		onSale     []source.Film
+		// expected are the chats notified, along with the start of their notifications
+		expected string
+	}{
+		{"announced", []source.Film{arrival, dune}, nil, "[1 📣]"},
+		{"still coming soon", []source.Film{arrival, dune}, nil, "[]"},
+		{"on sale", []source.Film{arrival}, []source.Film{arrival}, "[1 🎉 2 🎉]"},
+		{"still listed as coming soon", []source.Film{arrival}, nil, "[]"},
+	}
+
+	for _, step := range steps {
+		provider.comingSoon = step.comingSoon
+
+		for _, film := range step.onSale {
+			e := testEvent("a", film.Id, 1)
+			_, err = s.InsertEvent(&storage.Event{Provider: provider.Name(), Id: e.Id, FilmId: film.Id, CinemaId: cinema.Id,
+				BusinessDay: e.BusinessDay, DateTime: e.DateTime})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			_, err = processFilm(context.Background(), provider, cinema, film, make(map[string]string), true)
+			if err != nil {
+				t.Fatalf("%s: expected no error, got %v", step.name, err)
+			}
+		}
+
+		err = fetchCinemaUpcomingMoviesAndSendUpdates(context.Background(), provider, cinema, make(map[string]string))
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", step.name, err)
+		}
+
+		notifications, err := s.ClaimNotifications(10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var sent []string
+		for _, n := range notifications {
+			var payload struct {
+				Caption string `json:"caption"`
+			}
+			err = json.Unmarshal([]byte(n.Payload), &payload)
+			if err != nil {
+				t.Fatalf("Expected a JSON payload, got %q", n.Payload)
+			}
+
+			sent = append(sent, fmt.Sprint(n.ChatId), strings.Fields(payload.Caption)[0])
+		}
+
+		if fmt.Sprint(sent) != step.expected {
+			t.Errorf("%s: expected the notifications %s, got %v", step.name, step.expected, sent)
+		}
+	}
+}
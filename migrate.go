@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+const migrateUsage = "usage: matheque migrate status|up"
+
+// migrateCommand runs `matheque migrate status`, which lists the migrations and whether they have been applied,
+// or `matheque migrate up`, which applies the pending migrations; the bot applies them on startup as well.
+func migrateCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "status":
+		migrations, err := store.GetMigrations()
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			status := "pending"
+			if !m.AppliedAt.IsZero() {
+				status = "applied " + m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, status)
+		}
+	case "up":
+		applied, err := store.Migrate()
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(applied) == 0 {
+			fmt.Println("nothing to apply")
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/e10k/matheque/storage"
+	"github.com/e10k/matheque/telegram"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// outboxBatchSize is how many notifications are claimed at once
+	outboxBatchSize = 100
+	// outboxPollInterval is how long to wait before checking again an empty outbox
+	outboxPollInterval = 2 * time.Second
+	// outboxFlushTimeout is how long the queued notifications are still sent for when shutting down
+	outboxFlushTimeout = 20 * time.Second
+	// globalSendInterval keeps the bot under Telegram's limit of 30 messages per second
+	globalSendInterval = time.Second / 30
+	// chatSendInterval keeps the bot under Telegram's limit of one message per second in a chat
+	chatSendInterval = time.Second
+	// maxNotificationAttempts is how many times a notification is attempted before giving up on it
+	maxNotificationAttempts = 5
+	// notificationRetryDelay is the delay before attempting a notification again; it grows with each attempt
+	notificationRetryDelay = time.Minute
+)
+
+// queueNotification stores the notification of the matching chat in the outbox, from where it is sent by `runOutbox`;
+// a chat already notified about the film for the same reason isn't notified again.
+func queueNotification(match storage.WatcherMatch, notification interface{}, about storage.NotifiedFilm) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := store.InsertNotification(match.ChatId, string(payload), about, match)
+	if err != nil {
+		return fmt.Errorf("queueing notification: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		log.Printf("%d was already notified about %s (%s)", match.ChatId, about.FilmName, about.Reason)
+	}
+
+	return nil
+}
+
+// apiClient calls the methods of the Bot API, like `telegram.Client` does.
+type apiClient interface {
+	Call(method interface{}, result interface{}) error
+}
+
+// runOutbox sends the queued notifications with the given client, using the given number of workers, within Telegram's rate limits.
+// Notifications left unsent by a previous run are sent as well. Once the context is done, the notifications
+// already due are still sent for up to `outboxFlushTimeout`, then runOutbox returns.
+func runOutbox(ctx context.Context, client apiClient, workers int) {
+	released, err := store.ReleaseClaimedNotifications()
+	if err != nil {
+		log.Println(err)
+	}
+	if released > 0 {
+		log.Printf("resuming %d unsent notifications", released)
+	}
+
+	jobs := make(chan storage.Notification)
+	limiter := newRateLimiter(globalSendInterval, chatSendInterval)
+	// stopped once the workers are done with it
+	defer limiter.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				deliverNotification(client, n, limiter)
+			}
+		}()
+	}
+
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	var flushDeadline time.Time
+
+	for {
+		if ctx.Err() != nil && flushDeadline.IsZero() {
+			flushDeadline = time.Now().Add(outboxFlushTimeout)
+		}
+
+		notifications, err := store.ClaimNotifications(outboxBatchSize)
+		if err != nil {
+			log.Println(err)
+		}
+
+		if len(notifications) == 0 {
+			if ctx.Err() != nil {
+				return
+			}
+
+			sleep(ctx, outboxPollInterval)
+			continue
+		}
+
+		for i, n := range notifications {
+			// the notifications left claimed are released on the next run
+			if !flushDeadline.IsZero() && time.Now().After(flushDeadline) {
+				log.Printf("%d claimed notifications left unsent", len(notifications)-i)
+				return
+			}
+
+			jobs <- n
+		}
+	}
+}
+
+// deliverNotification sends the notification and records the outcome;
+// a notification failing because of a transient error is attempted again later. The notification is marked as being sent
+// beforehand, so that it is given up rather than sent again if the bot stops before recording the outcome.
+func deliverNotification(client apiClient, n storage.Notification, limiter *rateLimiter) {
+	limiter.wait(n.ChatId)
+
+	_, err := store.MarkNotificationSending(n.Id)
+	if err != nil {
+		// the notification stays claimed, so it is put back in the queue on the next run
+		log.Println(err)
+		return
+	}
+
+	err = client.Call(json.RawMessage(n.Payload), nil)
+	if err == nil {
+		_, err = store.MarkNotificationSent(n.Id)
+		if err != nil {
+			log.Println(err)
+		}
+
+		return
+	}
+
+	var retryAt time.Time
+
+	var apiErr *telegram.Error
+	if telegram.IsForbidden(err) {
+		log.Printf("chat %d blocked the bot: %v", n.ChatId, err)
+
+		_, err := store.SetChatBlocked(n.ChatId)
+		if err != nil {
+			log.Println(err)
+		}
+	} else if errors.As(err, &apiErr) && apiErr.Code < 500 && apiErr.Code != 429 {
+		// the request itself is wrong, so there's no point in repeating it
+		log.Printf("notifying %d: %v", n.ChatId, err)
+	} else if n.Attempts+1 < maxNotificationAttempts {
+		log.Printf("notifying %d, will retry: %v", n.ChatId, err)
+
+		retryAt = time.Now().Add(time.Duration(n.Attempts+1) * notificationRetryDelay)
+	} else {
+		log.Printf("notifying %d, giving up: %v", n.ChatId, err)
+	}
+
+	_, err = store.MarkNotificationFailed(n.Id, err.Error(), retryAt)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// rateLimiter spaces the messages sent by the bot, both overall and in each chat.
+type rateLimiter struct {
+	global   *time.Ticker
+	interval time.Duration
+
+	mu sync.Mutex
+	// next holds the earliest time a message can be sent to each chat
+	next map[int]time.Time
+}
+
+func newRateLimiter(globalInterval time.Duration, chatInterval time.Duration) *rateLimiter {
+	return &rateLimiter{
+		global:   time.NewTicker(globalInterval),
+		interval: chatInterval,
+		next:     make(map[int]time.Time),
+	}
+}
+
+// Stop releases the limiter's ticker; the limiter can't be waited on afterwards.
+func (l *rateLimiter) Stop() {
+	l.global.Stop()
+}
+
+// wait blocks until a message can be sent to the chat.
+func (l *rateLimiter) wait(chatId int) {
+	l.mu.Lock()
+
+	now := time.Now()
+	at := now
+	if next, ok := l.next[chatId]; ok && next.After(now) {
+		at = next
+	}
+	l.next[chatId] = at.Add(l.interval)
+
+	// forget about the chats that can be messaged right away
+	if len(l.next) > 1000 {
+		for id, next := range l.next {
+			if next.Before(now) {
+				delete(l.next, id)
+			}
+		}
+	}
+
+	l.mu.Unlock()
+
+	time.Sleep(at.Sub(now))
+	<-l.global.C
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/e10k/matheque/storage"
+	"github.com/e10k/matheque/telegram"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClient answers the calls with the error set for the chat messaged, if any, and records the chats messaged
+// along with the texts sent.
+type fakeClient struct {
+	mu     sync.Mutex
+	errors map[int]error
+	chats  []int
+	texts  []string
+}
+
+func (c *fakeClient) Call(method interface{}, result interface{}) error {
+	body, err := json.Marshal(method)
+	if err != nil {
+		return err
+	}
+
+	var message struct {
+		ChatId int    `json:"chat_id"`
+		Text   string `json:"text"`
+	}
+	err = json.Unmarshal(body, &message)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.chats = append(c.chats, message.ChatId)
+	c.texts = append(c.texts, message.Text)
+
+	return c.errors[message.ChatId]
+}
+
+// recordingStore records the outcome of the notifications delivered, on top of the memory store.
+type recordingStore struct {
+	storage.Store
+
+	mu      sync.Mutex
+	sent    []int64
+	failed  map[int64]time.Time
+	blocked []int
+}
+
+func (s *recordingStore) MarkNotificationSent(id int64) (int64, error) {
+	s.mu.Lock()
+	s.sent = append(s.sent, id)
+	s.mu.Unlock()
+
+	return s.Store.MarkNotificationSent(id)
+}
+
+func (s *recordingStore) MarkNotificationFailed(id int64, reason string, retryAt time.Time) (int64, error) {
+	s.mu.Lock()
+	s.failed[id] = retryAt
+	s.mu.Unlock()
+
+	return s.Store.MarkNotificationFailed(id, reason, retryAt)
+}
+
+func (s *recordingStore) SetChatBlocked(chatId int) (int64, error) {
+	s.mu.Lock()
+	s.blocked = append(s.blocked, chatId)
+	s.mu.Unlock()
+
+	return s.Store.SetChatBlocked(chatId)
+}
+
+// setupOutboxTest replaces the store with a recording one, for the duration of the test.
+func setupOutboxTest(t *testing.T) *recordingStore {
+	s := &recordingStore{Store: setupTest(t), failed: make(map[int64]time.Time)}
+	store = s
+
+	return s
+}
+
+// queueTestNotification queues a notification for the chat about a film of its own.
+func queueTestNotification(t *testing.T, chatId int) {
+	t.Helper()
+
+	about := storage.NotifiedFilm{Provider: "fake", FilmId: fmt.Sprint(chatId), CinemaId: "10", FilmName: "Dune", Reason: storage.ReasonOnSale}
+	err := queueNotification(storage.WatcherMatch{ChatId: chatId}, telegram.NewMessage(chatId, "Dune"), about)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+func TestDeliverNotification(t *testing.T) {
+	tables := []struct {
+		name     string
+		err      error
+		attempts int
+		// expected is the outcome: sent, retried or failed
+		expected string
+		blocked  bool
+	}{
+		{"sent", nil, 0, "sent", false},
+		{"bad request", &telegram.Error{Code: 400, Description: "Bad Request: can't parse entities"}, 0, "failed", false},
+		{"blocked", &telegram.Error{Code: 403, Description: "Forbidden: bot was blocked by the user"}, 0, "failed", true},
+		{"too many requests", &telegram.Error{Code: 429, Description: "Too Many Requests"}, 0, "retried", false},
+		{"server error", &telegram.Error{Code: 502, Description: "Bad Gateway"}, 1, "retried", false},
+		{"network error", &url.Error{Op: "Post", URL: "https://api.telegram.org", Err: errors.New("connection reset")}, 0, "retried", false},
+		{"last attempt", &telegram.Error{Code: 500, Description: "Internal Server Error"}, maxNotificationAttempts - 1, "failed", false},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			s := setupOutboxTest(t)
+			queueTestNotification(t, testChatId)
+
+			notifications, err := s.ClaimNotifications(outboxBatchSize)
+			if err != nil || len(notifications) != 1 {
+				t.Fatalf("Expected the queued notification, got %+v and %v", notifications, err)
+			}
+			n := notifications[0]
+			n.Attempts = table.attempts
+
+			client := &fakeClient{errors: map[int]error{testChatId: table.err}}
+			limiter := newRateLimiter(time.Millisecond, 0)
+			defer limiter.Stop()
+			deliverNotification(client, n, limiter)
+
+			var outcome string
+			retryAt, failed := s.failed[n.Id]
+			switch {
+			case len(s.sent) == 1 && !failed:
+				outcome = "sent"
+			case failed && !retryAt.IsZero():
+				outcome = "retried"
+			case failed:
+				outcome = "failed"
+			}
+
+			if outcome != table.expected {
+				t.Errorf("Expected the notification to be %s, got %q", table.expected, outcome)
+			}
+
+			expected := time.Now().Add(time.Duration(table.attempts+1) * notificationRetryDelay)
+			if d := retryAt.Sub(expected); outcome == "retried" && (d < -time.Second || d > time.Second) {
+				t.Errorf("Expected a retry at about %v, got %v", expected, retryAt)
+			}
+
+			if blocked := len(s.blocked) > 0; blocked != table.blocked {
+				t.Errorf("Expected the chat blocked to be %v, got %v", table.blocked, blocked)
+			}
+		})
+	}
+}
+
+func TestRunOutbox(t *testing.T) {
+	s := setupOutboxTest(t)
+
+	for chatId := 1; chatId <= 3; chatId++ {
+		queueTestNotification(t, chatId)
+	}
+
+	// a notification claimed by a previous run that didn't get to send it, and one it stopped while sending,
+	// which may have been delivered already
+	_, err := s.ClaimNotifications(1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	queueTestNotification(t, 4)
+	sending, err := s.ClaimNotifications(outboxBatchSize)
+	if err != nil || len(sending) != 3 {
+		t.Fatalf("Expected the other notifications to be claimed, got %+v and %v", sending, err)
+	}
+	_, err = s.MarkNotificationSending(sending[2].Id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// the notifications already due are sent even when the outbox is stopped right away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := &fakeClient{errors: map[int]error{2: &telegram.Error{Code: 400, Description: "Bad Request"}}}
+	runOutbox(ctx, client, 2)
+
+	sort.Ints(client.chats)
+	if fmt.Sprint(client.chats) != "[1 2 3]" {
+		t.Errorf("Expected each chat but the one being sent to to be messaged once, got %v", client.chats)
+	}
+
+	for chatId, expected := range map[int]int{1: 1, 2: 0, 3: 1, 4: 0} {
+		history, err := s.GetNotificationHistory(chatId, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if len(history) != expected {
+			t.Errorf("Expected %d notifications sent to chat %d, got %+v", expected, chatId, history)
+		}
+	}
+
+	notifications, err := s.ClaimNotifications(outboxBatchSize)
+	if err != nil || len(notifications) != 0 {
+		t.Errorf("Expected no notifications left, got %+v and %v", notifications, err)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(time.Millisecond, 100*time.Millisecond)
+	defer limiter.Stop()
+
+	start := time.Now()
+	limiter.wait(1)
+	limiter.wait(2)
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("Expected different chats to be messaged right away, waited %v", elapsed)
+	}
+
+	limiter.wait(1)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected the chat to be messaged again after 100ms, waited %v", elapsed)
+	}
+}
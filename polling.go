@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"github.com/e10k/matheque/telegram"
+	"log"
+	"time"
+)
+
+const (
+	// pollingTimeout is how many seconds a request for updates waits for one to arrive
+	pollingTimeout = 50
+	// pollingRetryDelay is how long to wait before asking for updates again after a failed request
+	pollingRetryDelay = 5 * time.Second
+	// maxUpdateAttempts is how many times the handling of an update is attempted before skipping it
+	maxUpdateAttempts = 3
+)
+
+// updatesClient pulls the updates from the Bot API and calls its methods, like `telegram.Client` does.
+type updatesClient interface {
+	apiClient
+	GetUpdates(ctx context.Context, offset int, timeout int) ([]telegram.WebhookUpdate, error)
+}
+
+// pollUpdates pulls the updates from Telegram with the given client and reacts to them the same way the webhook does,
+// until the context is done; after a failure, it waits for `retryDelay` before pulling the updates again.
+// The offset of the next update is stored after handling each update, so polling resumes where it left off after a restart.
+// An update failing `maxUpdateAttempts` times is skipped, letting its chat know.
+func pollUpdates(ctx context.Context, client updatesClient, retryDelay time.Duration) {
+	offset, err := store.GetUpdatesOffset()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// failures counts the failed attempts to handle each update
+	failures := make(map[int]int)
+
+	for ctx.Err() == nil {
+		updates, err := client.GetUpdates(ctx, offset, pollingTimeout)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println(err)
+				sleep(ctx, retryDelay)
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			// the updates not handled yet are pulled again after a restart
+			if ctx.Err() != nil {
+				return
+			}
+
+			response, err := handleUpdate(u)
+			if err != nil {
+				log.Printf("handling update %d: %v", u.UpdateId, err)
+
+				// pull the update again, unless it failed too many times already
+				failures[u.UpdateId]++
+				if failures[u.UpdateId] < maxUpdateAttempts {
+					sleep(ctx, retryDelay)
+					break
+				}
+
+				log.Printf("skipping update %d", u.UpdateId)
+				if chatId := updateChatId(u); chatId != 0 {
+					response = telegram.MakeResponseForFailedUpdate(chatId)
+				}
+			}
+			delete(failures, u.UpdateId)
+
+			// there's no webhook request to respond to, so the response is sent separately
+			if response != nil {
+				sendNotification(client, updateChatId(u), response)
+			}
+
+			offset = u.UpdateId + 1
+			_, err = store.SetUpdatesOffset(offset)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// updateChatId returns the id of the chat the update comes from.
+func updateChatId(u telegram.WebhookUpdate) int {
+	if u.CallbackQuery != nil && u.CallbackQuery.Message != nil {
+		return u.CallbackQuery.Message.Chat.Id
+	}
+
+	if u.Message != nil {
+		return u.Message.Chat.Id
+	}
+
+	if u.EditedMessage != nil {
+		return u.EditedMessage.Chat.Id
+	}
+
+	return 0
+}
+
+// sleep pauses for the given duration, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/e10k/matheque/storage"
+	"github.com/e10k/matheque/telegram"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeUpdatesClient serves the updates it is given from the offset asked for, like Telegram does, and records the offsets;
+// the context is cancelled once there are no updates left, or as soon as the updates are pulled if `cancelOnPull` is set.
+type fakeUpdatesClient struct {
+	fakeClient
+	updates      []telegram.WebhookUpdate
+	offsets      []int
+	cancel       context.CancelFunc
+	cancelOnPull bool
+}
+
+func (c *fakeUpdatesClient) GetUpdates(ctx context.Context, offset int, timeout int) ([]telegram.WebhookUpdate, error) {
+	c.offsets = append(c.offsets, offset)
+
+	var updates []telegram.WebhookUpdate
+	for _, u := range c.updates {
+		if u.UpdateId >= offset {
+			updates = append(updates, u)
+		}
+	}
+
+	if len(updates) == 0 || c.cancelOnPull {
+		c.cancel()
+	}
+
+	if len(updates) == 0 {
+		return nil, ctx.Err()
+	}
+
+	return updates, nil
+}
+
+// failingStore fails storing the messages having the given ids, on top of the memory store.
+type failingStore struct {
+	storage.Store
+	failing map[int]bool
+}
+
+func (s *failingStore) InsertMessage(m *storage.Message) (int64, error) {
+	if s.failing[m.MessageId] {
+		return 0, errors.New("database is locked")
+	}
+
+	return s.Store.InsertMessage(m)
+}
+
+func TestPollUpdates(t *testing.T) {
+	s := setupTest(t)
+	store = &failingStore{Store: s, failing: map[int]bool{11: true}}
+
+	// polling resumes from the offset stored by a previous run
+	_, err := s.SetUpdatesOffset(10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &fakeUpdatesClient{
+		updates: []telegram.WebhookUpdate{testUpdate(9, "/stop"), testUpdate(10, "/start"), testUpdate(11, "/list"), testUpdate(12, "/list")},
+		cancel:  cancel,
+	}
+	pollUpdates(ctx, client, time.Millisecond)
+
+	// the failing update is pulled again until it is skipped
+	if fmt.Sprint(client.offsets) != "[10 11 11 13]" {
+		t.Errorf("Expected the updates to be pulled from offsets [10 11 11 13], got %v", client.offsets)
+	}
+
+	expected := []string{"You are now subscribed", "Sorry, something went wrong", "You have no watchers"}
+	if len(client.texts) != len(expected) {
+		t.Fatalf("Expected %d responses, got %q", len(expected), client.texts)
+	}
+	for i, text := range client.texts {
+		if !strings.Contains(text, expected[i]) || client.chats[i] != testChatId {
+			t.Errorf("Expected a response containing %q, got %q to chat %d", expected[i], text, client.chats[i])
+		}
+	}
+
+	offset, err := s.GetUpdatesOffset()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if offset != 13 {
+		t.Errorf("Expected offset 13 to be stored, got %d", offset)
+	}
+}
+
+func TestPollUpdatesShutdown(t *testing.T) {
+	s := setupTest(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the updates pulled while shutting down are left for the next run
+	client := &fakeUpdatesClient{updates: []telegram.WebhookUpdate{testUpdate(1, "/start")}, cancel: cancel, cancelOnPull: true}
+
+	done := make(chan struct{})
+	go func() {
+		pollUpdates(ctx, client, time.Hour)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected polling to stop once the context is done")
+	}
+
+	if len(client.texts) != 0 {
+		t.Errorf("Expected no responses, got %q", client.texts)
+	}
+
+	offset, err := s.GetUpdatesOffset()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if offset != 0 {
+		t.Errorf("Expected no offset to be stored, got %d", offset)
+	}
+}
@@ -0,0 +1,98 @@
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// HTTPProvider is implemented by the providers fetching the films over HTTP, so that their requests can be recorded or replayed.
+type HTTPProvider interface {
+	Provider
+	// WithClient returns a copy of the provider making its requests with the given client.
+	WithClient(client *http.Client) Provider
+}
+
+// Recorder is a http.RoundTripper saving the successful responses to `Dir`, to be served later by a Replayer.
+type Recorder struct {
+	Dir string
+	// Transport makes the actual requests.
+	Transport http.RoundTripper
+}
+
+func (r Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	err = os.MkdirAll(r.Dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("recording %s: %v", req.URL, err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(r.Dir, FixtureName(req.URL)), body, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("recording %s: %v", req.URL, err)
+	}
+
+	return resp, nil
+}
+
+// Replayer is a http.RoundTripper responding with the fixtures found in `Dir`, without making any requests;
+// requests having no fixture fail.
+type Replayer struct {
+	Dir string
+}
+
+func (r Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := ioutil.ReadFile(filepath.Join(r.Dir, FixtureName(req.URL)))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no fixture recorded for %s", req.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// untilDate matches the end of the date ranges requested, which is relative to the current time.
+var untilDate = regexp.MustCompile(`/until/\d{4}-\d{2}-\d{2}`)
+
+// unsafeChars matches the characters replaced in the fixtures' file names.
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// FixtureName returns the name of the file the response to the URL is recorded in, e.g. `www.example.com_films_1_lang_en`.
+// The end of the requested date range is left out, so that the fixtures can be replayed on any day.
+func FixtureName(u *url.URL) string {
+	name := u.Host + untilDate.ReplaceAllString(u.Path, "/until")
+	if len(u.RawQuery) > 0 {
+		name += "?" + u.RawQuery
+	}
+
+	return unsafeChars.ReplaceAllString(name, "_")
+}
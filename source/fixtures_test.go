@@ -0,0 +1,73 @@
+package source
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestFixtureName(t *testing.T) {
+	tables := []struct {
+		url      string
+		expected string
+	}{
+		{"https://www.example.com/films/1?lang=en_GB", "www.example.com_films_1_lang_en_GB"},
+		{"https://www.example.com/films/until/2024-03-01?attr=&lang=en_GB", "www.example.com_films_until_attr_lang_en_GB"},
+		{"https://www.example.com/events/at-date/2024-03-01", "www.example.com_events_at-date_2024-03-01"},
+	}
+
+	for _, table := range tables {
+		u, err := url.Parse(table.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := FixtureName(u); got != table.expected {
+			t.Errorf("Expected %q for %s, got %q", table.expected, table.url, got)
+		}
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprintf(w, "served %s", r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+
+	recorder := &http.Client{Transport: Recorder{Dir: dir, Transport: http.DefaultTransport}}
+	for _, path := range []string{"/films/until/2024-03-01", "/missing"} {
+		resp, err := recorder.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	replayer := &http.Client{Transport: Replayer{Dir: dir}}
+
+	// the response is replayed regardless of the date range's end
+	resp, err := replayer.Get(server.URL + "/films/until/2030-01-01")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "served /films/until/2024-03-01" {
+		t.Errorf("Expected the recorded response, got %d %q", resp.StatusCode, body)
+	}
+
+	_, err = replayer.Get(server.URL + "/missing")
+	if err == nil {
+		t.Errorf("Expected the unsuccessful response not to be recorded")
+	}
+}
@@ -0,0 +1,120 @@
+// Package source defines the interface implemented by the cinema chains the films are fetched from
+// and keeps a registry of the available implementations.
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DateLayout is the layout of the films' `ReleaseDate`.
+	DateLayout = "2006-01-02"
+	// DateTimeLayout is the layout of the events' `DateTime`.
+	DateTimeLayout = "2006-01-02T15:04:05"
+)
+
+// Film is a film playing at a cinema; `LocalName` is only set by the providers
+// that get the localized title along with the film.
+type Film struct {
+	Id          string
+	Name        string
+	LocalName   string
+	Link        string
+	PosterLink  string
+	ReleaseDate string
+	Details
+}
+
+// Details are a film's optional properties; languages are given as ISO 639-1 codes.
+type Details struct {
+	Length            int
+	ReleaseYear       string
+	Genres            []string
+	AgeRating         string
+	Formats           []string
+	OriginalLanguage  string
+	DubbedLanguages   []string
+	SubtitleLanguages []string
+}
+
+type Event struct {
+	Id          string
+	FilmId      string
+	CinemaId    string
+	BusinessDay string
+	DateTime    string
+	BookingLink string
+	Auditorium  string
+	// languages are given as ISO 639-1 codes
+	Formats           []string
+	DubbedLanguages   []string
+	SubtitleLanguages []string
+}
+
+// Provider is a cinema chain offering films and their screenings; its requests are abandoned once the context is done.
+type Provider interface {
+	// Name returns the name the provider is registered under.
+	Name() string
+	// CountryCode returns the lowercase ISO 3166 code of the country the provider's cinemas are in.
+	CountryCode() string
+	// GetFilms returns the films currently playing, or available for booking, at the given cinema.
+	GetFilms(ctx context.Context, cinemaId string) ([]Film, error)
+	// GetComingSoon returns the films announced for the given cinema, not yet available for booking.
+	GetComingSoon(ctx context.Context, cinemaId string) ([]Film, error)
+	// GetLocalName returns the film's localized title.
+	GetLocalName(ctx context.Context, film Film) (string, error)
+	// GetEvents returns the screenings scheduled at the given cinema until the given time; when any day can't be fetched,
+	// it returns an error and the screenings of the other days are disregarded.
+	GetEvents(ctx context.Context, cinemaId string, until time.Time) ([]Event, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]Provider)
+)
+
+// Register makes a provider available under its name.
+// It panics if a provider having the same name has already been registered.
+func Register(provider Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	name := provider.Name()
+	if _, dup := providers[name]; dup {
+		panic("source: Register called twice for provider " + name)
+	}
+
+	providers[name] = provider
+}
+
+// Get returns the provider registered under the given name.
+func Get(name string) (Provider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	provider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("source: unknown provider %q (forgotten import?)", name)
+	}
+
+	return provider, nil
+}
+
+// Providers returns the sorted names of the registered providers.
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
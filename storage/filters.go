@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Values of the `WatcherFilters.Audio` filter.
+const (
+	AudioOriginal = "original"
+	AudioDubbed   = "dubbed"
+)
+
+// Values of the `WatcherFilters.Subtitles` filter.
+const (
+	SubtitlesYes = "subtitled"
+	SubtitlesNo  = "none"
+)
+
+// WatcherFilter is one of the optional attribute filters of a watcher.
+type WatcherFilter int8
+
+const (
+	FilterFormat WatcherFilter = iota
+	FilterAudio
+	FilterSubtitles
+	FilterAgeRating
+)
+
+// filterColumns maps the filters to the `watchers` columns storing them.
+var filterColumns = map[WatcherFilter]string{
+	FilterFormat:    "filter_format",
+	FilterAudio:     "filter_audio",
+	FilterSubtitles: "filter_subtitles",
+	FilterAgeRating: "filter_age_rating",
+}
+
+// WatcherFilters restrict a watcher to the films having the given age rating and
+// screenings with the given properties; empty values match anything.
+type WatcherFilters struct {
+	Format    string
+	Audio     string
+	Subtitles string
+	AgeRating string
+}
+
+// IsEmpty reports whether no filter is set.
+func (f WatcherFilters) IsEmpty() bool {
+	return f == WatcherFilters{}
+}
+
+// FiltersScreenings reports whether any of the filters on the screenings' properties is set.
+func (f WatcherFilters) FiltersScreenings() bool {
+	return len(f.Format) > 0 || len(f.Audio) > 0 || len(f.Subtitles) > 0
+}
+
+// Match reports whether a film having the given age rating and screenings satisfies the filters.
+// A film whose screenings are not known (nil) or has none doesn't satisfy the filters on the screenings' properties.
+func (f WatcherFilters) Match(ageRating string, events []Event) bool {
+	if len(f.AgeRating) > 0 && !strings.EqualFold(f.AgeRating, ageRating) {
+		return false
+	}
+
+	if !f.FiltersScreenings() {
+		return true
+	}
+
+	for _, e := range events {
+		if f.matchEvent(e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f WatcherFilters) matchEvent(e Event) bool {
+	if len(f.Format) > 0 && !containsFold(e.Formats, f.Format) {
+		return false
+	}
+
+	switch f.Audio {
+	case AudioOriginal:
+		if len(e.DubbedLanguages) > 0 {
+			return false
+		}
+	case AudioDubbed:
+		if len(e.DubbedLanguages) == 0 {
+			return false
+		}
+	}
+
+	switch f.Subtitles {
+	case SubtitlesYes:
+		if len(e.SubtitleLanguages) == 0 {
+			return false
+		}
+	case SubtitlesNo:
+		if len(e.SubtitleLanguages) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetWatcherFilter sets one of the filters of the chat's watcher; an empty value clears the filter.
+func (s *SQLiteStore) SetWatcherFilter(chatId int, keywords string, filter WatcherFilter, value string) (int64, error) {
+	column, ok := filterColumns[filter]
+	if !ok {
+		return 0, fmt.Errorf("unknown watcher filter %d", filter)
+	}
+
+	result, err := s.db.Exec(fmt.Sprintf("UPDATE watchers SET %s = ? WHERE chat_id=? AND keywords=? COLLATE NOCASE", column), value, chatId, keywords)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
+
+// GetWatchersFilters returns the filters of the chat's watchers, keyed by the watchers' keywords.
+func (s *SQLiteStore) GetWatchersFilters(chatId int) (map[string]WatcherFilters, error) {
+	rows, err := s.db.Query("SELECT keywords, filter_format, filter_audio, filter_subtitles, filter_age_rating FROM watchers WHERE chat_id = ?", chatId)
+	if err != nil {
+		return nil, fmt.Errorf("fetching watcher filters: %v", err)
+	}
+	defer rows.Close()
+
+	data := make(map[string]WatcherFilters)
+
+	for rows.Next() {
+		var k string
+		var f WatcherFilters
+		err = rows.Scan(&k, &f.Format, &f.Audio, &f.Subtitles, &f.AgeRating)
+		if err != nil {
+			return nil, fmt.Errorf("reading watcher filters: %v", err)
+		}
+
+		data[k] = f
+	}
+
+	return data, nil
+}
+
+// SetPendingWatcher remembers the watcher whose filters are being set up by the chat.
+func (s *SQLiteStore) SetPendingWatcher(chatId int, userId int, keywords string) (int64, error) {
+	result, err := s.db.Exec("UPDATE chats SET pending_watcher = ?, updated_at = ? WHERE chat_id=? AND user_id=?", keywords, time.Now(), chatId, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
+
+// GetPendingWatcher returns the watcher whose filters are being set up by the chat.
+func (s *SQLiteStore) GetPendingWatcher(chatId int, userId int) (string, error) {
+	var keywords string
+
+	row := s.db.QueryRow("SELECT pending_watcher FROM chats WHERE chat_id=$1 AND user_id=$2", chatId, userId)
+	err := row.Scan(&keywords)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return keywords, nil
+}
+
+// GetAgeRatings returns the sorted age ratings of the stored films.
+func (s *SQLiteStore) GetAgeRatings() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT age_rating FROM films WHERE age_rating <> '' ORDER BY age_rating")
+	if err != nil {
+		return nil, fmt.Errorf("fetching age ratings: %v", err)
+	}
+	defer rows.Close()
+
+	var data []string
+
+	for rows.Next() {
+		var r string
+		err = rows.Scan(&r)
+		if err != nil {
+			return nil, fmt.Errorf("reading age ratings: %v", err)
+		}
+
+		data = append(data, r)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestWatcherFiltersMatch(t *testing.T) {
+	events := []Event{
+		{Formats: []string{"2D"}, DubbedLanguages: []string{"ro"}},
+		{Formats: []string{"IMAX"}, SubtitleLanguages: []string{"ro"}},
+	}
+
+	tables := []struct {
+		filters   WatcherFilters
+		ageRating string
+		events    []Event
+		expected  bool
+	}{
+		{WatcherFilters{}, "", events, true},
+		{WatcherFilters{}, "", nil, true},
+		{WatcherFilters{Format: "imax"}, "", events, true},
+		{WatcherFilters{Format: "IMAX", Audio: AudioOriginal}, "", events, true},
+		{WatcherFilters{Format: "IMAX", Audio: AudioDubbed}, "", events, false},
+		{WatcherFilters{Format: "2D", Subtitles: SubtitlesNo}, "", events, true},
+		{WatcherFilters{Format: "2D", Subtitles: SubtitlesYes}, "", events, false},
+		{WatcherFilters{Format: "4DX"}, "", events, false},
+		{WatcherFilters{Format: "4DX"}, "", nil, false},
+		{WatcherFilters{Audio: AudioOriginal}, "", nil, false},
+		{WatcherFilters{AgeRating: "AG"}, "AG", nil, true},
+		{WatcherFilters{Format: "4DX"}, "", []Event{}, false},
+		{WatcherFilters{AgeRating: "AG"}, "ag", events, true},
+		{WatcherFilters{AgeRating: "AG"}, "N-15", nil, false},
+		{WatcherFilters{AgeRating: "AG"}, "", events, false},
+	}
+
+	for _, table := range tables {
+		got := table.filters.Match(table.ageRating, table.events)
+
+		if got != table.expected {
+			t.Errorf("Expected %v for %+v (age rating %q, events %v), got %v", table.expected, table.filters, table.ageRating, table.events, got)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A watcher's keywords are a list of terms separated by commas or `OR`, e.g. `Fight Club, Clubul de lupte` or `Batman OR Joker`,
+// optionally followed or preceded by exclusions, e.g. `Batman -lego -"mask of the phantasm"`:
+//   - each term is matched on its own against the film's names, as the watcher's strictness requires;
+//   - a film having any of the exclusions in its names, as a whole, is not matched, whichever term matched it;
+//   - the text in double quotes is taken as it is, so that terms can have commas, dashes or `OR` in them.
+// The terms are indexed by the stores, for finding the candidates matching a film, while the exclusions are checked afterwards.
+
+// keywordsToken is a word, a quoted phrase, an exclusion or a separator of the keywords.
+type keywordsToken struct {
+	text      string
+	excluded  bool
+	separator bool
+}
+
+// parseKeywords returns the terms and the exclusions of the keywords, as entered.
+func parseKeywords(keywords string) ([]string, []string) {
+	var terms, exclusions, words []string
+
+	flush := func() {
+		if len(words) > 0 {
+			terms = append(terms, strings.Join(words, " "))
+			words = nil
+		}
+	}
+
+	for _, token := range tokenizeKeywords(keywords) {
+		switch {
+		case token.separator:
+			flush()
+		case token.excluded:
+			exclusions = append(exclusions, token.text)
+		default:
+			words = append(words, token.text)
+		}
+	}
+	flush()
+
+	return terms, exclusions
+}
+
+func tokenizeKeywords(keywords string) []keywordsToken {
+	var tokens []keywordsToken
+
+	runes := []rune(keywords)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == ',':
+			tokens = append(tokens, keywordsToken{separator: true})
+			i++
+			continue
+		}
+
+		// a dash starting a word excludes it, unlike the dashes within words, e.g. `Spider-Man`, or standing alone
+		excluded := r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ','
+		if excluded {
+			i++
+		}
+
+		var text string
+		if runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+
+			// an unterminated quote lasts until the end of the keywords
+			text = strings.TrimSpace(string(runes[i+1 : end]))
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != ',' && runes[end] != '"' {
+				end++
+			}
+
+			text = string(runes[i:end])
+			i = end
+
+			if text == "OR" && !excluded {
+				tokens = append(tokens, keywordsToken{separator: true})
+				continue
+			}
+		}
+
+		if len(text) > 0 {
+			tokens = append(tokens, keywordsToken{text: text, excluded: excluded})
+		}
+	}
+
+	return tokens
+}
+
+// keywordsExclusions returns the normalised exclusions of the keywords.
+func keywordsExclusions(keywords string) []string {
+	_, exclusions := parseKeywords(keywords)
+
+	var data []string
+	for _, e := range exclusions {
+		if normalised := NormaliseString(e); len(normalised) > 0 {
+			data = append(data, normalised)
+		}
+	}
+
+	return data
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseKeywords(t *testing.T) {
+	tables := []struct {
+		keywords   string
+		terms      []string
+		exclusions []string
+	}{
+		{"Fight Club", []string{"Fight Club"}, nil},
+		{" Fight Club,Clubul de lupte , ", []string{"Fight Club", "Clubul de lupte"}, nil},
+		{"Batman OR Joker", []string{"Batman", "Joker"}, nil},
+		{"Batman -lego", []string{"Batman"}, []string{"lego"}},
+		{`-"mask of the phantasm" Batman -LEGO, Joker`, []string{"Batman", "Joker"}, []string{"mask of the phantasm", "LEGO"}},
+		{`"Tick, Tick... Boom!" OR "Hell OR High Water"`, []string{"Tick, Tick... Boom!", "Hell OR High Water"}, nil},
+		{"Spider-Man OR X-Men - Origins", []string{"Spider-Man", "X-Men - Origins"}, nil},
+		{`Oppenheimer "IMAX`, []string{"Oppenheimer IMAX"}, nil},
+		{"-lego", nil, []string{"lego"}},
+		{"or, OR", []string{"or"}, nil},
+	}
+
+	for _, table := range tables {
+		terms, exclusions := parseKeywords(table.keywords)
+
+		if fmt.Sprintf("%q %q", terms, exclusions) != fmt.Sprintf("%q %q", table.terms, table.exclusions) {
+			t.Errorf("Expected terms %q and exclusions %q for %q, got %q and %q", table.terms, table.exclusions, table.keywords, terms, exclusions)
+		}
+	}
+}
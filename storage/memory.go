@@ -0,0 +1,1157 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is the Store keeping the data in memory, for the tests that don't care about the database;
+// it behaves like the database backed stores, except that the data is lost once the process exits.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	// lastId is the last row id handed out, shared by all the records having one
+	lastId int64
+
+	films             []Film
+	upcomingFilms     []Film
+	events            []Event
+	messages          []Message
+	chats             []*memoryChat
+	chatCinemas       []memoryChatRow
+	mutedFilms        []memoryChatRow
+	watchers          []*memoryWatcher
+	updatesOffset     int
+	processedUpdates  map[int]time.Time
+	eventsHorizons    map[string]string
+	notifications     []*memoryNotification
+	sentNotifications []*memorySentNotification
+}
+
+type memoryChat struct {
+	chatId             int
+	userId             int
+	subscribed         bool
+	status             ChatStatus
+	country            string
+	announcementAlerts bool
+	onSaleAlerts       bool
+	pendingWatcher     string
+	blocked            bool
+}
+
+// memoryChatRow is a chat's cinema or muted film.
+type memoryChatRow struct {
+	chatId   int
+	provider string
+	id       string
+}
+
+type memoryWatcher struct {
+	id            int64
+	chatId        int
+	keywords      string
+	terms         []watcherTerm
+	pattern       string
+	newScreenings bool
+	filters       WatcherFilters
+	strictness    Strictness
+}
+
+type memoryNotification struct {
+	Notification
+	status        NotificationStatus
+	nextAttemptAt time.Time
+	lastError     string
+	sentAt        time.Time
+}
+
+type memorySentNotification struct {
+	id             int64
+	chatId         int
+	about          NotifiedFilm
+	match          WatcherMatch
+	notificationId int64
+}
+
+// NewMemoryStore returns an empty store, which needs no migrations.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) GetMigrations() ([]Migration, error) {
+	return nil, nil
+}
+
+func (s *MemoryStore) Migrate() ([]Migration, error) {
+	return nil, nil
+}
+
+func (s *MemoryStore) nextId() int64 {
+	s.lastId++
+
+	return s.lastId
+}
+
+func findFilm(films []Film, provider string, filmId string, cinemaId string) int {
+	for i, f := range films {
+		if f.Provider == provider && f.Id == filmId && f.CinemaId == cinemaId {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *MemoryStore) FilmExists(provider string, filmId string, cinemaId string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return findFilm(s.films, provider, filmId, cinemaId) >= 0, nil
+}
+
+func (s *MemoryStore) GetFilmName(provider string, filmId string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.films {
+		if f.Provider == provider && f.Id == filmId {
+			return f.Name, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (s *MemoryStore) GetFilm(provider string, filmId string, cinemaId string) (*Film, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := findFilm(s.films, provider, filmId, cinemaId)
+	if i < 0 {
+		return nil, nil
+	}
+
+	return readFilm(s.films[i]), nil
+}
+
+func (s *MemoryStore) GetFilmByRowId(rowId int64) (*Film, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.films {
+		if f.RowId == rowId {
+			return readFilm(f), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// readFilm returns the film as the database backed stores read it, i.e. without its release date.
+func readFilm(f Film) *Film {
+	f.ReleaseDate = ""
+
+	return &f
+}
+
+func (s *MemoryStore) InsertFilm(film *Film) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if findFilm(s.films, film.Provider, film.Id, film.CinemaId) >= 0 {
+		return 0, fmt.Errorf("film %s of %s exists already at cinema %s", film.Id, film.Provider, film.CinemaId)
+	}
+
+	film.RowId = s.nextId()
+	s.films = append(s.films, *film)
+
+	return 1, nil
+}
+
+func (s *MemoryStore) ClaimLegacyFilms(provider string, cinemaIds []string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var films []Film
+	var claimed int64
+	for _, f := range s.films {
+		if f.Provider != provider || f.CinemaId != "" {
+			films = append(films, f)
+			continue
+		}
+
+		for _, cinemaId := range cinemaIds {
+			if findFilm(s.films, provider, f.Id, cinemaId) >= 0 {
+				continue
+			}
+
+			copied := Film{RowId: s.nextId(), Provider: provider, Id: f.Id, CinemaId: cinemaId, Name: f.Name, OriginalName: f.OriginalName,
+				Link: f.Link, PosterLink: f.PosterLink, Notified: true}
+			films = append(films, copied)
+			claimed++
+		}
+	}
+	s.films = films
+
+	return claimed, nil
+}
+
+func (s *MemoryStore) SetFilmNotified(rowId int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return setNotified(s.films, rowId), nil
+}
+
+func (s *MemoryStore) GetAgeRatings() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool)
+
+	var data []string
+
+	for _, f := range s.films {
+		if len(f.AgeRating) > 0 && !seen[f.AgeRating] {
+			seen[f.AgeRating] = true
+			data = append(data, f.AgeRating)
+		}
+	}
+
+	sort.Strings(data)
+
+	return data, nil
+}
+
+func (s *MemoryStore) GetUpcomingFilm(provider string, filmId string, cinemaId string) (*Film, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := findFilm(s.upcomingFilms, provider, filmId, cinemaId)
+	if i < 0 {
+		return nil, nil
+	}
+
+	f := s.upcomingFilms[i]
+
+	return &Film{RowId: f.RowId, Provider: f.Provider, Id: f.Id, CinemaId: f.CinemaId, Name: f.Name, OriginalName: f.OriginalName,
+		Link: f.Link, PosterLink: f.PosterLink, ReleaseDate: f.ReleaseDate, Notified: f.Notified}, nil
+}
+
+func (s *MemoryStore) GetUpcomingFilmByRowId(rowId int64) (*Film, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.upcomingFilms {
+		if f.RowId == rowId {
+			return &Film{RowId: f.RowId, Provider: f.Provider, Id: f.Id, CinemaId: f.CinemaId, Name: f.Name, OriginalName: f.OriginalName,
+				Link: f.Link, PosterLink: f.PosterLink, ReleaseDate: f.ReleaseDate, Notified: f.Notified}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *MemoryStore) InsertUpcomingFilm(film *Film) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if findFilm(s.upcomingFilms, film.Provider, film.Id, film.CinemaId) >= 0 {
+		return 0, fmt.Errorf("upcoming film %s of %s exists already at cinema %s", film.Id, film.Provider, film.CinemaId)
+	}
+
+	film.RowId = s.nextId()
+	s.upcomingFilms = append(s.upcomingFilms, *film)
+
+	return 1, nil
+}
+
+func (s *MemoryStore) SetUpcomingFilmNotified(rowId int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return setNotified(s.upcomingFilms, rowId), nil
+}
+
+func setNotified(films []Film, rowId int64) int64 {
+	for i := range films {
+		if films[i].RowId == rowId {
+			films[i].Notified = true
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (s *MemoryStore) InsertEvent(e *Event) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range s.events {
+		if event.Provider == e.Provider && event.Id == e.Id {
+			return 0, nil
+		}
+	}
+
+	s.events = append(s.events, *e)
+
+	return 1, nil
+}
+
+func (s *MemoryStore) GetUpcomingEvents(provider string, filmId string, cinemaId string, after string, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var data []Event
+
+	for _, e := range s.events {
+		if e.Provider == provider && e.FilmId == filmId && e.CinemaId == cinemaId && e.DateTime > after {
+			data = append(data, e)
+		}
+	}
+
+	sort.SliceStable(data, func(i, j int) bool {
+		return data[i].DateTime < data[j].DateTime
+	})
+
+	if limit >= 0 && len(data) > limit {
+		data = data[:limit]
+	}
+
+	return data, nil
+}
+
+func (s *MemoryStore) GetFilmsWithEvents(provider string, cinemaId string) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := make(map[string]bool)
+
+	for _, e := range s.events {
+		if e.Provider == provider && e.CinemaId == cinemaId {
+			data[e.FilmId] = true
+		}
+	}
+
+	return data, nil
+}
+
+func (s *MemoryStore) GetEventsHorizon(provider string, cinemaId string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.eventsHorizons[eventsHorizonSetting(provider, cinemaId)], nil
+}
+
+func (s *MemoryStore) SetEventsHorizon(provider string, cinemaId string, day string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.eventsHorizons == nil {
+		s.eventsHorizons = make(map[string]string)
+	}
+	s.eventsHorizons[eventsHorizonSetting(provider, cinemaId)] = day
+
+	return 1, nil
+}
+
+func (s *MemoryStore) InsertMessage(m *Message) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, message := range s.messages {
+		if message.ChatId == m.ChatId && message.MessageId == m.MessageId && message.Text == m.Text {
+			return 0, nil
+		}
+	}
+
+	s.messages = append(s.messages, *m)
+
+	return 1, nil
+}
+
+// findChat returns the chat, or nil if it doesn't exist.
+func (s *MemoryStore) findChat(chatId int, userId int) *memoryChat {
+	for _, c := range s.chats {
+		if c.chatId == chatId && c.userId == userId {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// chatsMatch reports whether any of the records of the chat, regardless of the user, passes the test.
+func (s *MemoryStore) chatsMatch(chatId int, test func(c *memoryChat) bool) bool {
+	for _, c := range s.chats {
+		if c.chatId == chatId && test(c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// updateChat applies the update to the chat, if it exists.
+func (s *MemoryStore) updateChat(chatId int, userId int, update func(c *memoryChat)) int64 {
+	c := s.findChat(chatId, userId)
+	if c == nil {
+		return 0
+	}
+
+	update(c)
+
+	return 1
+}
+
+func (s *MemoryStore) UpdateChatStatus(chatId int, userId int, status ChatStatus) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.findChat(chatId, userId)
+	if c == nil {
+		c = &memoryChat{chatId: chatId, userId: userId, subscribed: true, onSaleAlerts: true}
+		s.chats = append(s.chats, c)
+	}
+
+	c.status = status
+
+	return 1, nil
+}
+
+func (s *MemoryStore) GetChatStatus(chatId int, userId int) (ChatStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.findChat(chatId, userId)
+	if c == nil {
+		return ChatIdle, nil
+	}
+
+	return c.status, nil
+}
+
+// IsSubscribed reports whether the chat is subscribed; it isn't part of `Store`, being only meant for tests.
+func (s *MemoryStore) IsSubscribed(chatId int, userId int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.findChat(chatId, userId)
+
+	return c != nil && c.subscribed
+}
+
+func (s *MemoryStore) Subscribe(chatId int, userId int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a chat subscribing again has unblocked the bot, if it was blocked
+	return s.updateChat(chatId, userId, func(c *memoryChat) {
+		c.subscribed = true
+		c.blocked = false
+	}), nil
+}
+
+func (s *MemoryStore) Unsubscribe(chatId int, userId int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateChat(chatId, userId, func(c *memoryChat) {
+		c.subscribed = false
+	}), nil
+}
+
+func (s *MemoryStore) SetChatBlocked(chatId int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rowsAffected int64
+
+	for _, c := range s.chats {
+		if c.chatId == chatId {
+			c.blocked = true
+			rowsAffected++
+		}
+	}
+
+	return rowsAffected, nil
+}
+
+func (s *MemoryStore) GetChatCountry(chatId int, userId int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.findChat(chatId, userId)
+	if c == nil {
+		return "", nil
+	}
+
+	return c.country, nil
+}
+
+func (s *MemoryStore) SetChatCountry(chatId int, userId int, country string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateChat(chatId, userId, func(c *memoryChat) {
+		c.country = country
+	}), nil
+}
+
+func (s *MemoryStore) GetChatAlerts(chatId int, userId int) (map[Alert]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getChatAlerts(chatId, userId), nil
+}
+
+func (s *MemoryStore) getChatAlerts(chatId int, userId int) map[Alert]bool {
+	alerts := map[Alert]bool{
+		AlertAnnouncement: false,
+		AlertOnSale:       true,
+	}
+
+	c := s.findChat(chatId, userId)
+	if c != nil {
+		alerts[AlertAnnouncement] = c.announcementAlerts
+		alerts[AlertOnSale] = c.onSaleAlerts
+	}
+
+	return alerts
+}
+
+func (s *MemoryStore) ToggleChatAlert(chatId int, userId int, alert Alert) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := alertColumns[alert]; !ok {
+		return false, fmt.Errorf("unknown alert %d", alert)
+	}
+
+	enabled := !s.getChatAlerts(chatId, userId)[alert]
+
+	s.updateChat(chatId, userId, func(c *memoryChat) {
+		if alert == AlertAnnouncement {
+			c.announcementAlerts = enabled
+		} else {
+			c.onSaleAlerts = enabled
+		}
+	})
+
+	return enabled, nil
+}
+
+func (s *MemoryStore) GetChatCinemas(chatId int) ([]ChatCinema, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var data []ChatCinema
+
+	for _, r := range s.chatCinemas {
+		if r.chatId == chatId {
+			data = append(data, ChatCinema{Provider: r.provider, CinemaId: r.id})
+		}
+	}
+
+	return data, nil
+}
+
+func (s *MemoryStore) ToggleChatCinema(chatId int, provider string, cinemaId string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var selected bool
+	s.chatCinemas, selected = toggleRow(s.chatCinemas, memoryChatRow{chatId: chatId, provider: provider, id: cinemaId})
+
+	return selected, nil
+}
+
+func (s *MemoryStore) ToggleMutedFilm(chatId int, provider string, filmId string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var muted bool
+	s.mutedFilms, muted = toggleRow(s.mutedFilms, memoryChatRow{chatId: chatId, provider: provider, id: filmId})
+
+	return muted, nil
+}
+
+// toggleRow removes the row from the rows, or appends it if it was missing.
+// It returns the rows along with whether the row is among them after the operation.
+func toggleRow(rows []memoryChatRow, row memoryChatRow) ([]memoryChatRow, bool) {
+	for i, r := range rows {
+		if r == row {
+			return append(rows[:i], rows[i+1:]...), false
+		}
+	}
+
+	return append(rows, row), true
+}
+
+func hasRow(rows []memoryChatRow, row memoryChatRow) bool {
+	for _, r := range rows {
+		if r == row {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *MemoryStore) SetPendingWatcher(chatId int, userId int, keywords string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateChat(chatId, userId, func(c *memoryChat) {
+		c.pendingWatcher = keywords
+	}), nil
+}
+
+func (s *MemoryStore) GetPendingWatcher(chatId int, userId int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.findChat(chatId, userId)
+	if c == nil {
+		return "", nil
+	}
+
+	return c.pendingWatcher, nil
+}
+
+// findWatcher returns the chat's watcher having the keywords, regardless of case, or nil if there's none.
+func (s *MemoryStore) findWatcher(chatId int, keywords string) *memoryWatcher {
+	for _, w := range s.watchers {
+		if w.chatId == chatId && strings.EqualFold(w.keywords, keywords) {
+			return w
+		}
+	}
+
+	return nil
+}
+
+// chatWatchers returns the chat's watchers passing the test, ordered by their keywords regardless of case.
+func (s *MemoryStore) chatWatchers(chatId int, test func(w *memoryWatcher) bool) []*memoryWatcher {
+	var data []*memoryWatcher
+
+	for _, w := range s.watchers {
+		if w.chatId == chatId && test(w) {
+			data = append(data, w)
+		}
+	}
+
+	sort.SliceStable(data, func(i, j int) bool {
+		return strings.ToLower(data[i].keywords) < strings.ToLower(data[j].keywords)
+	})
+
+	return data
+}
+
+func (s *MemoryStore) InsertWatcher(chatId int, keywords string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keywords = strings.Trim(keywords, " ")
+
+	pattern, isPattern := ParsePattern(keywords)
+
+	var terms []watcherTerm
+
+	if isPattern {
+		// the chat's pattern watchers are counted under the same lock as the insert
+		if _, err := CompilePattern(pattern); err != nil || s.countPatternWatchers(chatId) >= MaxPatternWatchers {
+			return 0, nil
+		}
+	} else {
+		terms = splitTerms(keywords)
+		if len(terms) == 0 {
+			return 0, nil
+		}
+	}
+
+	if s.findWatcher(chatId, keywords) != nil {
+		return 0, nil
+	}
+
+	s.watchers = append(s.watchers, &memoryWatcher{id: s.nextId(), chatId: chatId, keywords: keywords, terms: terms, pattern: pattern})
+
+	return 1, nil
+}
+
+func (s *MemoryStore) RemoveWatcher(chatId int, keywords string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removeWatchers(func(w *memoryWatcher) bool {
+		return w.chatId == chatId && w.keywords == keywords
+	}), nil
+}
+
+func (s *MemoryStore) RemoveWatcherById(chatId int, watcherId int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removeWatchers(func(w *memoryWatcher) bool {
+		return w.chatId == chatId && w.id == watcherId
+	}), nil
+}
+
+func (s *MemoryStore) removeWatchers(test func(w *memoryWatcher) bool) int64 {
+	var rowsAffected int64
+
+	kept := s.watchers[:0]
+	for _, w := range s.watchers {
+		if test(w) {
+			rowsAffected++
+			continue
+		}
+
+		kept = append(kept, w)
+	}
+	s.watchers = kept
+
+	return rowsAffected
+}
+
+func (s *MemoryStore) GetWatchers(chatId int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return watcherKeywords(s.chatWatchers(chatId, func(w *memoryWatcher) bool {
+		return true
+	})), nil
+}
+
+func (s *MemoryStore) GetWatchersWithNewScreenings(chatId int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return watcherKeywords(s.chatWatchers(chatId, func(w *memoryWatcher) bool {
+		return w.newScreenings
+	})), nil
+}
+
+func watcherKeywords(watchers []*memoryWatcher) []string {
+	var data []string
+
+	for _, w := range watchers {
+		data = append(data, w.keywords)
+	}
+
+	return data
+}
+
+func (s *MemoryStore) GetWatcherList(chatId int) ([]Watcher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var data []Watcher
+
+	for _, w := range s.chatWatchers(chatId, func(w *memoryWatcher) bool {
+		return true
+	}) {
+		data = append(data, Watcher{Id: w.id, Keywords: w.keywords, Filters: w.filters, Strictness: w.strictness})
+	}
+
+	return data, nil
+}
+
+func (s *MemoryStore) ToggleWatcherNewScreenings(chatId int, keywords string) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.findWatcher(chatId, keywords)
+	if w == nil {
+		return 0, false, nil
+	}
+
+	w.newScreenings = !w.newScreenings
+
+	return 1, w.newScreenings, nil
+}
+
+func (s *MemoryStore) SetWatcherFilter(chatId int, keywords string, filter WatcherFilter, value string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := filterColumns[filter]; !ok {
+		return 0, fmt.Errorf("unknown watcher filter %d", filter)
+	}
+
+	w := s.findWatcher(chatId, keywords)
+	if w == nil {
+		return 0, nil
+	}
+
+	switch filter {
+	case FilterFormat:
+		w.filters.Format = value
+	case FilterAudio:
+		w.filters.Audio = value
+	case FilterSubtitles:
+		w.filters.Subtitles = value
+	case FilterAgeRating:
+		w.filters.AgeRating = value
+	}
+
+	return 1, nil
+}
+
+func (s *MemoryStore) CountPatternWatchers(chatId int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.countPatternWatchers(chatId), nil
+}
+
+func (s *MemoryStore) countPatternWatchers(chatId int) int {
+	count := 0
+	for _, w := range s.watchers {
+		if w.chatId == chatId && len(w.pattern) > 0 {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (s *MemoryStore) SetWatcherStrictness(chatId int, keywords string, strictness Strictness) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.findWatcher(chatId, keywords)
+	if w == nil {
+		return 0, nil
+	}
+
+	w.strictness = strictness
+
+	return 1, nil
+}
+
+func (s *MemoryStore) GetWatchersFilters(chatId int) (map[string]WatcherFilters, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := make(map[string]WatcherFilters)
+
+	for _, w := range s.watchers {
+		if w.chatId == chatId {
+			data[w.keywords] = w.filters
+		}
+	}
+
+	return data, nil
+}
+
+func (s *MemoryStore) GetWatchersMatchingQuery(q MatchQuery) ([]WatcherMatch, error) {
+	return s.getWatchersMatchingQuery(q, matchOnSale)
+}
+
+func (s *MemoryStore) GetAnnouncementWatchersMatchingQuery(q MatchQuery) ([]WatcherMatch, error) {
+	return s.getWatchersMatchingQuery(q, matchAnnouncement)
+}
+
+func (s *MemoryStore) GetNewScreeningsWatchersMatchingQuery(q MatchQuery) ([]WatcherMatch, error) {
+	return s.getWatchersMatchingQuery(q, matchNewScreenings)
+}
+
+func (s *MemoryStore) getWatchersMatchingQuery(q MatchQuery, kind matchKind) ([]WatcherMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var candidates []matchCandidate
+
+	// the terms are prefiltered like by the database backed stores
+	trigrams := matchingTrigrams(NormaliseString(strings.Join(q.Names, " ")))
+
+	for _, w := range s.watchers {
+		if !s.chatWantsFilm(w, q, kind) {
+			continue
+		}
+
+		if len(w.pattern) > 0 {
+			re, err := storedPattern(w.pattern)
+			if err != nil {
+				continue
+			}
+
+			candidates = append(candidates, matchCandidate{
+				WatcherMatch: WatcherMatch{ChatId: w.chatId, WatcherId: w.id, Keywords: w.keywords, Strictness: w.strictness, Term: w.pattern},
+				filters:      w.filters,
+				pattern:      re,
+			})
+			continue
+		}
+
+		for _, t := range w.terms {
+			if !isCandidateTerm(t.normalised, trigrams) {
+				continue
+			}
+
+			candidates = append(candidates, matchCandidate{
+				WatcherMatch:   WatcherMatch{ChatId: w.chatId, WatcherId: w.id, Keywords: w.keywords, Strictness: w.strictness, Term: t.term},
+				termNormalised: t.normalised,
+				filters:        w.filters,
+			})
+		}
+	}
+
+	return selectMatches(candidates, q), nil
+}
+
+// chatWantsFilm tells whether the watcher's chat wants to be notified about the film, should the watcher match it.
+func (s *MemoryStore) chatWantsFilm(w *memoryWatcher, q MatchQuery, kind matchKind) bool {
+	hasCinemas := false
+	for _, r := range s.chatCinemas {
+		if r.chatId == w.chatId {
+			hasCinemas = true
+			break
+		}
+	}
+
+	if hasCinemas && !hasRow(s.chatCinemas, memoryChatRow{chatId: w.chatId, provider: q.Provider, id: q.CinemaId}) {
+		return false
+	}
+
+	if hasRow(s.mutedFilms, memoryChatRow{chatId: w.chatId, provider: q.Provider, id: q.FilmId}) {
+		return false
+	}
+
+	if s.chatsMatch(w.chatId, func(c *memoryChat) bool {
+		return c.blocked || (len(c.country) > 0 && c.country != q.Country)
+	}) {
+		return false
+	}
+
+	switch kind {
+	case matchOnSale:
+		return !s.chatsMatch(w.chatId, func(c *memoryChat) bool {
+			return !c.onSaleAlerts
+		})
+	case matchAnnouncement:
+		return s.chatsMatch(w.chatId, func(c *memoryChat) bool {
+			return c.announcementAlerts
+		})
+	default:
+		return w.newScreenings
+	}
+}
+
+func (s *MemoryStore) GetUpdatesOffset() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updatesOffset, nil
+}
+
+func (s *MemoryStore) SetUpdatesOffset(offset int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updatesOffset = offset
+
+	return 1, nil
+}
+
+func (s *MemoryStore) IsUpdateProcessed(updateId int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.processedUpdates[updateId]
+
+	return ok, nil
+}
+
+func (s *MemoryStore) SetUpdateProcessed(updateId int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	if s.processedUpdates == nil {
+		s.processedUpdates = make(map[int]time.Time)
+	}
+
+	for id, at := range s.processedUpdates {
+		if at.Before(now.Add(-processedUpdatesRetention)) {
+			delete(s.processedUpdates, id)
+		}
+	}
+
+	if _, ok := s.processedUpdates[updateId]; ok {
+		return 0, nil
+	}
+	s.processedUpdates[updateId] = now
+
+	return 1, nil
+}
+
+func (s *MemoryStore) InsertNotification(chatId int, payload string, about NotifiedFilm, match WatcherMatch) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sent := range s.sentNotifications {
+		if sent.chatId == chatId && sent.about.Provider == about.Provider && sent.about.FilmId == about.FilmId &&
+			sent.about.CinemaId == about.CinemaId && sent.about.Reason == about.Reason {
+			return 0, nil
+		}
+	}
+
+	n := &memoryNotification{
+		Notification:  Notification{Id: s.nextId(), ChatId: chatId, Payload: payload},
+		status:        NotificationPending,
+		nextAttemptAt: time.Now(),
+	}
+	s.notifications = append(s.notifications, n)
+	s.sentNotifications = append(s.sentNotifications, &memorySentNotification{id: s.nextId(), chatId: chatId, about: about, match: match, notificationId: n.Id})
+
+	return 1, nil
+}
+
+func (s *MemoryStore) findNotification(id int64) *memoryNotification {
+	for _, n := range s.notifications {
+		if n.Id == id {
+			return n
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) GetNotificationHistory(chatId int, limit int) ([]SentNotification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sent []*memorySentNotification
+
+	for _, entry := range s.sentNotifications {
+		n := s.findNotification(entry.notificationId)
+		if entry.chatId == chatId && n != nil && n.status == NotificationSent {
+			sent = append(sent, entry)
+		}
+	}
+
+	sort.SliceStable(sent, func(i, j int) bool {
+		a, b := s.findNotification(sent[i].notificationId).sentAt, s.findNotification(sent[j].notificationId).sentAt
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+
+		return sent[i].id > sent[j].id
+	})
+
+	var data []SentNotification
+
+	for i, entry := range sent {
+		if i == limit {
+			break
+		}
+
+		data = append(data, SentNotification{NotifiedFilm: entry.about, Match: entry.match, SentAt: s.findNotification(entry.notificationId).sentAt})
+	}
+
+	return data, nil
+}
+
+func (s *MemoryStore) ClaimNotifications(limit int) ([]Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	var data []Notification
+
+	// the notifications are kept ordered by id
+	for _, n := range s.notifications {
+		if len(data) == limit {
+			break
+		}
+
+		if n.status == NotificationPending && !n.nextAttemptAt.After(now) {
+			n.status = NotificationClaimed
+			data = append(data, n.Notification)
+		}
+	}
+
+	return data, nil
+}
+
+func (s *MemoryStore) ReleaseClaimedNotifications() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rowsAffected int64
+
+	for _, n := range s.notifications {
+		switch n.status {
+		case NotificationSending:
+			n.status = NotificationFailed
+			n.lastError = interruptedNotificationError
+		case NotificationClaimed:
+			n.status = NotificationPending
+			rowsAffected++
+		}
+	}
+
+	return rowsAffected, nil
+}
+
+func (s *MemoryStore) MarkNotificationSending(id int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.findNotification(id)
+	if n == nil {
+		return 0, nil
+	}
+
+	n.status = NotificationSending
+
+	return 1, nil
+}
+
+func (s *MemoryStore) MarkNotificationSent(id int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.findNotification(id)
+	if n == nil {
+		return 0, nil
+	}
+
+	n.status = NotificationSent
+	n.Attempts++
+	n.sentAt = time.Now()
+
+	return 1, nil
+}
+
+func (s *MemoryStore) MarkNotificationFailed(id int64, reason string, retryAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.findNotification(id)
+	if n == nil {
+		return 0, nil
+	}
+
+	n.status = NotificationPending
+	if retryAt.IsZero() {
+		n.status = NotificationFailed
+	}
+	n.Attempts++
+	n.nextAttemptAt = retryAt
+	n.lastError = reason
+
+	return 1, nil
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema changes of each database, one file per version, named `<version>_<name>.sql`.
+// A migration must never be edited once released; any further change goes into a new file.
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// Migration is a versioned change of the database schema.
+type Migration struct {
+	Version int
+	Name    string
+	// AppliedAt is zero while the migration is pending.
+	AppliedAt time.Time
+	sql       string
+}
+
+// migrator applies the migrations found in one of the directories of `migrationFiles`.
+type migrator struct {
+	db  *sql.DB
+	dir string
+	// createTable creates the table keeping track of the applied migrations.
+	createTable string
+	// tableExists counts the tables having the name given as its only parameter.
+	tableExists string
+	// legacyTable is a table found in the databases created before the migrations were introduced,
+	// which are considered to have the initial schema applied; it is empty if there are no such databases.
+	legacyTable string
+	// dataMigrations change the data in ways SQL can't express, keyed by the version of the migration they follow;
+	// each runs in the transaction of its migration.
+	dataMigrations map[int]func(tx *sql.Tx) error
+}
+
+// loadMigrations returns the embedded migrations of the given directory, ordered by version.
+func loadMigrations(dir string) ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+
+	for _, entry := range entries {
+		parts := strings.SplitN(strings.TrimSuffix(entry.Name(), ".sql"), "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if len(parts) != 2 || err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: parts[1], sql: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// prepare creates the table keeping track of the applied migrations, if it doesn't exist yet.
+func (m migrator) prepare() error {
+	exists, err := m.hasTable("schema_migrations")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	legacy := false
+	if len(m.legacyTable) > 0 {
+		legacy, err = m.hasTable(m.legacyTable)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = m.db.Exec(m.createTable)
+	if err != nil {
+		return err
+	}
+
+	if legacy {
+		_, err = m.db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (1, 'init', $1)", time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m migrator) hasTable(name string) (bool, error) {
+	var count int
+	err := m.db.QueryRow(m.tableExists, name).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// status returns all the migrations, ordered by version, telling which of them have been applied.
+func (m migrator) status() ([]Migration, error) {
+	migrations, err := loadMigrations(m.dir)
+	if err != nil {
+		return nil, fmt.Errorf("loading migrations: %v", err)
+	}
+
+	err = m.prepare()
+	if err != nil {
+		return nil, fmt.Errorf("preparing migrations: %v", err)
+	}
+
+	rows, err := m.db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("fetching applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("reading applied migrations: %v", err)
+		}
+
+		applied[version] = appliedAt
+	}
+
+	for i, migration := range migrations {
+		migrations[i].AppliedAt = applied[migration.Version]
+		delete(applied, migration.Version)
+	}
+
+	// the database was migrated by a newer release, which this one can't tell anything about
+	if len(applied) > 0 {
+		return nil, fmt.Errorf("the database has %d migrations unknown to this release", len(applied))
+	}
+
+	return migrations, nil
+}
+
+// migrate applies the pending migrations in order, each in its own transaction, and returns them.
+// It stops at the first failing migration, leaving the database as the previous migration left it.
+func (m migrator) migrate() ([]Migration, error) {
+	migrations, err := m.status()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+
+	for _, migration := range migrations {
+		if !migration.AppliedAt.IsZero() {
+			continue
+		}
+
+		migration.AppliedAt = time.Now()
+
+		err = m.apply(migration)
+		if err != nil {
+			return applied, fmt.Errorf("applying migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+func (m migrator) apply(migration Migration) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(migration.sql)
+	if err != nil {
+		return err
+	}
+
+	if dataMigration, ok := m.dataMigrations[migration.Version]; ok {
+		err = dataMigration(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)", migration.Version, migration.Name, migration.AppliedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrator returns the migrator of the sqlite database; the databases created before the migrations were introduced
+// are recognised by their `films` table.
+func (s *SQLiteStore) migrator() migrator {
+	return migrator{
+		db:  s.db,
+		dir: "migrations/sqlite",
+		createTable: `CREATE TABLE schema_migrations
+			(
+				version    INTEGER PRIMARY KEY,
+				name       VARCHAR(255),
+				applied_at DATETIME NULL
+			)`,
+		tableExists: "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1",
+		legacyTable: "films",
+		dataMigrations: map[int]func(tx *sql.Tx) error{
+			5: splitLegacyWatchersTerms,
+			6: splitLegacyWatchersTerms,
+			8: splitLegacyWatchersTerms,
+		},
+	}
+}
+
+// GetMigrations returns all the migrations, ordered by version, telling which of them have been applied.
+func (s *SQLiteStore) GetMigrations() ([]Migration, error) {
+	return s.migrator().status()
+}
+
+// Migrate applies the pending migrations in order, each in its own transaction, and returns them.
+// It stops at the first failing migration, leaving the database as the previous migration left it.
+func (s *SQLiteStore) Migrate() ([]Migration, error) {
+	return s.migrator().migrate()
+}
@@ -0,0 +1,184 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE TABLE films
+(
+    id                 BIGSERIAL PRIMARY KEY,
+    provider           VARCHAR(64),
+    original_id        VARCHAR(64),
+    cinema_id          VARCHAR(64),
+    name               VARCHAR(255),
+    original_name      VARCHAR(255),
+    link               TEXT,
+    poster_link        TEXT,
+    release_date       VARCHAR(10),
+    notified           BOOLEAN DEFAULT FALSE,
+    length             INT DEFAULT 0,
+    release_year       VARCHAR(4) DEFAULT '',
+    genres             TEXT DEFAULT '',
+    age_rating         VARCHAR(16) DEFAULT '',
+    formats            TEXT DEFAULT '',
+    original_language  VARCHAR(8) DEFAULT '',
+    dubbed_languages   TEXT DEFAULT '',
+    subtitle_languages TEXT DEFAULT '',
+    created_at         TIMESTAMPTZ NULL
+);
+
+CREATE UNIQUE INDEX films_provider_original_id_cinema_id_index ON films (provider, original_id, cinema_id);
+CREATE INDEX films_name_index ON films (name);
+CREATE INDEX films_created_at_index ON films (created_at);
+
+CREATE TABLE upcoming_films
+(
+    id            BIGSERIAL PRIMARY KEY,
+    provider      VARCHAR(64),
+    original_id   VARCHAR(64),
+    cinema_id     VARCHAR(64),
+    name          VARCHAR(255),
+    original_name VARCHAR(255),
+    link          TEXT,
+    poster_link   TEXT,
+    release_date  VARCHAR(10),
+    notified      BOOLEAN DEFAULT FALSE,
+    created_at    TIMESTAMPTZ NULL
+);
+
+CREATE UNIQUE INDEX upcoming_films_provider_original_id_cinema_id_index ON upcoming_films (provider, original_id, cinema_id);
+CREATE INDEX upcoming_films_created_at_index ON upcoming_films (created_at);
+
+CREATE TABLE events
+(
+    provider           VARCHAR(64),
+    id                 VARCHAR(64),
+    film_id            VARCHAR(64),
+    cinema_id          VARCHAR(64),
+    business_day       VARCHAR(10),
+    event_date_time    VARCHAR(19),
+    booking_link       TEXT,
+    auditorium         VARCHAR(64),
+    formats            TEXT DEFAULT '',
+    dubbed_languages   TEXT DEFAULT '',
+    subtitle_languages TEXT DEFAULT '',
+    created_at         TIMESTAMPTZ NULL
+);
+
+CREATE UNIQUE INDEX events_provider_id_index ON events (provider, id);
+CREATE INDEX events_provider_film_id_cinema_id_index ON events (provider, film_id, cinema_id);
+CREATE INDEX events_event_date_time_index ON events (event_date_time);
+
+CREATE TABLE messages
+(
+    message_id      BIGINT,
+    from_id         BIGINT,
+    from_first_name VARCHAR(64),
+    chat_id         BIGINT,
+    chat_first_name VARCHAR(64),
+    text            TEXT,
+    created_at      TIMESTAMPTZ NULL
+);
+
+CREATE INDEX messages_message_id_index ON messages (message_id);
+CREATE INDEX messages_from_id_index ON messages (from_id);
+CREATE INDEX messages_chat_id_index ON messages (chat_id);
+CREATE INDEX messages_created_at_index ON messages (created_at);
+
+CREATE TABLE chats
+(
+    chat_id             BIGINT,
+    user_id             BIGINT,
+    subscribed          BOOLEAN DEFAULT TRUE,
+    status              SMALLINT DEFAULT 0,
+    country             VARCHAR(2) DEFAULT '',
+    announcement_alerts BOOLEAN DEFAULT FALSE,
+    on_sale_alerts      BOOLEAN DEFAULT TRUE,
+    pending_watcher     TEXT DEFAULT '',
+    blocked             BOOLEAN DEFAULT FALSE,
+    created_at          TIMESTAMPTZ NULL,
+    updated_at          TIMESTAMPTZ NULL
+);
+
+CREATE UNIQUE INDEX chats_chat_id_index ON chats (chat_id);
+CREATE INDEX chats_user_id_index ON chats (user_id);
+CREATE INDEX chats_subscribed_index ON chats (subscribed);
+CREATE INDEX chats_status_index ON chats (status);
+CREATE INDEX chats_created_at_index ON chats (created_at);
+CREATE INDEX chats_updated_at_index ON chats (updated_at);
+
+CREATE TABLE chat_cinemas
+(
+    chat_id    BIGINT,
+    provider   VARCHAR(64),
+    cinema_id  VARCHAR(64),
+    created_at TIMESTAMPTZ NULL
+);
+
+CREATE UNIQUE INDEX chat_cinemas_chat_id_provider_cinema_id_index ON chat_cinemas (chat_id, provider, cinema_id);
+CREATE INDEX chat_cinemas_provider_cinema_id_index ON chat_cinemas (provider, cinema_id);
+
+CREATE TABLE muted_films
+(
+    chat_id     BIGINT,
+    provider    VARCHAR(64),
+    original_id VARCHAR(64),
+    created_at  TIMESTAMPTZ NULL
+);
+
+CREATE UNIQUE INDEX muted_films_chat_id_provider_original_id_index ON muted_films (chat_id, provider, original_id);
+
+CREATE TABLE watchers
+(
+    id                  BIGSERIAL PRIMARY KEY,
+    chat_id             BIGINT,
+    keywords            TEXT,
+    keywords_normalised TEXT,
+    new_screenings      BOOLEAN DEFAULT FALSE,
+    filter_format       VARCHAR(16) DEFAULT '',
+    filter_audio        VARCHAR(16) DEFAULT '',
+    filter_subtitles    VARCHAR(16) DEFAULT '',
+    filter_age_rating   VARCHAR(16) DEFAULT '',
+    created_at          TIMESTAMPTZ NULL
+);
+
+CREATE INDEX watchers_chat_id_index ON watchers (chat_id);
+CREATE INDEX watchers_created_at_index ON watchers (created_at);
+-- serves the substring searches matching the watchers, like the trigram fts5 table does for sqlite
+CREATE INDEX watchers_keywords_normalised_trgm_index ON watchers USING gin (keywords_normalised gin_trgm_ops);
+
+CREATE TABLE settings
+(
+    name       VARCHAR(64) PRIMARY KEY,
+    value      TEXT,
+    updated_at TIMESTAMPTZ NULL
+);
+
+CREATE TABLE notifications
+(
+    id              BIGSERIAL PRIMARY KEY,
+    chat_id         BIGINT,
+    payload         TEXT,
+    status          SMALLINT DEFAULT 0,
+    attempts        INT DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NULL,
+    last_error      TEXT DEFAULT '',
+    created_at      TIMESTAMPTZ NULL,
+    sent_at         TIMESTAMPTZ NULL
+);
+
+CREATE INDEX notifications_status_next_attempt_at_index ON notifications (status, next_attempt_at);
+CREATE INDEX notifications_chat_id_index ON notifications (chat_id);
+
+CREATE TABLE sent_notifications
+(
+    id              BIGSERIAL PRIMARY KEY,
+    chat_id         BIGINT,
+    provider        VARCHAR(64),
+    film_id         VARCHAR(64),
+    reason          VARCHAR(64),
+    cinema_id       VARCHAR(64),
+    film_name       VARCHAR(255),
+    film_link       TEXT,
+    notification_id BIGINT NULL,
+    created_at      TIMESTAMPTZ NULL
+);
+
+CREATE UNIQUE INDEX sent_notifications_chat_id_provider_film_id_reason_index ON sent_notifications (chat_id, provider, film_id, reason);
+CREATE INDEX sent_notifications_notification_id_index ON sent_notifications (notification_id);
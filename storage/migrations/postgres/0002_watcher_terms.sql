@@ -0,0 +1,13 @@
+CREATE TABLE watcher_terms
+(
+    id              BIGSERIAL PRIMARY KEY,
+    watcher_id      BIGINT REFERENCES watchers (id) ON DELETE CASCADE,
+    term            TEXT,
+    term_normalised TEXT
+);
+
+CREATE INDEX watcher_terms_watcher_id_index ON watcher_terms (watcher_id);
+
+-- the watchers' terms are searched for, instead of their whole keywords
+DROP INDEX watchers_keywords_normalised_trgm_index;
+CREATE INDEX watcher_terms_term_normalised_trgm_index ON watcher_terms USING gin (term_normalised gin_trgm_ops);
@@ -0,0 +1,8 @@
+-- the updates handled already, so that an update delivered again by Telegram isn't handled twice
+CREATE TABLE processed_updates
+(
+    update_id  BIGINT PRIMARY KEY,
+    created_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX processed_updates_created_at_index ON processed_updates (created_at);
@@ -76,4 +76,4 @@ CREATE TRIGGER watcher_autodelete AFTER DELETE ON watchers
 BEGIN
     INSERT INTO watchers_fts (watchers_fts, rowid, keywords_normalised)
     VALUES ('delete', old.id, old.keywords_normalised);
-END;
\ No newline at end of file
+END;
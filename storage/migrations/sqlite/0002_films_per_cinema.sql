@@ -0,0 +1,57 @@
+-- films are tracked per provider and cinema; the films stored before were found in the whole country's feed,
+-- so they are left without a cinema until claimed by the cinemas configured, see ClaimLegacyFilms
+ALTER TABLE `films` ADD COLUMN `provider` VARCHAR(64);
+ALTER TABLE `films` ADD COLUMN `cinema_id` VARCHAR(64);
+ALTER TABLE `films` ADD COLUMN `release_date` VARCHAR(10);
+ALTER TABLE `films` ADD COLUMN `notified` INT DEFAULT 0;
+ALTER TABLE `films` ADD COLUMN `length` INT DEFAULT 0;
+ALTER TABLE `films` ADD COLUMN `release_year` VARCHAR(4) DEFAULT '';
+ALTER TABLE `films` ADD COLUMN `genres` TEXT DEFAULT '';
+ALTER TABLE `films` ADD COLUMN `age_rating` VARCHAR(16) DEFAULT '';
+ALTER TABLE `films` ADD COLUMN `formats` TEXT DEFAULT '';
+ALTER TABLE `films` ADD COLUMN `original_language` VARCHAR(8) DEFAULT '';
+ALTER TABLE `films` ADD COLUMN `dubbed_languages` TEXT DEFAULT '';
+ALTER TABLE `films` ADD COLUMN `subtitle_languages` TEXT DEFAULT '';
+
+UPDATE `films` SET provider = 'cinemacity.ro', cinema_id = '', notified = 1;
+
+DROP INDEX films_original_id_index;
+CREATE UNIQUE INDEX films_provider_original_id_cinema_id_index ON `films` (provider, original_id, cinema_id);
+
+CREATE TABLE `upcoming_films`
+(
+    `id`            INTEGER PRIMARY KEY AUTOINCREMENT,
+    `provider`      VARCHAR(64),
+    `original_id`   VARCHAR(64),
+    `cinema_id`     VARCHAR(64),
+    `name`          VARCHAR(255),
+    `original_name` VARCHAR(255),
+    `link`          TEXT,
+    `poster_link`   TEXT,
+    `release_date`  VARCHAR(10),
+    `notified`      INT DEFAULT 0,
+    `created_at`    DATETIME NULL
+);
+
+CREATE UNIQUE INDEX upcoming_films_provider_original_id_cinema_id_index ON `upcoming_films` (provider, original_id, cinema_id);
+CREATE INDEX upcoming_films_created_at_index ON `upcoming_films` (created_at);
+
+CREATE TABLE `events`
+(
+    `provider`        VARCHAR(64),
+    `id`              VARCHAR(64),
+    `film_id`         VARCHAR(64),
+    `cinema_id`       VARCHAR(64),
+    `business_day`    VARCHAR(10),
+    `event_date_time` VARCHAR(19),
+    `booking_link`    TEXT,
+    `auditorium`      VARCHAR(64),
+    `formats`            TEXT DEFAULT '',
+    `dubbed_languages`   TEXT DEFAULT '',
+    `subtitle_languages` TEXT DEFAULT '',
+    `created_at`      DATETIME NULL
+);
+
+CREATE UNIQUE INDEX events_provider_id_index ON `events` (provider, id);
+CREATE INDEX events_provider_film_id_cinema_id_index ON `events` (provider, film_id, cinema_id);
+CREATE INDEX events_event_date_time_index ON `events` (event_date_time);
@@ -0,0 +1,32 @@
+ALTER TABLE `chats` ADD COLUMN `country` VARCHAR(2) DEFAULT '';
+ALTER TABLE `chats` ADD COLUMN `announcement_alerts` INT DEFAULT 0;
+ALTER TABLE `chats` ADD COLUMN `on_sale_alerts` INT DEFAULT 1;
+ALTER TABLE `chats` ADD COLUMN `pending_watcher` TEXT DEFAULT '';
+ALTER TABLE `chats` ADD COLUMN `blocked` INT DEFAULT 0;
+
+ALTER TABLE `watchers` ADD COLUMN `new_screenings` INT DEFAULT 0;
+ALTER TABLE `watchers` ADD COLUMN `filter_format` VARCHAR(16) DEFAULT '';
+ALTER TABLE `watchers` ADD COLUMN `filter_audio` VARCHAR(16) DEFAULT '';
+ALTER TABLE `watchers` ADD COLUMN `filter_subtitles` VARCHAR(16) DEFAULT '';
+ALTER TABLE `watchers` ADD COLUMN `filter_age_rating` VARCHAR(16) DEFAULT '';
+
+CREATE TABLE `chat_cinemas`
+(
+    `chat_id`    VARCHAR(64),
+    `provider`   VARCHAR(64),
+    `cinema_id`  VARCHAR(64),
+    `created_at` DATETIME NULL
+);
+
+CREATE UNIQUE INDEX chat_cinemas_chat_id_provider_cinema_id_index ON `chat_cinemas` (chat_id, provider, cinema_id);
+CREATE INDEX chat_cinemas_provider_cinema_id_index ON `chat_cinemas` (provider, cinema_id);
+
+CREATE TABLE `muted_films`
+(
+    `chat_id`     VARCHAR(64),
+    `provider`    VARCHAR(64),
+    `original_id` VARCHAR(64),
+    `created_at`  DATETIME NULL
+);
+
+CREATE UNIQUE INDEX muted_films_chat_id_provider_original_id_index ON `muted_films` (chat_id, provider, original_id);
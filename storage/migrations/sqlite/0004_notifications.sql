@@ -0,0 +1,39 @@
+CREATE TABLE `settings`
+(
+    `name`       VARCHAR(64) PRIMARY KEY,
+    `value`      TEXT,
+    `updated_at` DATETIME NULL
+);
+
+CREATE TABLE `notifications`
+(
+    `id`              INTEGER PRIMARY KEY AUTOINCREMENT,
+    `chat_id`         VARCHAR(64),
+    `payload`         TEXT,
+    `status`          INT DEFAULT 0,
+    `attempts`        INT DEFAULT 0,
+    `next_attempt_at` DATETIME NULL,
+    `last_error`      TEXT DEFAULT '',
+    `created_at`      DATETIME NULL,
+    `sent_at`         DATETIME NULL
+);
+
+CREATE INDEX notifications_status_next_attempt_at_index ON `notifications` (status, next_attempt_at);
+CREATE INDEX notifications_chat_id_index ON `notifications` (chat_id);
+
+CREATE TABLE `sent_notifications`
+(
+    `id`              INTEGER PRIMARY KEY AUTOINCREMENT,
+    `chat_id`         VARCHAR(64),
+    `provider`        VARCHAR(64),
+    `film_id`         VARCHAR(64),
+    `reason`          VARCHAR(64),
+    `cinema_id`       VARCHAR(64),
+    `film_name`       VARCHAR(255),
+    `film_link`       TEXT,
+    `notification_id` INTEGER NULL,
+    `created_at`      DATETIME NULL
+);
+
+CREATE UNIQUE INDEX sent_notifications_chat_id_provider_film_id_reason_index ON `sent_notifications` (chat_id, provider, film_id, reason);
+CREATE INDEX sent_notifications_notification_id_index ON `sent_notifications` (notification_id);
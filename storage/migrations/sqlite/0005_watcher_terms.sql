@@ -0,0 +1,33 @@
+CREATE TABLE `watcher_terms`
+(
+    `id`              INTEGER PRIMARY KEY AUTOINCREMENT,
+    `watcher_id`      INTEGER REFERENCES `watchers` (`id`) ON DELETE CASCADE,
+    `term`            TEXT,
+    `term_normalised` TEXT
+);
+
+CREATE INDEX watcher_terms_watcher_id_index ON `watcher_terms` (watcher_id);
+
+-- the watchers' terms are searched for, instead of their whole keywords
+DROP TRIGGER watcher_autoinsert;
+DROP TRIGGER watcher_autodelete;
+DROP TABLE watchers_fts;
+
+CREATE VIRTUAL TABLE watcher_terms_fts USING fts5(
+    term_normalised,
+    content='watcher_terms',
+    content_rowid='id',
+    tokenize="trigram"
+);
+
+CREATE TRIGGER watcher_term_autoinsert AFTER INSERT ON watcher_terms
+BEGIN
+    INSERT INTO watcher_terms_fts (rowid, term_normalised)
+    VALUES (new.id, new.term_normalised);
+END;
+
+CREATE TRIGGER watcher_term_autodelete AFTER DELETE ON watcher_terms
+BEGIN
+    INSERT INTO watcher_terms_fts (watcher_terms_fts, rowid, term_normalised)
+    VALUES ('delete', old.id, old.term_normalised);
+END;
@@ -0,0 +1,5 @@
+-- the terms are split again from the watchers' keywords, to be normalised by the current normaliser
+DELETE FROM watcher_terms;
+
+-- the watchers are matched by their terms instead
+ALTER TABLE watchers DROP COLUMN keywords_normalised;
@@ -0,0 +1,8 @@
+ALTER TABLE `watchers` ADD COLUMN `strictness` INT DEFAULT 0;
+
+-- the matches the chats were notified about, for tuning the fuzzy matching
+ALTER TABLE `sent_notifications` ADD COLUMN `watcher_id` INTEGER DEFAULT 0;
+ALTER TABLE `sent_notifications` ADD COLUMN `match_keywords` TEXT DEFAULT '';
+ALTER TABLE `sent_notifications` ADD COLUMN `match_term` TEXT DEFAULT '';
+ALTER TABLE `sent_notifications` ADD COLUMN `match_strictness` INT DEFAULT 0;
+ALTER TABLE `sent_notifications` ADD COLUMN `match_score` REAL DEFAULT 0;
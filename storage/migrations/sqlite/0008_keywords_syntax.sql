@@ -0,0 +1,2 @@
+-- the terms are split again from the watchers' keywords, which may now have quotes, `OR` and exclusions
+DELETE FROM watcher_terms;
@@ -0,0 +1 @@
+ALTER TABLE `watchers` ADD COLUMN `pattern` TEXT DEFAULT '';
@@ -0,0 +1,3 @@
+-- the films of a provider may have the same ids at all its cinemas, so each cinema's notifications are told apart
+DROP INDEX sent_notifications_chat_id_provider_film_id_reason_index;
+CREATE UNIQUE INDEX sent_notifications_chat_id_film_cinema_reason_index ON `sent_notifications` (chat_id, provider, film_id, cinema_id, reason);
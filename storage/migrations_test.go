@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	for _, dir := range []string{"migrations/sqlite", "migrations/postgres"} {
+		migrations, err := loadMigrations(dir)
+		if err != nil {
+			t.Fatalf("Expected no error for %s, got %v", dir, err)
+		}
+
+		if len(migrations) == 0 || migrations[0].Name != "init" {
+			t.Fatalf("Expected the migrations of %s to start with init, got %+v", dir, migrations)
+		}
+
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("Expected migration %d in %s, got %d_%s", i+1, dir, m.Version, m.Name)
+			}
+
+			if len(strings.TrimSpace(m.sql)) == 0 || !m.AppliedAt.IsZero() {
+				t.Errorf("Expected migration %d_%s in %s to have statements and to be pending", m.Version, m.Name, dir)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestNormaliseString(t *testing.T) {
+	tables := []struct {
+		s        string
+		expected string
+	}{
+		{"Fight Club", "fight club"},
+		{"  Spider-Man:  No Way Home ", "spiderman no way home"},
+		{"Clubul bătăușilor", "clubul batausilor"},
+		{"Clubul bătăuşilor", "clubul batausilor"},
+		{"Țânțarul și ţânţarul", "tantarul si tantarul"},
+		// the diacritics typed as combining marks
+		{"Clubul ba\u0306ta\u0306us\u0326ilor", "clubul batausilor"},
+		{"Amélie", "amelie"},
+		{"1917", "1917"},
+		{"Blade Runner 2049", "blade runner 2049"},
+		{"Дюн: Част втора", "dyun chast vtora"},
+		{"Щастливи заедно", "shtastlivi zaedno"},
+		{"Η Μεγάλη Ομορφιά", "i megali omorfia"},
+		{"!?", ""},
+	}
+
+	for _, table := range tables {
+		if got := NormaliseString(table.s); got != table.expected {
+			t.Errorf("Expected %q for %q, got %q", table.expected, table.s, got)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NotificationStatus is the delivery state of a queued notification.
+type NotificationStatus int8
+
+const (
+	// NotificationPending is waiting to be sent, as soon as its next attempt is due.
+	NotificationPending NotificationStatus = iota
+	// NotificationClaimed is waiting for one of the workers to send it.
+	NotificationClaimed
+	NotificationSent
+	// NotificationFailed couldn't be delivered and won't be attempted anymore.
+	NotificationFailed
+	// NotificationSending is being sent by one of the workers; if the bot stops meanwhile, it isn't known whether
+	// it was delivered, so it is given up rather than risking sending it twice.
+	NotificationSending
+)
+
+// interruptedNotificationError is the error recorded for the notifications given up because the bot stopped while sending them.
+const interruptedNotificationError = "interrupted while being sent"
+
+// Notification is a message queued for being sent to a chat.
+type Notification struct {
+	Id     int64
+	ChatId int
+	// Payload is the JSON encoded Bot API method sending the message.
+	Payload  string
+	Attempts int
+}
+
+// NotificationReason tells why a chat is notified about a film.
+type NotificationReason string
+
+const (
+	ReasonOnSale       NotificationReason = "on_sale"
+	ReasonAnnouncement NotificationReason = "announcement"
+)
+
+// ReasonNewScreenings is the reason of the notifications about the given screenings, added for an already announced film,
+// so that a chat is told about the same screenings at most once; it identifies them by a digest of their ids.
+func ReasonNewScreenings(events []Event) NotificationReason {
+	ids := make([]string, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.Id)
+	}
+	sort.Strings(ids)
+
+	digest := sha1.Sum([]byte(strings.Join(ids, ",")))
+
+	return NotificationReason("new_screenings:" + hex.EncodeToString(digest[:8]))
+}
+
+// IsNewScreenings reports whether the reason was returned by `ReasonNewScreenings`.
+func (r NotificationReason) IsNewScreenings() bool {
+	return strings.HasPrefix(string(r), "new_screenings:")
+}
+
+// NotifiedFilm tells what a notification is about.
+type NotifiedFilm struct {
+	Provider string
+	FilmId   string
+	CinemaId string
+	FilmName string
+	FilmLink string
+	Reason   NotificationReason
+}
+
+// SentNotification is an entry of a chat's notification history.
+type SentNotification struct {
+	NotifiedFilm
+	// Match is the watcher match the chat was notified for.
+	Match  WatcherMatch
+	SentAt time.Time
+}
+
+// InsertNotification queues a notification for being sent to the chat, unless the chat was already notified about the same film
+// at the same cinema for the same reason; it returns 0 rows affected in the latter case. The watcher match the chat is notified for is recorded
+// along with the notification, so that the fuzzy matching can be tuned from the scores of the actual matches.
+func (s *SQLiteStore) InsertNotification(chatId int, payload string, about NotifiedFilm, match WatcherMatch) (int64, error) {
+	now := time.Now()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT OR IGNORE INTO sent_notifications (chat_id, provider, film_id, reason, cinema_id, film_name, film_link,
+			watcher_id, match_keywords, match_term, match_strictness, match_score, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		chatId, about.Provider, about.FilmId, about.Reason, about.CinemaId, about.FilmName, about.FilmLink,
+		match.WatcherId, match.Keywords, match.Term, match.Strictness, match.Score, now)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return 0, nil
+	}
+	sentId, _ := result.LastInsertId()
+
+	result, err = tx.Exec("INSERT INTO notifications (chat_id, payload, status, attempts, next_attempt_at, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		chatId, payload, NotificationPending, 0, now, now)
+	if err != nil {
+		return 0, err
+	}
+	notificationId, _ := result.LastInsertId()
+
+	_, err = tx.Exec("UPDATE sent_notifications SET notification_id = ? WHERE id = ?", notificationId, sentId)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+// GetNotificationHistory returns the last `limit` notifications delivered to the chat, the most recent first.
+func (s *SQLiteStore) GetNotificationHistory(chatId int, limit int) ([]SentNotification, error) {
+	rows, err := s.db.Query(`SELECT s.provider, s.film_id, s.cinema_id, s.film_name, s.film_link, s.reason, n.sent_at,
+			s.watcher_id, s.match_keywords, s.match_term, s.match_strictness, s.match_score
+		FROM sent_notifications s JOIN notifications n ON n.id = s.notification_id
+		WHERE s.chat_id = ? AND n.status = ?
+		ORDER BY n.sent_at DESC, s.id DESC LIMIT ?`, chatId, NotificationSent, limit)
+	if err != nil {
+		return nil, fmt.Errorf("fetching notification history: %v", err)
+	}
+	defer rows.Close()
+
+	var data []SentNotification
+
+	for rows.Next() {
+		var n SentNotification
+		err = rows.Scan(&n.Provider, &n.FilmId, &n.CinemaId, &n.FilmName, &n.FilmLink, &n.Reason, &n.SentAt,
+			&n.Match.WatcherId, &n.Match.Keywords, &n.Match.Term, &n.Match.Strictness, &n.Match.Score)
+		if err != nil {
+			return nil, fmt.Errorf("reading notification history: %v", err)
+		}
+		n.Match.ChatId = chatId
+
+		data = append(data, n)
+	}
+
+	return data, nil
+}
+
+// ClaimNotifications returns up to `limit` of the oldest notifications due for being sent,
+// marking them as claimed so they aren't returned again.
+func (s *SQLiteStore) ClaimNotifications(limit int) ([]Notification, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("claiming notifications: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, chat_id, payload, attempts FROM notifications WHERE status = ? AND next_attempt_at <= ? ORDER BY id LIMIT ?",
+		NotificationPending, time.Now(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("fetching notifications: %v", err)
+	}
+
+	var data []Notification
+
+	for rows.Next() {
+		var n Notification
+		err = rows.Scan(&n.Id, &n.ChatId, &n.Payload, &n.Attempts)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("reading notifications: %v", err)
+		}
+
+		data = append(data, n)
+	}
+	rows.Close()
+
+	for _, n := range data {
+		_, err = tx.Exec("UPDATE notifications SET status = ? WHERE id = ?", NotificationClaimed, n.Id)
+		if err != nil {
+			return nil, fmt.Errorf("claiming notifications: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("claiming notifications: %v", err)
+	}
+
+	return data, nil
+}
+
+// ReleaseClaimedNotifications puts back in the queue the notifications claimed, but not being sent yet, and gives up
+// the ones being sent, so that each notification is delivered at most once; it is meant to be called on startup,
+// for resuming the deliveries interrupted by a restart. It returns how many notifications were put back.
+func (s *SQLiteStore) ReleaseClaimedNotifications() (int64, error) {
+	_, err := s.db.Exec("UPDATE notifications SET status = ?, last_error = ? WHERE status = ?", NotificationFailed, interruptedNotificationError, NotificationSending)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := s.db.Exec("UPDATE notifications SET status = ? WHERE status = ?", NotificationPending, NotificationClaimed)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
+
+// MarkNotificationSending records that the notification is about to be sent; from then on, it isn't put back in the queue
+// by `ReleaseClaimedNotifications`.
+func (s *SQLiteStore) MarkNotificationSending(id int64) (int64, error) {
+	result, err := s.db.Exec("UPDATE notifications SET status = ? WHERE id = ?", NotificationSending, id)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
+
+// MarkNotificationSent records the delivery of the notification.
+func (s *SQLiteStore) MarkNotificationSent(id int64) (int64, error) {
+	result, err := s.db.Exec("UPDATE notifications SET status = ?, attempts = attempts + 1, sent_at = ? WHERE id = ?", NotificationSent, time.Now(), id)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
+
+// MarkNotificationFailed records a failed attempt to send the notification; the notification is attempted again at `retryAt`,
+// unless it is zero, in which case the notification is given up.
+func (s *SQLiteStore) MarkNotificationFailed(id int64, reason string, retryAt time.Time) (int64, error) {
+	status := NotificationPending
+	if retryAt.IsZero() {
+		status = NotificationFailed
+	}
+
+	result, err := s.db.Exec("UPDATE notifications SET status = ?, attempts = attempts + 1, next_attempt_at = ?, last_error = ? WHERE id = ?", status, retryAt, reason, id)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
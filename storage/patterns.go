@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync"
+)
+
+// PatternPrefix starts the keywords of the watchers matching the films' names against a regular expression,
+// instead of looking up terms in them, e.g. `re: ^Star Wars` or `re: (Ghibli|Miyazaki)`; the prefix is lowercase and
+// followed by a space, so that the names like `Re:Zero` are still looked up as terms.
+const PatternPrefix = "re: "
+
+const (
+	// MaxPatternWatchers is how many pattern watchers a chat can have, since they are evaluated against every film.
+	MaxPatternWatchers = 3
+	// maxPatternLength is the length of the longest pattern allowed, in characters.
+	maxPatternLength = 100
+	// maxPatternInstructions is the size of the largest compiled pattern allowed, which keeps its evaluation fast.
+	maxPatternInstructions = 500
+	// maxCompiledPatterns is how many compiled patterns are cached, well above the number of pattern watchers expected.
+	maxCompiledPatterns = 1000
+)
+
+// ParsePattern returns the regular expression of the keywords of a pattern watcher; `ok` is false for the other keywords.
+func ParsePattern(keywords string) (pattern string, ok bool) {
+	keywords = strings.TrimSpace(keywords)
+
+	if !strings.HasPrefix(keywords, PatternPrefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(keywords[len(PatternPrefix):]), true
+}
+
+// compiledPatterns caches the patterns of the stored watchers, which are evaluated against every film.
+var compiledPatterns = struct {
+	sync.Mutex
+	patterns map[string]*regexp.Regexp
+}{patterns: make(map[string]*regexp.Regexp)}
+
+// storedPattern returns the compiled pattern of a stored watcher, compiling it only once; the cache is emptied
+// once full, which also drops the patterns of the watchers deleted meanwhile.
+func storedPattern(pattern string) (*regexp.Regexp, error) {
+	compiledPatterns.Lock()
+	defer compiledPatterns.Unlock()
+
+	if re, ok := compiledPatterns.patterns[pattern]; ok {
+		return re, nil
+	}
+
+	re, err := CompilePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(compiledPatterns.patterns) >= maxCompiledPatterns {
+		compiledPatterns.patterns = make(map[string]*regexp.Regexp)
+	}
+	compiledPatterns.patterns[pattern] = re
+
+	return re, nil
+}
+
+// CompilePattern compiles the pattern of a watcher, unless it is empty, too long, too complex or invalid;
+// the error tells which, in terms meant for the chat.
+func CompilePattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) == 0 {
+		return nil, errors.New("the pattern is empty")
+	}
+
+	if len([]rune(pattern)) > maxPatternLength {
+		return nil, fmt.Errorf("the pattern is longer than %d characters", maxPatternLength)
+	}
+
+	parsed, err := syntax.Parse(pattern, syntax.Perl|syntax.FoldCase)
+	if err != nil {
+		var syntaxErr *syntax.Error
+		if errors.As(err, &syntaxErr) {
+			// the code leaves out the offending part of the pattern, which may break the markdown of the messages
+			return nil, errors.New(syntaxErr.Code.String())
+		}
+
+		return nil, err
+	}
+
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(prog.Inst) > maxPatternInstructions {
+		return nil, errors.New("the pattern is too complex")
+	}
+
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// matchesPattern reports whether the pattern matches any of the names, as given by the providers.
+func matchesPattern(re *regexp.Regexp, names []string) bool {
+	for _, name := range names {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanPatternCandidates reads the pattern watchers selected by a store, as
+// `watcher id, chat id, keywords, pattern` followed by the watcher's filters; the watchers having invalid patterns are skipped.
+func scanPatternCandidates(rows *sql.Rows) ([]matchCandidate, error) {
+	defer rows.Close()
+
+	var data []matchCandidate
+
+	for rows.Next() {
+		var c matchCandidate
+		err := rows.Scan(&c.WatcherId, &c.ChatId, &c.Keywords, &c.Term,
+			&c.filters.Format, &c.filters.Audio, &c.filters.Subtitles, &c.filters.AgeRating)
+		if err != nil {
+			return nil, fmt.Errorf("reading pattern watchers: %v", err)
+		}
+
+		c.pattern, err = storedPattern(c.Term)
+		if err != nil {
+			continue
+		}
+
+		data = append(data, c)
+	}
+
+	return data, nil
+}
+
+// CountPatternWatchers returns how many pattern watchers the chat has.
+func (s *SQLiteStore) CountPatternWatchers(chatId int) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM watchers WHERE chat_id=? AND pattern <> ''", chatId).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("counting pattern watchers: %v", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	tables := []struct {
+		keywords string
+		pattern  string
+		ok       bool
+	}{
+		{"re: ^Star Wars", "^Star Wars", true},
+		{"  re:  (Ghibli|Miyazaki) ", "(Ghibli|Miyazaki)", true},
+		{"re: ", "", false},
+		{"re:", "", false},
+		{"Re: ^Star Wars", "", false},
+		{"re:Zero", "", false},
+		{"Re:Zero", "", false},
+		{"Star Wars", "", false},
+		{"re", "", false},
+		{"Rebel Moon", "", false},
+	}
+
+	for _, table := range tables {
+		pattern, ok := ParsePattern(table.keywords)
+		if pattern != table.pattern || ok != table.ok {
+			t.Errorf("Expected pattern %q (%t) for %q, got %q (%t)", table.pattern, table.ok, table.keywords, pattern, ok)
+		}
+	}
+}
+
+func TestCompilePattern(t *testing.T) {
+	tables := []struct {
+		pattern string
+		err     string
+	}{
+		{"^Star Wars", ""},
+		{"(Ghibli|Miyazaki)", ""},
+		{"", "the pattern is empty"},
+		{strings.Repeat("a", maxPatternLength+1), "the pattern is longer than 100 characters"},
+		{"(Star Wars", "missing closing )"},
+		{"[a-z]{300}[0-9]{300}", "the pattern is too complex"},
+	}
+
+	for _, table := range tables {
+		_, err := CompilePattern(table.pattern)
+
+		if len(table.err) == 0 {
+			if err != nil {
+				t.Errorf("Expected %q to compile, got %v", table.pattern, err)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != table.err {
+			t.Errorf("Expected error %q for %q, got %v", table.err, table.pattern, err)
+		}
+	}
+}
+
+func TestStoredPattern(t *testing.T) {
+	// the patterns checked before being stored aren't cached
+	_, err := CompilePattern("^Dune")
+	check(t, err)
+	if _, ok := compiledPatterns.patterns["^Dune"]; ok {
+		t.Errorf("Expected the pattern not to be cached")
+	}
+
+	for i := 0; i <= maxCompiledPatterns; i++ {
+		_, err = storedPattern(fmt.Sprintf("^Dune %d", i))
+		check(t, err)
+	}
+
+	if count := len(compiledPatterns.patterns); count == 0 || count > maxCompiledPatterns {
+		t.Errorf("Expected at most %d cached patterns, got %d", maxCompiledPatterns, count)
+	}
+
+	re, err := storedPattern(fmt.Sprintf("^Dune %d", maxCompiledPatterns))
+	check(t, err)
+	if re != compiledPatterns.patterns[fmt.Sprintf("^Dune %d", maxCompiledPatterns)] {
+		t.Errorf("Expected the cached pattern")
+	}
+}
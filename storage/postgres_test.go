@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"os"
+	"testing"
+)
+
+// TestPostgresStore runs against the database found at MATHEQUE_TEST_POSTGRES_URL, whose public schema is wiped before each test.
+func TestPostgresStore(t *testing.T) {
+	url := os.Getenv("MATHEQUE_TEST_POSTGRES_URL")
+	if len(url) == 0 {
+		t.Skip("MATHEQUE_TEST_POSTGRES_URL is not set")
+	}
+
+	testStore(t, func(t *testing.T) Store {
+		s, err := OpenPostgres(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.Migrate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return s
+	})
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// fuzzyThreshold is the lowest score of the fuzzy matches, which allows for about a typo every five letters.
+const fuzzyThreshold = 0.8
+
+// termScore returns how well the normalised term matches the best of the normalised names, from 0 to 1,
+// as judged for the given strictness; the exact and the phrase matches score 1, anything else 0, unless fuzzy.
+func termScore(names []string, term string, strictness Strictness) float64 {
+	if strictness == StrictnessExact {
+		for _, name := range names {
+			if name == term {
+				return 1
+			}
+		}
+
+		return 0
+	}
+
+	if containsPhrase(names, term) {
+		return 1
+	}
+
+	if strictness != StrictnessFuzzy {
+		return 0
+	}
+
+	best := 0.0
+	for _, name := range names {
+		if score := fuzzyScore(name, term); score > best {
+			best = score
+		}
+	}
+
+	return best
+}
+
+// fuzzyScore returns the similarity between the term and the closest run of the name's words; runs of one word more or less
+// than the term are compared as well, so that the words split or joined differently still match, e.g. `spiderman` and `spider man`.
+func fuzzyScore(name string, term string) float64 {
+	words := strings.Fields(name)
+	n := len(strings.Fields(term))
+
+	best := 0.0
+	for size := n - 1; size <= n+1; size++ {
+		if size < 1 {
+			continue
+		}
+
+		for i := 0; i+size <= len(words); i++ {
+			if score := similarity(strings.Join(words[i:i+size], " "), term); score > best {
+				best = score
+			}
+		}
+	}
+
+	return best
+}
+
+// similarity returns 1 minus the edit distance between the strings, relative to the longest of them.
+func similarity(a string, b string) float64 {
+	longest := utf8.RuneCountInString(a)
+	if l := utf8.RuneCountInString(b); l > longest {
+		longest = l
+	}
+
+	if longest == 0 {
+		return 1
+	}
+
+	return 1 - float64(editDistance([]rune(a), []rune(b)))/float64(longest)
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and transpositions of adjacent letters
+// turning a into b (the optimal string alignment distance).
+func editDistance(a []rune, b []rune) int {
+	// d[i][j] is the distance between the first i letters of a and the first j letters of b
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+
+	return m
+}
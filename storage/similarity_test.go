@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tables := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{"", "", 0},
+		{"avatar", "avatar", 0},
+		{"avatr", "avatar", 1},
+		{"avtaar", "avatar", 1},
+		{"oppenhimer", "oppenheimer", 1},
+		{"bătăuși", "batausi", 3},
+		{"", "dune", 4},
+	}
+
+	for _, table := range tables {
+		if got := editDistance([]rune(table.a), []rune(table.b)); got != table.expected {
+			t.Errorf("Expected %d between %q and %q, got %d", table.expected, table.a, table.b, got)
+		}
+	}
+}
+
+func TestTermScore(t *testing.T) {
+	tables := []struct {
+		names      []string
+		term       string
+		strictness Strictness
+		expected   float64
+	}{
+		{[]string{"fight club"}, "fight club", StrictnessExact, 1},
+		{[]string{"fight club", "clubul de lupte"}, "club", StrictnessExact, 0},
+		{[]string{"fight club", "clubul de lupte"}, "club", StrictnessPhrase, 1},
+		{[]string{"clubul de lupte"}, "club", StrictnessPhrase, 0},
+		{[]string{"oppenheimer"}, "oppenhimer", StrictnessPhrase, 0},
+		{[]string{"oppenheimer"}, "oppenhimer", StrictnessFuzzy, 1 - 1.0/11},
+		{[]string{"spider man no way home"}, "spiderman", StrictnessFuzzy, 0.9},
+		{[]string{"avatar the way of water"}, "avatar", StrictnessFuzzy, 1},
+		{[]string{"dune"}, "", StrictnessFuzzy, 0},
+	}
+
+	for _, table := range tables {
+		if got := termScore(table.names, table.term, table.strictness); got != table.expected {
+			t.Errorf("Expected %v for %q in %v, strictness %d, got %v", table.expected, table.term, table.names, table.strictness, got)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+//go:build sqlite_fts5
+
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		s, err := OpenSQLite(filepath.Join(t.TempDir(), "matheque.sqlite"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.Migrate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return s
+	})
+}
+
+func TestSplitWatchersTerms(t *testing.T) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "matheque.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	_, err = s.Migrate()
+	check(t, err)
+
+	for _, keywords := range []string{"Dune OR Arrival", "re: ^Star Wars"} {
+		_, err = s.InsertWatcher(1, keywords)
+		check(t, err)
+	}
+
+	// the terms are split again, like by a data migration
+	tx, err := s.db.Begin()
+	check(t, err)
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM watcher_terms")
+	check(t, err)
+	check(t, splitWatchersTerms(tx))
+
+	rows, err := tx.Query("SELECT w.keywords, t.term FROM watcher_terms t JOIN watchers w ON w.id = t.watcher_id ORDER BY t.term")
+	check(t, err)
+	defer rows.Close()
+
+	var terms []string
+	for rows.Next() {
+		var keywords, term string
+		check(t, rows.Scan(&keywords, &term))
+		terms = append(terms, keywords+"/"+term)
+	}
+	check(t, rows.Err())
+
+	if fmt.Sprint(terms) != "[Dune OR Arrival/Arrival Dune OR Arrival/Dune]" {
+		t.Errorf("Expected the terms of the term watcher only, got %v", terms)
+	}
+}
@@ -1,16 +1,14 @@
-// Package storage provides functionality for managing the records of a sqlite database.
-// If the database does not exist, it is created and then seeded (see `init.sql`).
+// Package storage keeps the records of the bot, behind the `Store` interface.
+// The records are kept either in a sqlite database, created if it does not exist, or in a PostgreSQL database;
+// the schema of either is set up by the embedded migrations (see `migrations`).
 package storage
 
 import (
 	"database/sql"
 	"fmt"
-	"github.com/e10k/matheque/config"
 	_ "github.com/mattn/go-sqlite3"
-	"io/ioutil"
-	"log"
 	"os"
-	"regexp"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -21,14 +19,89 @@ const (
 	ChatIdle ChatStatus = iota
 	ChatWaitingForWatcherToAdd
 	ChatWaitingForWatcherToRemove
+	ChatWaitingForCinemaToToggle
+	ChatWaitingForWatcherToToggleUpdates
+	ChatWaitingForCountry
+	ChatWaitingForAlertToToggle
+	ChatWaitingForFormatFilter
+	ChatWaitingForAudioFilter
+	ChatWaitingForSubtitlesFilter
+	ChatWaitingForAgeRatingFilter
+	ChatWaitingForWatcherToSetStrictness
+	ChatWaitingForStrictness
 )
 
+// Alert is a kind of notification the chats can switch on or off.
+type Alert int8
+
+const (
+	// AlertAnnouncement is sent when a film matching a watcher is announced as coming soon.
+	AlertAnnouncement Alert = iota
+	// AlertOnSale is sent when the booking opens for a film matching a watcher.
+	AlertOnSale
+)
+
+// alertColumns maps the alerts to the `chats` columns storing the preferences for each.
+var alertColumns = map[Alert]string{
+	AlertAnnouncement: "announcement_alerts",
+	AlertOnSale:       "on_sale_alerts",
+}
+
 type Film struct {
+	// RowId is the film's id in the database, referenced by the buttons attached to notifications.
+	RowId        int64
+	Provider     string
 	Id           string
+	CinemaId     string
 	Name         string
 	OriginalName string
 	Link         string
 	PosterLink   string
+	ReleaseDate  string
+	// Notified tells whether the chats watching for the film were notified about it.
+	Notified bool
+	FilmDetails
+}
+
+// FilmDetails are a film's optional properties; languages are given as ISO 639-1 codes.
+type FilmDetails struct {
+	Length            int
+	ReleaseYear       string
+	Genres            []string
+	AgeRating         string
+	Formats           []string
+	OriginalLanguage  string
+	DubbedLanguages   []string
+	SubtitleLanguages []string
+}
+
+type Event struct {
+	Provider    string
+	Id          string
+	FilmId      string
+	CinemaId    string
+	BusinessDay string
+	DateTime    string
+	BookingLink string
+	Auditorium  string
+	// languages are given as ISO 639-1 codes
+	Formats           []string
+	DubbedLanguages   []string
+	SubtitleLanguages []string
+}
+
+// Watcher is a set of keywords a chat is interested in, as listed with its id and filters.
+type Watcher struct {
+	Id         int64
+	Keywords   string
+	Filters    WatcherFilters
+	Strictness Strictness
+}
+
+// ChatCinema is a cinema picked by a chat.
+type ChatCinema struct {
+	Provider string
+	CinemaId string
 }
 
 type Message struct {
@@ -40,79 +113,325 @@ type Message struct {
 	Text          string
 }
 
-// GetDB returns a database handle.
-// If the database doesn't exist, it is created and seeded.
-func GetDB() *sql.DB {
-	dbLocation := "./data/matheque.sqlite"
+// busyTimeout is how many milliseconds a query waits for the database to be unlocked by another connection
+const busyTimeout = 5000
 
-	isFreshDb := false
+// SQLiteStore is the Store keeping the data in a sqlite database; matching the watchers relies on its fts5 extension,
+// so the binary must be built with the `sqlite_fts5` tag.
+type SQLiteStore struct {
+	db *sql.DB
+}
 
-	_, err := os.Stat("./data")
-	if os.IsNotExist(err) {
-		err := os.Mkdir("data", 0755)
-		if err != nil {
-			log.Fatal(err)
-		}
+// OpenSQLite opens the database found at the given path, creating the database, and its directory, if they don't exist.
+// The schema is brought up to date separately, by `Migrate`.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = os.Stat(dbLocation)
-	if os.IsNotExist(err) {
-		f, err := os.Create(dbLocation)
-		if err != nil {
-			log.Fatal(err)
-		}
-		err = f.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-		isFreshDb = true
-	}
+	// the write-ahead log lets the webhook, the background task and the outbox read while one of them writes;
+	// transactions take the write lock upfront, so they wait for each other instead of failing when upgrading a read lock
+	dsn := fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=%d&_foreign_keys=on&_txlock=immediate", path, busyTimeout)
 
-	db, err := sql.Open("sqlite3", dbLocation)
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	err = db.Ping()
 	if err != nil {
-		log.Fatal(err)
+		db.Close()
+		return nil, err
 	}
 
-	if isFreshDb {
-		initSql, err := ioutil.ReadFile("./init.sql")
-		if err != nil {
-			log.Fatal(err)
-		}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// FilmExists reports whether the provider's film has already been stored for the given cinema.
+func (s *SQLiteStore) FilmExists(provider string, filmId string, cinemaId string) (bool, error) {
+	rows, err := s.db.Query("SELECT original_id FROM films WHERE provider=$1 AND original_id=$2 AND cinema_id=$3", provider, filmId, cinemaId)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// GetFilmName returns the localized name of a provider's film already stored for any of the cinemas,
+// or an empty string if the film is not known yet.
+func (s *SQLiteStore) GetFilmName(provider string, filmId string) (string, error) {
+	var name string
+
+	err := s.db.QueryRow("SELECT name FROM films WHERE provider=$1 AND original_id=$2 LIMIT 1", provider, filmId).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// GetFilm returns the provider's film stored for the given cinema, or nil if it doesn't exist.
+func (s *SQLiteStore) GetFilm(provider string, filmId string, cinemaId string) (*Film, error) {
+	return scanFilm(s.db.QueryRow(`SELECT `+filmColumns+` FROM films WHERE provider=$1 AND original_id=$2 AND cinema_id=$3`, provider, filmId, cinemaId))
+}
+
+// GetFilmByRowId returns the film having the given database id, or nil if there's none.
+func (s *SQLiteStore) GetFilmByRowId(rowId int64) (*Film, error) {
+	return scanFilm(s.db.QueryRow(`SELECT `+filmColumns+` FROM films WHERE id=$1`, rowId))
+}
+
+// filmColumns are the `films` columns read by `scanFilm`.
+const filmColumns = `id, provider, original_id, cinema_id, name, original_name, link, poster_link, notified,
+	length, release_year, genres, age_rating, formats, original_language, dubbed_languages, subtitle_languages`
+
+func scanFilm(row *sql.Row) (*Film, error) {
+	var f Film
+
+	var genres, formats, dubbedLanguages, subtitleLanguages string
+
+	err := row.Scan(&f.RowId, &f.Provider, &f.Id, &f.CinemaId, &f.Name, &f.OriginalName, &f.Link, &f.PosterLink, &f.Notified,
+		&f.Length, &f.ReleaseYear, &genres, &f.AgeRating, &formats, &f.OriginalLanguage, &dubbedLanguages, &subtitleLanguages)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f.Genres = splitList(genres)
+	f.Formats = splitList(formats)
+	f.DubbedLanguages = splitList(dubbedLanguages)
+	f.SubtitleLanguages = splitList(subtitleLanguages)
+
+	return &f, nil
+}
+
+// InsertFilm stores a film available for booking and sets its RowId.
+func (s *SQLiteStore) InsertFilm(film *Film) (int64, error) {
+	result, err := s.db.Exec(`INSERT INTO films (provider, original_id, cinema_id, name, original_name, link, poster_link, release_date, notified,
+		length, release_year, genres, age_rating, formats, original_language, dubbed_languages, subtitle_languages, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		film.Provider, film.Id, film.CinemaId, film.Name, film.OriginalName, film.Link, film.PosterLink, film.ReleaseDate, film.Notified,
+		film.Length, film.ReleaseYear, joinList(film.Genres), film.AgeRating, joinList(film.Formats),
+		film.OriginalLanguage, joinList(film.DubbedLanguages), joinList(film.SubtitleLanguages), time.Now())
+
+	if err != nil {
+		return 0, err
+	}
 
-		_, err = db.Exec(string(initSql))
+	film.RowId, _ = result.LastInsertId()
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
+
+// ClaimLegacyFilms copies the provider's films stored before the films were tracked per cinema, which have no cinema,
+// to each of the given cinemas, then forgets about them; the copies are already notified, so they aren't announced
+// again by the cinemas. It returns the number of copies made.
+func (s *SQLiteStore) ClaimLegacyFilms(provider string, cinemaIds []string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
+	var claimed int64
+	for _, cinemaId := range cinemaIds {
+		result, err := tx.Exec(`INSERT OR IGNORE INTO films (provider, original_id, cinema_id, name, original_name, link, poster_link, notified, created_at)
+			SELECT provider, original_id, ?, name, original_name, link, poster_link, 1, created_at FROM films WHERE provider=? AND cinema_id=''`,
+			cinemaId, provider)
 		if err != nil {
-			log.Fatal(err)
+			return 0, fmt.Errorf("claiming legacy films: %v", err)
 		}
+
+		rowsAffected, _ := result.RowsAffected()
+		claimed += rowsAffected
+	}
+
+	_, err = tx.Exec("DELETE FROM films WHERE provider=? AND cinema_id=''", provider)
+	if err != nil {
+		return 0, fmt.Errorf("claiming legacy films: %v", err)
+	}
+
+	return claimed, tx.Commit()
+}
+
+// GetUpcomingFilm returns the provider's film announced for the given cinema, or nil if it wasn't announced.
+// Only the film's names, links, release date and notification status are returned.
+func (s *SQLiteStore) GetUpcomingFilm(provider string, filmId string, cinemaId string) (*Film, error) {
+	return scanUpcomingFilm(s.db.QueryRow(`SELECT `+upcomingFilmColumns+` FROM upcoming_films WHERE provider=$1 AND original_id=$2 AND cinema_id=$3`,
+		provider, filmId, cinemaId))
+}
+
+// GetUpcomingFilmByRowId returns the upcoming film stored under the given row id, or nil if there's none.
+func (s *SQLiteStore) GetUpcomingFilmByRowId(rowId int64) (*Film, error) {
+	return scanUpcomingFilm(s.db.QueryRow(`SELECT `+upcomingFilmColumns+` FROM upcoming_films WHERE id=$1`, rowId))
+}
+
+// upcomingFilmColumns are the `upcoming_films` columns read by `scanUpcomingFilm`.
+const upcomingFilmColumns = `id, provider, original_id, cinema_id, name, original_name, link, poster_link, release_date, notified`
+
+func scanUpcomingFilm(row *sql.Row) (*Film, error) {
+	var f Film
+
+	err := row.Scan(&f.RowId, &f.Provider, &f.Id, &f.CinemaId, &f.Name, &f.OriginalName, &f.Link, &f.PosterLink, &f.ReleaseDate, &f.Notified)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// InsertUpcomingFilm stores a film announced as coming soon and sets its RowId.
+func (s *SQLiteStore) InsertUpcomingFilm(film *Film) (int64, error) {
+	result, err := s.db.Exec("INSERT INTO upcoming_films (provider, original_id, cinema_id, name, original_name, link, poster_link, release_date, notified, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		film.Provider, film.Id, film.CinemaId, film.Name, film.OriginalName, film.Link, film.PosterLink, film.ReleaseDate, film.Notified, time.Now())
+
+	if err != nil {
+		return 0, err
+	}
+
+	film.RowId, _ = result.LastInsertId()
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
+
+// SetFilmNotified records that the chats watching for the film were notified about it going on sale.
+func (s *SQLiteStore) SetFilmNotified(rowId int64) (int64, error) {
+	return s.setNotified("films", rowId)
+}
+
+// SetUpcomingFilmNotified records that the chats watching for the film were notified about its announcement.
+func (s *SQLiteStore) SetUpcomingFilmNotified(rowId int64) (int64, error) {
+	return s.setNotified("upcoming_films", rowId)
+}
+
+func (s *SQLiteStore) setNotified(table string, rowId int64) (int64, error) {
+	result, err := s.db.Exec("UPDATE "+table+" SET notified = 1 WHERE id = ?", rowId)
+	if err != nil {
+		return 0, err
 	}
 
-	return db
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
 }
 
-func FilmExists(env *config.Conf, filmId string) (bool, error) {
-	rows, err := env.DB.Query("SELECT original_id FROM films WHERE original_id=$1", filmId)
+// InsertEvent stores a screening, unless it already exists; the returned number of affected rows
+// is 0 for screenings that were already known.
+func (s *SQLiteStore) InsertEvent(e *Event) (int64, error) {
+	result, err := s.db.Exec(`INSERT OR IGNORE INTO events (provider, id, film_id, cinema_id, business_day, event_date_time, booking_link, auditorium,
+		formats, dubbed_languages, subtitle_languages, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Provider, e.Id, e.FilmId, e.CinemaId, e.BusinessDay, e.DateTime, e.BookingLink, e.Auditorium,
+		joinList(e.Formats), joinList(e.DubbedLanguages), joinList(e.SubtitleLanguages), time.Now())
+
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
 
+// GetUpcomingEvents returns, in chronological order, at most `limit` screenings of the provider's film at the given cinema
+// that start after `after` (formatted like the events' `DateTime`); a negative limit returns all of them.
+func (s *SQLiteStore) GetUpcomingEvents(provider string, filmId string, cinemaId string, after string, limit int) ([]Event, error) {
+	rows, err := s.db.Query(`SELECT provider, id, film_id, cinema_id, business_day, event_date_time, booking_link, auditorium,
+		formats, dubbed_languages, subtitle_languages FROM events
+		WHERE provider = ? AND film_id = ? AND cinema_id = ? AND event_date_time > ?
+		ORDER BY event_date_time LIMIT ?`, provider, filmId, cinemaId, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("fetching events: %v", err)
+	}
 	defer rows.Close()
 
+	var data []Event
+
+	for rows.Next() {
+		var e Event
+		var formats, dubbedLanguages, subtitleLanguages string
+		err = rows.Scan(&e.Provider, &e.Id, &e.FilmId, &e.CinemaId, &e.BusinessDay, &e.DateTime, &e.BookingLink, &e.Auditorium,
+			&formats, &dubbedLanguages, &subtitleLanguages)
+		if err != nil {
+			return nil, fmt.Errorf("reading events: %v", err)
+		}
+
+		e.Formats = splitList(formats)
+		e.DubbedLanguages = splitList(dubbedLanguages)
+		e.SubtitleLanguages = splitList(subtitleLanguages)
+
+		data = append(data, e)
+	}
+
+	return data, nil
+}
+
+// GetFilmsWithEvents returns the ids of the provider's films having screenings stored for the given cinema.
+func (s *SQLiteStore) GetFilmsWithEvents(provider string, cinemaId string) (map[string]bool, error) {
+	rows, err := s.db.Query("SELECT DISTINCT film_id FROM events WHERE provider = ? AND cinema_id = ?", provider, cinemaId)
 	if err != nil {
-		return false, err
+		return nil, fmt.Errorf("fetching films with events: %v", err)
 	}
+	defer rows.Close()
 
-	if rows.Next() {
-		return true, nil
+	data := make(map[string]bool)
+
+	for rows.Next() {
+		var filmId string
+		err = rows.Scan(&filmId)
+		if err != nil {
+			return nil, fmt.Errorf("reading films with events: %v", err)
+		}
+
+		data[filmId] = true
 	}
 
-	return false, nil
+	return data, nil
+}
+
+// eventsHorizonSetting returns the `settings` entry holding the last day the cinema's screenings were fetched up to.
+func eventsHorizonSetting(provider string, cinemaId string) string {
+	return "events_horizon/" + provider + "/" + cinemaId
 }
 
-func InsertFilm(env *config.Conf, film *Film) (int64, error) {
-	result, err := env.DB.Exec("INSERT INTO films (original_id, name, original_name, link, poster_link, created_at) VALUES (?, ?, ?, ?, ?, ?)",
-		film.Id, film.Name, film.OriginalName, film.Link, film.PosterLink, time.Now())
+// GetEventsHorizon returns the last day, formatted like the events' `BusinessDay`, the cinema's screenings were fetched up to,
+// or an empty string if they weren't fetched yet.
+func (s *SQLiteStore) GetEventsHorizon(provider string, cinemaId string) (string, error) {
+	var day string
+
+	row := s.db.QueryRow("SELECT value FROM settings WHERE name=$1", eventsHorizonSetting(provider, cinemaId))
+	err := row.Scan(&day)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("fetching events horizon: %v", err)
+	}
+
+	return day, nil
+}
 
+// SetEventsHorizon stores the last day the cinema's screenings were fetched up to.
+func (s *SQLiteStore) SetEventsHorizon(provider string, cinemaId string, day string) (int64, error) {
+	result, err := s.db.Exec(`INSERT INTO settings (name, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`, eventsHorizonSetting(provider, cinemaId), day, time.Now())
 	if err != nil {
 		return 0, err
 	}
@@ -122,9 +441,10 @@ func InsertFilm(env *config.Conf, film *Film) (int64, error) {
 	return rowsAffected, nil
 }
 
-func InsertMessage(env *config.Conf, m *Message) (int64, error) {
-	result, err := env.DB.Exec("INSERT INTO messages (message_id, from_id, from_first_name, chat_id, chat_first_name, text, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		m.MessageId, m.FromId, m.FromFirstName, m.ChatId, m.ChatFirstName, m.Text, time.Now())
+func (s *SQLiteStore) InsertMessage(m *Message) (int64, error) {
+	result, err := s.db.Exec(`INSERT INTO messages (message_id, from_id, from_first_name, chat_id, chat_first_name, text, created_at)
+		SELECT ?, ?, ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM messages WHERE chat_id = ? AND message_id = ? AND text = ?)`,
+		m.MessageId, m.FromId, m.FromFirstName, m.ChatId, m.ChatFirstName, m.Text, time.Now(), m.ChatId, m.MessageId, m.Text)
 
 	if err != nil {
 		return 0, err
@@ -135,8 +455,8 @@ func InsertMessage(env *config.Conf, m *Message) (int64, error) {
 	return rowsAffected, nil
 }
 
-func UpdateChatStatus(env *config.Conf, chatId int, userId int, status ChatStatus) (int64, error) {
-	exists, err := chatExists(env, chatId, userId)
+func (s *SQLiteStore) UpdateChatStatus(chatId int, userId int, status ChatStatus) (int64, error) {
+	exists, err := s.chatExists(chatId, userId)
 
 	if err != nil {
 		return 0, err
@@ -145,9 +465,9 @@ func UpdateChatStatus(env *config.Conf, chatId int, userId int, status ChatStatu
 	var rowsAffected int64
 
 	if exists {
-		rowsAffected, err = updateChat(env, chatId, userId, status)
+		rowsAffected, err = s.updateChat(chatId, userId, status)
 	} else {
-		rowsAffected, err = insertChat(env, chatId, userId, status)
+		rowsAffected, err = s.insertChat(chatId, userId, status)
 	}
 
 	if err != nil {
@@ -157,8 +477,8 @@ func UpdateChatStatus(env *config.Conf, chatId int, userId int, status ChatStatu
 	return rowsAffected, nil
 }
 
-func Subscribe(env *config.Conf, chatId int, userId int) (int64, error) {
-	exists, err := chatExists(env, chatId, userId)
+func (s *SQLiteStore) Subscribe(chatId int, userId int) (int64, error) {
+	exists, err := s.chatExists(chatId, userId)
 
 	if err != nil {
 		return 0, err
@@ -168,7 +488,8 @@ func Subscribe(env *config.Conf, chatId int, userId int) (int64, error) {
 		return 0, nil
 	}
 
-	result, err := env.DB.Exec("UPDATE chats SET subscribed = ?, updated_at = ? WHERE chat_id=? AND user_id=?", 1, time.Now(), chatId, userId)
+	// a chat subscribing again has unblocked the bot, if it was blocked
+	result, err := s.db.Exec("UPDATE chats SET subscribed = ?, blocked = ?, updated_at = ? WHERE chat_id=? AND user_id=?", 1, 0, time.Now(), chatId, userId)
 
 	if err != nil {
 		return 0, err
@@ -179,8 +500,8 @@ func Subscribe(env *config.Conf, chatId int, userId int) (int64, error) {
 	return rowsAffected, nil
 }
 
-func Unsubscribe(env *config.Conf, chatId int, userId int) (int64, error) {
-	exists, err := chatExists(env, chatId, userId)
+func (s *SQLiteStore) Unsubscribe(chatId int, userId int) (int64, error) {
+	exists, err := s.chatExists(chatId, userId)
 
 	if err != nil {
 		return 0, err
@@ -190,7 +511,7 @@ func Unsubscribe(env *config.Conf, chatId int, userId int) (int64, error) {
 		return 0, err
 	}
 
-	result, err := env.DB.Exec("UPDATE chats SET subscribed = ?, updated_at = ? WHERE chat_id=? AND user_id=?", 0, time.Now(), chatId, userId)
+	result, err := s.db.Exec("UPDATE chats SET subscribed = ?, updated_at = ? WHERE chat_id=? AND user_id=?", 0, time.Now(), chatId, userId)
 
 	if err != nil {
 		return 0, err
@@ -201,14 +522,12 @@ func Unsubscribe(env *config.Conf, chatId int, userId int) (int64, error) {
 	return rowsAffected, nil
 }
 
-func chatExists(env *config.Conf, chatId int, userId int) (bool, error) {
-	rows, err := env.DB.Query("SELECT * FROM chats WHERE chat_id=? AND user_id=?", chatId, userId)
-
-	defer rows.Close()
-
+func (s *SQLiteStore) chatExists(chatId int, userId int) (bool, error) {
+	rows, err := s.db.Query("SELECT * FROM chats WHERE chat_id=? AND user_id=?", chatId, userId)
 	if err != nil {
 		return false, err
 	}
+	defer rows.Close()
 
 	if rows.Next() {
 		return true, nil
@@ -217,8 +536,8 @@ func chatExists(env *config.Conf, chatId int, userId int) (bool, error) {
 	return false, nil
 }
 
-func updateChat(env *config.Conf, chatId int, userId int, status ChatStatus) (int64, error) {
-	result, err := env.DB.Exec("UPDATE chats SET status = ?, updated_at = ? WHERE chat_id=? AND user_id=?", status, time.Now(), chatId, userId)
+func (s *SQLiteStore) updateChat(chatId int, userId int, status ChatStatus) (int64, error) {
+	result, err := s.db.Exec("UPDATE chats SET status = ?, updated_at = ? WHERE chat_id=? AND user_id=?", status, time.Now(), chatId, userId)
 
 	if err != nil {
 		return 0, err
@@ -229,9 +548,21 @@ func updateChat(env *config.Conf, chatId int, userId int, status ChatStatus) (in
 	return rowsAffected, nil
 }
 
-func insertChat(env *config.Conf, chatId int, userId int, status ChatStatus) (int64, error) {
-	result, err := env.DB.Exec("INSERT INTO chats (chat_id, user_id, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?)", chatId, userId, status, time.Now(), time.Now())
+func (s *SQLiteStore) insertChat(chatId int, userId int, status ChatStatus) (int64, error) {
+	result, err := s.db.Exec("INSERT INTO chats (chat_id, user_id, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?)", chatId, userId, status, time.Now(), time.Now())
+
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
 
+// SetChatBlocked marks the chat as having blocked the bot, so that it isn't notified anymore.
+func (s *SQLiteStore) SetChatBlocked(chatId int) (int64, error) {
+	result, err := s.db.Exec("UPDATE chats SET blocked = ?, updated_at = ? WHERE chat_id=?", 1, time.Now(), chatId)
 	if err != nil {
 		return 0, err
 	}
@@ -241,28 +572,119 @@ func insertChat(env *config.Conf, chatId int, userId int, status ChatStatus) (in
 	return rowsAffected, nil
 }
 
-func GetChatStatus(env *config.Conf, chatId int, userId int) ChatStatus {
+// GetChatStatus returns the chat's status, which is ChatIdle for unknown chats.
+func (s *SQLiteStore) GetChatStatus(chatId int, userId int) (ChatStatus, error) {
 	var status ChatStatus
 
-	row := env.DB.QueryRow("SELECT status FROM chats WHERE chat_id=$1 AND user_id=$2", chatId, userId)
+	row := s.db.QueryRow("SELECT status FROM chats WHERE chat_id=$1 AND user_id=$2", chatId, userId)
 
 	err := row.Scan(&status)
+	if err == sql.ErrNoRows {
+		return ChatIdle, nil
+	}
+	if err != nil {
+		return ChatIdle, fmt.Errorf("fetching chat status: %v", err)
+	}
+
+	return status, nil
+}
+
+// GetChatCountry returns the code of the country the chat has picked, or an empty string if it follows all of them.
+func (s *SQLiteStore) GetChatCountry(chatId int, userId int) (string, error) {
+	var country string
+
+	row := s.db.QueryRow("SELECT country FROM chats WHERE chat_id=$1 AND user_id=$2", chatId, userId)
+	err := row.Scan(&country)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return country, nil
+}
+
+// SetChatCountry sets the country the chat gets notifications for; an empty string stands for all the countries.
+func (s *SQLiteStore) SetChatCountry(chatId int, userId int, country string) (int64, error) {
+	result, err := s.db.Exec("UPDATE chats SET country = ?, updated_at = ? WHERE chat_id=? AND user_id=?", country, time.Now(), chatId, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
+
+// GetChatAlerts returns the chat's preference for each kind of alert.
+func (s *SQLiteStore) GetChatAlerts(chatId int, userId int) (map[Alert]bool, error) {
+	alerts := map[Alert]bool{
+		AlertAnnouncement: false,
+		AlertOnSale:       true,
+	}
+
+	var announcement, onSale bool
+
+	row := s.db.QueryRow("SELECT announcement_alerts, on_sale_alerts FROM chats WHERE chat_id=$1 AND user_id=$2", chatId, userId)
+	err := row.Scan(&announcement, &onSale)
+	if err == sql.ErrNoRows {
+		return alerts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	alerts[AlertAnnouncement] = announcement
+	alerts[AlertOnSale] = onSale
+
+	return alerts, nil
+}
+
+// ToggleChatAlert switches the given kind of alert on or off for the chat.
+// It returns whether the alert is enabled after the operation.
+func (s *SQLiteStore) ToggleChatAlert(chatId int, userId int, alert Alert) (bool, error) {
+	alerts, err := s.GetChatAlerts(chatId, userId)
+	if err != nil {
+		return false, err
+	}
+
+	column, ok := alertColumns[alert]
+	if !ok {
+		return false, fmt.Errorf("unknown alert %d", alert)
+	}
 
+	enabled := !alerts[alert]
+
+	_, err = s.db.Exec(fmt.Sprintf("UPDATE chats SET %s = ?, updated_at = ? WHERE chat_id=? AND user_id=?", column), enabled, time.Now(), chatId, userId)
 	if err != nil {
-		status = 0
+		return false, err
 	}
 
-	return status
+	return enabled, nil
 }
 
-func InsertWatcher(env *config.Conf, chatId int, keywords string) (int64, error) {
+// InsertWatcher stores the chat's watcher along with its terms, unless it has no terms or the chat has the same watcher already.
+// The pattern watchers are stored along with their pattern instead, unless it is invalid or the chat has too many of them.
+func (s *SQLiteStore) InsertWatcher(chatId int, keywords string) (int64, error) {
 	keywords = strings.Trim(keywords, " ")
 
-	if len(keywords) == 0 {
-		return 0, nil
+	pattern, isPattern := ParsePattern(keywords)
+
+	var terms []watcherTerm
+
+	if isPattern {
+		if _, err := CompilePattern(pattern); err != nil {
+			return 0, nil
+		}
+	} else {
+		terms = splitTerms(keywords)
+		if len(terms) == 0 {
+			return 0, nil
+		}
 	}
 
-	exists, err := watcherExists(env, chatId, keywords)
+	exists, err := s.watcherExists(chatId, keywords)
 
 	if err != nil {
 		return 0, err
@@ -272,24 +694,51 @@ func InsertWatcher(env *config.Conf, chatId int, keywords string) (int64, error)
 		return 0, nil
 	}
 
-	result, err := env.DB.Exec("INSERT INTO watchers (chat_id, keywords, keywords_normalised, created_at) VALUES (?, ?, ?, ?)", chatId, keywords, NormaliseString(keywords), time.Now())
+	tx, err := s.db.Begin()
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, _ := result.RowsAffected()
+	if isPattern {
+		// the transaction is immediate, so the chat's concurrent inserts can't exceed the limit together
+		var count int
+		err = tx.QueryRow("SELECT COUNT(*) FROM watchers WHERE chat_id=? AND pattern <> ''", chatId).Scan(&count)
+		if err != nil {
+			return 0, fmt.Errorf("counting pattern watchers: %v", err)
+		}
 
-	return rowsAffected, nil
-}
+		if count >= MaxPatternWatchers {
+			return 0, nil
+		}
+	}
+
+	result, err := tx.Exec("INSERT INTO watchers (chat_id, keywords, pattern, created_at) VALUES (?, ?, ?, ?)", chatId, keywords, pattern, time.Now())
+	if err != nil {
+		return 0, err
+	}
 
-func watcherExists(env *config.Conf, chatId int, keywords string) (bool, error) {
-	rows, err := env.DB.Query("SELECT * FROM watchers WHERE chat_id=$1 AND keywords=$2 COLLATE NOCASE", chatId, keywords)
+	watcherId, _ := result.LastInsertId()
 
-	defer rows.Close()
+	err = insertTerms(tx, watcherId, terms)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
 
+	return 1, nil
+}
+
+func (s *SQLiteStore) watcherExists(chatId int, keywords string) (bool, error) {
+	rows, err := s.db.Query("SELECT * FROM watchers WHERE chat_id=$1 AND keywords=$2 COLLATE NOCASE", chatId, keywords)
 	if err != nil {
 		return false, err
 	}
+	defer rows.Close()
 
 	if rows.Next() {
 		return true, nil
@@ -298,8 +747,8 @@ func watcherExists(env *config.Conf, chatId int, keywords string) (bool, error)
 	return false, nil
 }
 
-func RemoveWatcher(env *config.Conf, chatId int, keywords string) (int64, error) {
-	exists, err := watcherExists(env, chatId, keywords)
+func (s *SQLiteStore) RemoveWatcher(chatId int, keywords string) (int64, error) {
+	exists, err := s.watcherExists(chatId, keywords)
 
 	if err != nil {
 		return 0, err
@@ -309,7 +758,7 @@ func RemoveWatcher(env *config.Conf, chatId int, keywords string) (int64, error)
 		return 0, nil
 	}
 
-	result, err := env.DB.Exec("DELETE FROM watchers WHERE chat_id=? AND keywords=?", chatId, keywords)
+	result, err := s.db.Exec("DELETE FROM watchers WHERE chat_id=? AND keywords=?", chatId, keywords)
 	if err != nil {
 		return 0, err
 	}
@@ -319,8 +768,8 @@ func RemoveWatcher(env *config.Conf, chatId int, keywords string) (int64, error)
 	return rowsAffected, nil
 }
 
-func GetWatchers(env *config.Conf, chatId int) ([]string, error) {
-	rows, err := env.DB.Query("SELECT keywords FROM watchers WHERE chat_id = ? ORDER BY keywords COLLATE NOCASE", chatId)
+func (s *SQLiteStore) GetWatchers(chatId int) ([]string, error) {
+	rows, err := s.db.Query("SELECT keywords FROM watchers WHERE chat_id = ? ORDER BY keywords COLLATE NOCASE", chatId)
 	if err != nil {
 		return nil, fmt.Errorf("fetching watchers: %v", err)
 	}
@@ -341,46 +790,341 @@ func GetWatchers(env *config.Conf, chatId int) ([]string, error) {
 	return data, nil
 }
 
-func GetWatchersMatchingQuery(env *config.Conf, query1 string, query2 string) ([]int, error) {
-	query := NormaliseString(query1 + " " + query2)
-	preparedQuery := strings.Join(strings.Split(query, " "), " OR ")
-	rows, err := env.DB.Query("select chat_id from watchers_fts where keywords_normalised match ? GROUP BY chat_id ORDER BY rank", preparedQuery)
+// GetWatcherList returns the chat's watchers along with their ids and filters.
+func (s *SQLiteStore) GetWatcherList(chatId int) ([]Watcher, error) {
+	rows, err := s.db.Query(`SELECT id, keywords, filter_format, filter_audio, filter_subtitles, filter_age_rating, strictness
+		FROM watchers WHERE chat_id = ? ORDER BY keywords COLLATE NOCASE`, chatId)
 	if err != nil {
-		return nil, fmt.Errorf("fetching watchers for query %s: %v", query, err)
+		return nil, fmt.Errorf("fetching watchers: %v", err)
+	}
+	defer rows.Close()
+
+	var data []Watcher
+
+	for rows.Next() {
+		var w Watcher
+		err = rows.Scan(&w.Id, &w.Keywords, &w.Filters.Format, &w.Filters.Audio, &w.Filters.Subtitles, &w.Filters.AgeRating, &w.Strictness)
+		if err != nil {
+			return nil, fmt.Errorf("reading watchers: %v", err)
+		}
+
+		data = append(data, w)
+	}
+
+	return data, nil
+}
+
+// RemoveWatcherById removes the chat's watcher having the given id.
+func (s *SQLiteStore) RemoveWatcherById(chatId int, watcherId int64) (int64, error) {
+	result, err := s.db.Exec("DELETE FROM watchers WHERE chat_id=? AND id=?", chatId, watcherId)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
+
+// ToggleMutedFilm stops the notifications about the provider's film for the chat, or resumes them if they were stopped.
+// It returns whether the film is muted after the operation.
+func (s *SQLiteStore) ToggleMutedFilm(chatId int, provider string, filmId string) (bool, error) {
+	result, err := s.db.Exec("DELETE FROM muted_films WHERE chat_id=? AND provider=? AND original_id=?", chatId, provider, filmId)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected > 0 {
+		return false, nil
+	}
+
+	_, err = s.db.Exec("INSERT INTO muted_films (chat_id, provider, original_id, created_at) VALUES (?, ?, ?, ?)", chatId, provider, filmId, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetChatCinemas returns the cinemas the chat has picked.
+// An empty result means that the chat follows all the cinemas.
+func (s *SQLiteStore) GetChatCinemas(chatId int) ([]ChatCinema, error) {
+	rows, err := s.db.Query("SELECT provider, cinema_id FROM chat_cinemas WHERE chat_id = ?", chatId)
+	if err != nil {
+		return nil, fmt.Errorf("fetching chat cinemas: %v", err)
+	}
+	defer rows.Close()
+
+	var data []ChatCinema
+
+	for rows.Next() {
+		var c ChatCinema
+		err = rows.Scan(&c.Provider, &c.CinemaId)
+		if err != nil {
+			return nil, fmt.Errorf("reading chat cinemas: %v", err)
+		}
+
+		data = append(data, c)
+	}
+
+	return data, nil
+}
+
+// ToggleChatCinema adds the provider's cinema to the chat's selection, or removes it if it was already selected.
+// It returns whether the cinema is selected after the operation.
+func (s *SQLiteStore) ToggleChatCinema(chatId int, provider string, cinemaId string) (bool, error) {
+	result, err := s.db.Exec("DELETE FROM chat_cinemas WHERE chat_id=? AND provider=? AND cinema_id=?", chatId, provider, cinemaId)
+	if err != nil {
+		return false, err
 	}
 
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected > 0 {
+		return false, nil
+	}
+
+	_, err = s.db.Exec("INSERT INTO chat_cinemas (chat_id, provider, cinema_id, created_at) VALUES (?, ?, ?, ?)", chatId, provider, cinemaId, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetWatchersWithNewScreenings returns the chat's watchers that also notify about screenings added for already announced films.
+func (s *SQLiteStore) GetWatchersWithNewScreenings(chatId int) ([]string, error) {
+	rows, err := s.db.Query("SELECT keywords FROM watchers WHERE chat_id = ? AND new_screenings = 1 ORDER BY keywords COLLATE NOCASE", chatId)
+	if err != nil {
+		return nil, fmt.Errorf("fetching watchers: %v", err)
+	}
 	defer rows.Close()
 
-	var data []int
+	var data []string
 
 	for rows.Next() {
-		var chatId int
-		err = rows.Scan(&chatId)
+		var k string
+		err = rows.Scan(&k)
 		if err != nil {
 			return nil, fmt.Errorf("reading watchers: %v", err)
 		}
 
-		data = append(data, chatId)
+		data = append(data, k)
 	}
 
 	return data, nil
 }
 
-// NormaliseString prepares watchers and movie names for being compared.
-func NormaliseString(s string) string {
-	r1, err := regexp.Compile("[^a-zA-Z\u00C0-\u024F\u1E00-\u1EFF ]+")
+// ToggleWatcherNewScreenings switches on or off the notifications about new screenings for the given watcher.
+// It returns the number of affected rows and whether the notifications are enabled after the operation.
+func (s *SQLiteStore) ToggleWatcherNewScreenings(chatId int, keywords string) (int64, bool, error) {
+	var enabled bool
+
+	row := s.db.QueryRow("SELECT new_screenings FROM watchers WHERE chat_id=$1 AND keywords=$2 COLLATE NOCASE", chatId, keywords)
+	err := row.Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	result, err := s.db.Exec("UPDATE watchers SET new_screenings = ? WHERE chat_id=? AND keywords=? COLLATE NOCASE", !enabled, chatId, keywords)
+	if err != nil {
+		return 0, false, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, !enabled, nil
+}
+
+// updatesOffsetSetting is the `settings` entry holding the id of the next update to be pulled from Telegram.
+const updatesOffsetSetting = "updates_offset"
+
+// GetUpdatesOffset returns the id of the next update to be pulled from Telegram, or 0 if no update was pulled yet.
+func (s *SQLiteStore) GetUpdatesOffset() (int, error) {
+	var offset int
+
+	row := s.db.QueryRow("SELECT value FROM settings WHERE name=$1", updatesOffsetSetting)
+	err := row.Scan(&offset)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("fetching updates offset: %v", err)
+	}
+
+	return offset, nil
+}
+
+// SetUpdatesOffset stores the id of the next update to be pulled from Telegram.
+func (s *SQLiteStore) SetUpdatesOffset(offset int) (int64, error) {
+	result, err := s.db.Exec(`INSERT INTO settings (name, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`, updatesOffsetSetting, offset, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
+
+// processedUpdatesRetention is how long the handled updates are remembered for; Telegram stops delivering an update
+// once it is a day old.
+const processedUpdatesRetention = 24 * time.Hour
+
+// IsUpdateProcessed reports whether the update was handled already.
+func (s *SQLiteStore) IsUpdateProcessed(updateId int) (bool, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM processed_updates WHERE update_id=?", updateId).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("fetching processed update: %v", err)
+	}
+
+	return count > 0, nil
+}
+
+// SetUpdateProcessed records the handling of the update, forgetting about the updates handled long ago.
+func (s *SQLiteStore) SetUpdateProcessed(updateId int) (int64, error) {
+	now := time.Now()
+
+	_, err := s.db.Exec("DELETE FROM processed_updates WHERE created_at < ?", now.Add(-processedUpdatesRetention))
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := s.db.Exec("INSERT OR IGNORE INTO processed_updates (update_id, created_at) VALUES (?, ?)", updateId, now)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
+
+// MatchQuery describes a film whose matching watchers are looked up.
+type MatchQuery struct {
+	Provider string
+	// FilmId is the provider's film id; the chats that muted the film are skipped.
+	FilmId   string
+	CinemaId string
+	Country  string
+	// Names are the film's original and localized names.
+	Names     []string
+	AgeRating string
+	// Events are the film's screenings checked against the watchers' filters; nil when they aren't known yet.
+	Events []Event
+	// FilteredOnly restricts the matches to the watchers filtering the screenings, which are checked again
+	// as screenings are added for a film the other watchers were already notified about.
+	FilteredOnly bool
+}
+
+// GetWatchersMatchingQuery returns the chats having watchers that match the given film, along with the matching terms.
+// Only the chats following the provider's given cinema and its country are returned;
+// chats that haven't picked any cinema or country follow all of them. Chats that blocked the bot are skipped.
+func (s *SQLiteStore) GetWatchersMatchingQuery(q MatchQuery) ([]WatcherMatch, error) {
+	return s.getWatchersMatchingQuery(q, matchOnSale)
+}
+
+// GetAnnouncementWatchersMatchingQuery is like GetWatchersMatchingQuery, but it only considers the chats
+// that opted in for notifications about films announced as coming soon.
+func (s *SQLiteStore) GetAnnouncementWatchersMatchingQuery(q MatchQuery) ([]WatcherMatch, error) {
+	return s.getWatchersMatchingQuery(q, matchAnnouncement)
+}
+
+// GetNewScreeningsWatchersMatchingQuery is like GetWatchersMatchingQuery, but it only considers the watchers
+// that opted in for notifications about screenings added for already announced films.
+func (s *SQLiteStore) GetNewScreeningsWatchersMatchingQuery(q MatchQuery) ([]WatcherMatch, error) {
+	return s.getWatchersMatchingQuery(q, matchNewScreenings)
+}
+
+// matchKind tells which of the matching watchers are relevant for a notification.
+type matchKind int8
+
+const (
+	matchOnSale matchKind = iota
+	matchAnnouncement
+	matchNewScreenings
+)
+
+// sqliteChatConditions selects the watchers of the chats that follow the film's cinema and country, haven't blocked the bot
+// nor muted the film and want the kind of notification; its arguments are given by `sqliteChatArgs`.
+const sqliteChatConditions = `(
+			NOT EXISTS (SELECT 1 FROM chat_cinemas WHERE chat_cinemas.chat_id = w.chat_id)
+			OR EXISTS (SELECT 1 FROM chat_cinemas WHERE chat_cinemas.chat_id = w.chat_id AND chat_cinemas.provider = ? AND chat_cinemas.cinema_id = ?)
+		)
+		AND NOT EXISTS (SELECT 1 FROM chats WHERE chats.chat_id = w.chat_id AND chats.country <> '' AND chats.country <> ?)
+		AND NOT EXISTS (SELECT 1 FROM chats WHERE chats.chat_id = w.chat_id AND chats.blocked = 1)
+		AND NOT EXISTS (SELECT 1 FROM muted_films WHERE muted_films.chat_id = w.chat_id AND muted_films.provider = ? AND muted_films.original_id = ?)
+		AND (? <> ? OR NOT EXISTS (SELECT 1 FROM chats WHERE chats.chat_id = w.chat_id AND chats.on_sale_alerts = 0))
+		AND (? <> ? OR EXISTS (SELECT 1 FROM chats WHERE chats.chat_id = w.chat_id AND chats.announcement_alerts = 1))
+		AND (? <> ? OR w.new_screenings = 1)`
+
+func sqliteChatArgs(q MatchQuery, kind matchKind) []interface{} {
+	return []interface{}{q.Provider, q.CinemaId, q.Country, q.Provider, q.FilmId,
+		kind, matchOnSale, kind, matchAnnouncement, kind, matchNewScreenings}
+}
+
+func (s *SQLiteStore) getWatchersMatchingQuery(q MatchQuery, kind matchKind) ([]WatcherMatch, error) {
+	// the pattern watchers are evaluated against every film, which their number per chat is capped for
+	rows, err := s.db.Query(`SELECT w.id, w.chat_id, w.keywords, w.pattern,
+		w.filter_format, w.filter_audio, w.filter_subtitles, w.filter_age_rating
+		FROM watchers w
+		WHERE w.pattern <> '' AND `+sqliteChatConditions, sqliteChatArgs(q, kind)...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching pattern watchers: %v", err)
+	}
+
+	candidates, err := scanPatternCandidates(rows)
 	if err != nil {
-		return s
+		return nil, err
+	}
+
+	// the terms sharing a trigram with the film's names are the candidates, which are then scored,
+	// along with the terms too short for having any trigram
+	var trigrams []string
+	for _, trigram := range matchingTrigrams(NormaliseString(strings.Join(q.Names, " "))) {
+		trigrams = append(trigrams, `"`+trigram+`"`)
+	}
+
+	termCondition := "length(t.term_normalised) < ?"
+	args := []interface{}{trigramLength}
+
+	query := strings.Join(trigrams, " OR ")
+	if len(query) > 0 {
+		termCondition = "(t.id IN (SELECT rowid FROM watcher_terms_fts WHERE watcher_terms_fts.term_normalised MATCH ?) OR " + termCondition + ")"
+		args = append([]interface{}{query}, args...)
 	}
 
-	s1 := r1.ReplaceAllString(s, "")
+	rows, err = s.db.Query(`SELECT w.id, w.chat_id, w.keywords, w.strictness, t.term, t.term_normalised,
+		w.filter_format, w.filter_audio, w.filter_subtitles, w.filter_age_rating
+		FROM watcher_terms t JOIN watchers w ON w.id = t.watcher_id
+		WHERE `+termCondition+` AND `+sqliteChatConditions, append(args, sqliteChatArgs(q, kind)...)...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching watchers for query %s: %v", query, err)
+	}
 
-	r2, err := regexp.Compile(" {2,}")
+	termCandidates, err := scanMatchCandidates(rows)
 	if err != nil {
-		return s1
+		return nil, err
 	}
 
-	s2 := r2.ReplaceAllString(s1, " ")
+	return selectMatches(append(candidates, termCandidates...), q), nil
+}
+
+// joinList serializes a list of values for storing it in a single column.
+func joinList(values []string) string {
+	return strings.Join(values, ",")
+}
+
+// splitList deserializes a list of values stored by `joinList`.
+func splitList(s string) []string {
+	if len(s) == 0 {
+		return nil
+	}
 
-	return strings.ToLower(s2)
+	return strings.Split(s, ",")
 }
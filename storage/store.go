@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"time"
+)
+
+// Store keeps the records of the bot; see `SQLiteStore` for the documentation of each method.
+// All the implementations must pass the same conformance tests (see `testStore`).
+type Store interface {
+	FilmStore
+	ChatStore
+	WatcherStore
+	MessageStore
+	NotificationStore
+
+	// GetUpdatesOffset and SetUpdatesOffset keep track of the updates pulled from Telegram.
+	GetUpdatesOffset() (int, error)
+	SetUpdatesOffset(offset int) (int64, error)
+	// IsUpdateProcessed and SetUpdateProcessed keep track of the updates handled, which Telegram may deliver again.
+	IsUpdateProcessed(updateId int) (bool, error)
+	SetUpdateProcessed(updateId int) (int64, error)
+
+	GetMigrations() ([]Migration, error)
+	Migrate() ([]Migration, error)
+	Close() error
+}
+
+// FilmStore keeps the films, both available for booking and announced as coming soon, along with their screenings.
+type FilmStore interface {
+	FilmExists(provider string, filmId string, cinemaId string) (bool, error)
+	GetFilmName(provider string, filmId string) (string, error)
+	GetFilm(provider string, filmId string, cinemaId string) (*Film, error)
+	GetFilmByRowId(rowId int64) (*Film, error)
+	InsertFilm(film *Film) (int64, error)
+	SetFilmNotified(rowId int64) (int64, error)
+	GetAgeRatings() ([]string, error)
+	ClaimLegacyFilms(provider string, cinemaIds []string) (int64, error)
+
+	GetUpcomingFilm(provider string, filmId string, cinemaId string) (*Film, error)
+	GetUpcomingFilmByRowId(rowId int64) (*Film, error)
+	InsertUpcomingFilm(film *Film) (int64, error)
+	SetUpcomingFilmNotified(rowId int64) (int64, error)
+
+	InsertEvent(e *Event) (int64, error)
+	GetUpcomingEvents(provider string, filmId string, cinemaId string, after string, limit int) ([]Event, error)
+	GetFilmsWithEvents(provider string, cinemaId string) (map[string]bool, error)
+	GetEventsHorizon(provider string, cinemaId string) (string, error)
+	SetEventsHorizon(provider string, cinemaId string, day string) (int64, error)
+}
+
+// ChatStore keeps the chats' status and preferences.
+type ChatStore interface {
+	UpdateChatStatus(chatId int, userId int, status ChatStatus) (int64, error)
+	GetChatStatus(chatId int, userId int) (ChatStatus, error)
+	Subscribe(chatId int, userId int) (int64, error)
+	Unsubscribe(chatId int, userId int) (int64, error)
+	SetChatBlocked(chatId int) (int64, error)
+
+	GetChatCountry(chatId int, userId int) (string, error)
+	SetChatCountry(chatId int, userId int, country string) (int64, error)
+	GetChatAlerts(chatId int, userId int) (map[Alert]bool, error)
+	ToggleChatAlert(chatId int, userId int, alert Alert) (bool, error)
+	GetChatCinemas(chatId int) ([]ChatCinema, error)
+	ToggleChatCinema(chatId int, provider string, cinemaId string) (bool, error)
+	ToggleMutedFilm(chatId int, provider string, filmId string) (bool, error)
+
+	SetPendingWatcher(chatId int, userId int, keywords string) (int64, error)
+	GetPendingWatcher(chatId int, userId int) (string, error)
+}
+
+// WatcherStore keeps the chats' watchers and finds the ones matching a film.
+type WatcherStore interface {
+	InsertWatcher(chatId int, keywords string) (int64, error)
+	RemoveWatcher(chatId int, keywords string) (int64, error)
+	RemoveWatcherById(chatId int, watcherId int64) (int64, error)
+	GetWatchers(chatId int) ([]string, error)
+	GetWatcherList(chatId int) ([]Watcher, error)
+	GetWatchersWithNewScreenings(chatId int) ([]string, error)
+	ToggleWatcherNewScreenings(chatId int, keywords string) (int64, bool, error)
+	SetWatcherFilter(chatId int, keywords string, filter WatcherFilter, value string) (int64, error)
+	SetWatcherStrictness(chatId int, keywords string, strictness Strictness) (int64, error)
+	CountPatternWatchers(chatId int) (int, error)
+	GetWatchersFilters(chatId int) (map[string]WatcherFilters, error)
+
+	GetWatchersMatchingQuery(q MatchQuery) ([]WatcherMatch, error)
+	GetAnnouncementWatchersMatchingQuery(q MatchQuery) ([]WatcherMatch, error)
+	GetNewScreeningsWatchersMatchingQuery(q MatchQuery) ([]WatcherMatch, error)
+}
+
+// MessageStore keeps the messages received by the bot.
+type MessageStore interface {
+	InsertMessage(m *Message) (int64, error)
+}
+
+// NotificationStore keeps the outbox of notifications and the history of the delivered ones.
+type NotificationStore interface {
+	InsertNotification(chatId int, payload string, about NotifiedFilm, match WatcherMatch) (int64, error)
+	GetNotificationHistory(chatId int, limit int) ([]SentNotification, error)
+	ClaimNotifications(limit int) ([]Notification, error)
+	ReleaseClaimedNotifications() (int64, error)
+	MarkNotificationSending(id int64) (int64, error)
+	MarkNotificationSent(id int64) (int64, error)
+	MarkNotificationFailed(id int64, reason string, retryAt time.Time) (int64, error)
+}
+
+var (
+	_ Store = (*SQLiteStore)(nil)
+	_ Store = (*PostgresStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,923 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStore runs the conformance tests every Store implementation must pass; `open` returns an empty, migrated store.
+func testStore(t *testing.T, open func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s Store)
+	}{
+		{"Migrations", testStoreMigrations},
+		{"Films", testStoreFilms},
+		{"LegacyFilms", testStoreLegacyFilms},
+		{"UpcomingFilms", testStoreUpcomingFilms},
+		{"Events", testStoreEvents},
+		{"Messages", testStoreMessages},
+		{"Chats", testStoreChats},
+		{"Watchers", testStoreWatchers},
+		{"Matching", testStoreMatching},
+		{"MatchingTerms", testStoreMatchingTerms},
+		{"Notifications", testStoreNotifications},
+		{"UpdatesOffset", testStoreUpdatesOffset},
+		{"ProcessedUpdates", testStoreProcessedUpdates},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := open(t)
+			t.Cleanup(func() {
+				s.Close()
+			})
+
+			test.test(t, s)
+		})
+	}
+}
+
+// check fails the test if the error isn't nil.
+func check(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+func testStoreMigrations(t *testing.T, s Store) {
+	applied, err := s.Migrate()
+	check(t, err)
+	if len(applied) != 0 {
+		t.Errorf("Expected no pending migrations, got %+v", applied)
+	}
+
+	migrations, err := s.GetMigrations()
+	check(t, err)
+	for _, m := range migrations {
+		if m.AppliedAt.IsZero() {
+			t.Errorf("Expected migration %d_%s to be applied", m.Version, m.Name)
+		}
+	}
+}
+
+func testStoreLegacyFilms(t *testing.T, s Store) {
+	// a legacy film has no cinema; one of the cinemas has the film already
+	for _, f := range []Film{{Provider: "cc", Id: "1", Name: "Dune"}, {Provider: "cc", Id: "1", CinemaId: "10", Name: "Dune"}, {Provider: "other", Id: "2", Name: "Up"}} {
+		_, err := s.InsertFilm(&f)
+		check(t, err)
+	}
+
+	claimed, err := s.ClaimLegacyFilms("cc", []string{"10", "11"})
+	check(t, err)
+	if claimed != 1 {
+		t.Errorf("Expected 1 film claimed, got %d", claimed)
+	}
+
+	tables := []struct {
+		provider string
+		filmId   string
+		cinemaId string
+		expected string
+	}{
+		{"cc", "1", "", "<nil>"},
+		{"cc", "1", "10", "false"},
+		{"cc", "1", "11", "true"},
+		{"other", "2", "", "false"},
+	}
+
+	for _, table := range tables {
+		f, err := s.GetFilm(table.provider, table.filmId, table.cinemaId)
+		check(t, err)
+
+		notified := "<nil>"
+		if f != nil {
+			notified = fmt.Sprint(f.Notified)
+		}
+		if notified != table.expected {
+			t.Errorf("Expected film %s of %s at cinema %q notified: %s, got %s", table.filmId, table.provider, table.cinemaId, table.expected, notified)
+		}
+	}
+}
+
+func testStoreFilms(t *testing.T, s Store) {
+	f, err := s.GetFilm("cc", "1", "10")
+	check(t, err)
+	if f != nil {
+		t.Fatalf("Expected no film, got %+v", f)
+	}
+
+	film := Film{Provider: "cc", Id: "1", CinemaId: "10", Name: "Clubul de lupte", OriginalName: "Fight Club", Link: "l", PosterLink: "p",
+		ReleaseDate: "1999-10-15", FilmDetails: FilmDetails{Length: 139, ReleaseYear: "1999", Genres: []string{"drama"}, AgeRating: "N-15",
+			Formats: []string{"2D", "IMAX"}, OriginalLanguage: "en", SubtitleLanguages: []string{"ro"}}}
+	rowsAffected, err := s.InsertFilm(&film)
+	check(t, err)
+	if rowsAffected != 1 || film.RowId == 0 {
+		t.Fatalf("Expected the film to be inserted, got %d rows affected and row id %d", rowsAffected, film.RowId)
+	}
+
+	_, err = s.InsertFilm(&Film{Provider: "cc", Id: "2", CinemaId: "10", Name: "Avatar", OriginalName: "Avatar", FilmDetails: FilmDetails{AgeRating: "AG"}})
+	check(t, err)
+
+	f, err = s.GetFilm("cc", "1", "10")
+	check(t, err)
+	// the release date isn't read back
+	expected := film
+	expected.ReleaseDate = ""
+	if fmt.Sprintf("%+v", f) != fmt.Sprintf("%+v", &expected) {
+		t.Errorf("Expected %+v, got %+v", &expected, f)
+	}
+
+	f, err = s.GetFilmByRowId(film.RowId)
+	check(t, err)
+	if f == nil || f.Id != "1" {
+		t.Errorf("Expected film 1, got %+v", f)
+	}
+
+	exists, err := s.FilmExists("cc", "1", "10")
+	check(t, err)
+	if !exists {
+		t.Errorf("Expected the film to exist")
+	}
+	exists, err = s.FilmExists("cc", "1", "11")
+	check(t, err)
+	if exists {
+		t.Errorf("Expected the film not to exist at another cinema")
+	}
+
+	name, err := s.GetFilmName("cc", "1")
+	check(t, err)
+	if name != "Clubul de lupte" {
+		t.Errorf("Expected the film's name, got %q", name)
+	}
+	name, err = s.GetFilmName("cc", "3")
+	check(t, err)
+	if name != "" {
+		t.Errorf("Expected no name, got %q", name)
+	}
+
+	rowsAffected, err = s.SetFilmNotified(film.RowId)
+	check(t, err)
+	f, err = s.GetFilm("cc", "1", "10")
+	check(t, err)
+	if rowsAffected != 1 || !f.Notified {
+		t.Errorf("Expected the film to be notified, got %+v", f)
+	}
+
+	ratings, err := s.GetAgeRatings()
+	check(t, err)
+	if fmt.Sprint(ratings) != "[AG N-15]" {
+		t.Errorf("Expected the sorted age ratings, got %v", ratings)
+	}
+}
+
+func testStoreUpcomingFilms(t *testing.T, s Store) {
+	film := Film{Provider: "cc", Id: "1", CinemaId: "10", Name: "Dune", OriginalName: "Dune", Link: "l", PosterLink: "p", ReleaseDate: "2024-03-01"}
+	rowsAffected, err := s.InsertUpcomingFilm(&film)
+	check(t, err)
+	if rowsAffected != 1 || film.RowId == 0 {
+		t.Fatalf("Expected the film to be inserted, got %d rows affected and row id %d", rowsAffected, film.RowId)
+	}
+
+	_, err = s.SetUpcomingFilmNotified(film.RowId)
+	check(t, err)
+
+	f, err := s.GetUpcomingFilm("cc", "1", "10")
+	check(t, err)
+	film.Notified = true
+	if fmt.Sprintf("%+v", f) != fmt.Sprintf("%+v", &film) {
+		t.Errorf("Expected %+v, got %+v", &film, f)
+	}
+
+	f, err = s.GetUpcomingFilm("cc", "1", "11")
+	check(t, err)
+	if f != nil {
+		t.Errorf("Expected no film, got %+v", f)
+	}
+
+	f, err = s.GetUpcomingFilmByRowId(film.RowId)
+	check(t, err)
+	if fmt.Sprintf("%+v", f) != fmt.Sprintf("%+v", &film) {
+		t.Errorf("Expected %+v, got %+v", &film, f)
+	}
+
+	f, err = s.GetUpcomingFilmByRowId(film.RowId + 100)
+	check(t, err)
+	if f != nil {
+		t.Errorf("Expected no film, got %+v", f)
+	}
+
+	f, err = s.GetFilm("cc", "1", "10")
+	check(t, err)
+	if f != nil {
+		t.Errorf("Expected the upcoming film not to be available for booking, got %+v", f)
+	}
+}
+
+func testStoreEvents(t *testing.T, s Store) {
+	events := []Event{
+		{Provider: "cc", Id: "b", FilmId: "1", CinemaId: "10", BusinessDay: "2024-03-02", DateTime: "2024-03-02T20:00:00", Formats: []string{"IMAX"}},
+		{Provider: "cc", Id: "a", FilmId: "1", CinemaId: "10", BusinessDay: "2024-03-01", DateTime: "2024-03-01T20:00:00", DubbedLanguages: []string{"ro"}},
+		{Provider: "cc", Id: "c", FilmId: "1", CinemaId: "10", BusinessDay: "2024-03-03", DateTime: "2024-03-03T20:00:00", BookingLink: "b", Auditorium: "1"},
+		{Provider: "cc", Id: "d", FilmId: "2", CinemaId: "11", BusinessDay: "2024-03-01", DateTime: "2024-03-01T20:00:00"},
+	}
+
+	for _, e := range events {
+		rowsAffected, err := s.InsertEvent(&e)
+		check(t, err)
+		if rowsAffected != 1 {
+			t.Errorf("Expected event %s to be inserted", e.Id)
+		}
+	}
+
+	rowsAffected, err := s.InsertEvent(&events[0])
+	check(t, err)
+	if rowsAffected != 0 {
+		t.Errorf("Expected a known event not to be inserted again")
+	}
+
+	upcoming, err := s.GetUpcomingEvents("cc", "1", "10", "2024-03-01T20:00:00", -1)
+	check(t, err)
+	if fmt.Sprintf("%+v", upcoming) != fmt.Sprintf("%+v", []Event{events[0], events[2]}) {
+		t.Errorf("Expected the events after the first one, got %+v", upcoming)
+	}
+
+	upcoming, err = s.GetUpcomingEvents("cc", "1", "10", "", 1)
+	check(t, err)
+	if fmt.Sprintf("%+v", upcoming) != fmt.Sprintf("%+v", []Event{events[1]}) {
+		t.Errorf("Expected the first event, got %+v", upcoming)
+	}
+
+	films, err := s.GetFilmsWithEvents("cc", "10")
+	check(t, err)
+	if fmt.Sprint(films) != "map[1:true]" {
+		t.Errorf("Expected film 1 only, got %v", films)
+	}
+
+	horizon, err := s.GetEventsHorizon("cc", "10")
+	check(t, err)
+	if horizon != "" {
+		t.Errorf("Expected no horizon, got %q", horizon)
+	}
+
+	for _, expected := range []string{"2024-03-08", "2024-03-09"} {
+		_, err = s.SetEventsHorizon("cc", "10", expected)
+		check(t, err)
+		horizon, err = s.GetEventsHorizon("cc", "10")
+		check(t, err)
+		if horizon != expected {
+			t.Errorf("Expected horizon %q, got %q", expected, horizon)
+		}
+	}
+
+	horizon, err = s.GetEventsHorizon("cc", "11")
+	check(t, err)
+	if horizon != "" {
+		t.Errorf("Expected no horizon for another cinema, got %q", horizon)
+	}
+}
+
+func testStoreMessages(t *testing.T, s Store) {
+	rowsAffected, err := s.InsertMessage(&Message{MessageId: 1, FromId: 2, FromFirstName: "Tyler", ChatId: 3, ChatFirstName: "Tyler", Text: "/start"})
+	check(t, err)
+	if rowsAffected != 1 {
+		t.Errorf("Expected the message to be inserted")
+	}
+
+	// the message of an update delivered again is stored once, unlike its edited version
+	tables := []struct {
+		text     string
+		expected int64
+	}{
+		{"/start", 0},
+		{"/stop", 1},
+	}
+
+	for _, table := range tables {
+		rowsAffected, err = s.InsertMessage(&Message{MessageId: 1, FromId: 2, FromFirstName: "Tyler", ChatId: 3, ChatFirstName: "Tyler", Text: table.text})
+		check(t, err)
+		if rowsAffected != table.expected {
+			t.Errorf("Expected %d messages inserted for %q, got %d", table.expected, table.text, rowsAffected)
+		}
+	}
+}
+
+func testStoreChats(t *testing.T, s Store) {
+	status, err := s.GetChatStatus(1, 1)
+	check(t, err)
+	if status != ChatIdle {
+		t.Errorf("Expected an unknown chat to be idle, got %d", status)
+	}
+
+	alerts, err := s.GetChatAlerts(1, 1)
+	check(t, err)
+	if alerts[AlertAnnouncement] || !alerts[AlertOnSale] {
+		t.Errorf("Expected the default alerts, got %v", alerts)
+	}
+
+	rowsAffected, err := s.Subscribe(1, 1)
+	check(t, err)
+	if rowsAffected != 0 {
+		t.Errorf("Expected an unknown chat not to be subscribed")
+	}
+
+	_, err = s.UpdateChatStatus(1, 1, ChatWaitingForWatcherToAdd)
+	check(t, err)
+	_, err = s.UpdateChatStatus(1, 1, ChatWaitingForCountry)
+	check(t, err)
+	status, err = s.GetChatStatus(1, 1)
+	check(t, err)
+	if status != ChatWaitingForCountry {
+		t.Errorf("Expected the last status, got %d", status)
+	}
+
+	for _, f := range []func(int, int) (int64, error){s.Unsubscribe, s.Subscribe} {
+		rowsAffected, err = f(1, 1)
+		check(t, err)
+		if rowsAffected != 1 {
+			t.Errorf("Expected the chat to be updated")
+		}
+	}
+
+	_, err = s.SetChatCountry(1, 1, "hu")
+	check(t, err)
+	country, err := s.GetChatCountry(1, 1)
+	check(t, err)
+	if country != "hu" {
+		t.Errorf("Expected the chat's country, got %q", country)
+	}
+
+	enabled, err := s.ToggleChatAlert(1, 1, AlertAnnouncement)
+	check(t, err)
+	alerts, err = s.GetChatAlerts(1, 1)
+	check(t, err)
+	if !enabled || !alerts[AlertAnnouncement] || !alerts[AlertOnSale] {
+		t.Errorf("Expected the announcements to be enabled, got %v", alerts)
+	}
+
+	for _, expected := range []bool{true, false, true} {
+		selected, err := s.ToggleChatCinema(1, "cc", "10")
+		check(t, err)
+		if selected != expected {
+			t.Errorf("Expected the cinema's selection to be %v", expected)
+		}
+	}
+	cinemas, err := s.GetChatCinemas(1)
+	check(t, err)
+	if fmt.Sprint(cinemas) != "[{cc 10}]" {
+		t.Errorf("Expected the selected cinema, got %v", cinemas)
+	}
+
+	for _, expected := range []bool{true, false} {
+		muted, err := s.ToggleMutedFilm(1, "cc", "1")
+		check(t, err)
+		if muted != expected {
+			t.Errorf("Expected the film to be muted: %v", expected)
+		}
+	}
+
+	_, err = s.SetPendingWatcher(1, 1, "Fight Club")
+	check(t, err)
+	keywords, err := s.GetPendingWatcher(1, 1)
+	check(t, err)
+	if keywords != "Fight Club" {
+		t.Errorf("Expected the pending watcher, got %q", keywords)
+	}
+
+	rowsAffected, err = s.SetChatBlocked(1)
+	check(t, err)
+	if rowsAffected != 1 {
+		t.Errorf("Expected the chat to be blocked")
+	}
+}
+
+func testStoreWatchers(t *testing.T, s Store) {
+	for _, keywords := range []string{" Fight Club ", "avatar", "Blade Runner"} {
+		rowsAffected, err := s.InsertWatcher(1, keywords)
+		check(t, err)
+		if rowsAffected != 1 {
+			t.Errorf("Expected watcher %q to be inserted", keywords)
+		}
+	}
+
+	for _, keywords := range []string{"fight club", "  "} {
+		rowsAffected, err := s.InsertWatcher(1, keywords)
+		check(t, err)
+		if rowsAffected != 0 {
+			t.Errorf("Expected watcher %q not to be inserted", keywords)
+		}
+	}
+
+	_, err := s.InsertWatcher(2, "Dune")
+	check(t, err)
+
+	watchers, err := s.GetWatchers(1)
+	check(t, err)
+	if fmt.Sprint(watchers) != "[avatar Blade Runner Fight Club]" {
+		t.Errorf("Expected the chat's watchers ordered regardless of case, got %v", watchers)
+	}
+
+	rowsAffected, enabled, err := s.ToggleWatcherNewScreenings(1, "AVATAR")
+	check(t, err)
+	if rowsAffected != 1 || !enabled {
+		t.Errorf("Expected the new screenings to be enabled")
+	}
+	watchers, err = s.GetWatchersWithNewScreenings(1)
+	check(t, err)
+	if fmt.Sprint(watchers) != "[avatar]" {
+		t.Errorf("Expected the watcher notifying about new screenings, got %v", watchers)
+	}
+
+	_, err = s.SetWatcherFilter(1, "fight club", FilterFormat, "IMAX")
+	check(t, err)
+	_, err = s.SetWatcherFilter(1, "fight club", FilterAudio, AudioOriginal)
+	check(t, err)
+	filters, err := s.GetWatchersFilters(1)
+	check(t, err)
+	if filters["Fight Club"] != (WatcherFilters{Format: "IMAX", Audio: AudioOriginal}) || !filters["avatar"].IsEmpty() {
+		t.Errorf("Expected the watcher's filters, got %+v", filters)
+	}
+
+	list, err := s.GetWatcherList(1)
+	check(t, err)
+	if len(list) != 3 || list[2].Keywords != "Fight Club" || list[2].Filters.Format != "IMAX" {
+		t.Fatalf("Expected the chat's watchers with their filters, got %+v", list)
+	}
+
+	rowsAffected, err = s.RemoveWatcherById(2, list[2].Id)
+	check(t, err)
+	if rowsAffected != 0 {
+		t.Errorf("Expected another chat's watcher not to be removed")
+	}
+	rowsAffected, err = s.RemoveWatcherById(1, list[2].Id)
+	check(t, err)
+	if rowsAffected != 1 {
+		t.Errorf("Expected the watcher to be removed")
+	}
+
+	rowsAffected, err = s.RemoveWatcher(1, "avatar")
+	check(t, err)
+	if rowsAffected != 1 {
+		t.Errorf("Expected the watcher to be removed")
+	}
+
+	watchers, err = s.GetWatchers(1)
+	check(t, err)
+	if fmt.Sprint(watchers) != "[Blade Runner]" {
+		t.Errorf("Expected the remaining watcher, got %v", watchers)
+	}
+}
+
+func testStoreMatching(t *testing.T, s Store) {
+	// chat 1 follows everything, chat 2 picked another cinema, chat 3 another country,
+	// chat 4 muted the film, chat 5 blocked the bot and chat 6 only wants announcements
+	for chatId := 1; chatId <= 7; chatId++ {
+		_, err := s.UpdateChatStatus(chatId, chatId, ChatIdle)
+		check(t, err)
+		_, err = s.InsertWatcher(chatId, "Fight Club")
+		check(t, err)
+	}
+	_, err := s.ToggleChatCinema(2, "cc", "11")
+	check(t, err)
+	_, err = s.SetChatCountry(3, 3, "hu")
+	check(t, err)
+	_, err = s.ToggleMutedFilm(4, "cc", "1")
+	check(t, err)
+	_, err = s.SetChatBlocked(5)
+	check(t, err)
+	_, err = s.ToggleChatAlert(6, 6, AlertOnSale)
+	check(t, err)
+	_, err = s.ToggleChatAlert(6, 6, AlertAnnouncement)
+	check(t, err)
+	// chat 7 wants IMAX screenings and new screenings
+	_, err = s.SetWatcherFilter(7, "Fight Club", FilterFormat, "IMAX")
+	check(t, err)
+	_, _, err = s.ToggleWatcherNewScreenings(7, "Fight Club")
+	check(t, err)
+	// chat 8 watches for something else
+	_, err = s.InsertWatcher(8, "Avatar")
+	check(t, err)
+
+	q := MatchQuery{Provider: "cc", FilmId: "1", CinemaId: "10", Country: "ro", Names: []string{"Fight Club", "Clubul de lupte"}}
+
+	tables := []struct {
+		name         string
+		match        func(MatchQuery) ([]WatcherMatch, error)
+		events       []Event
+		filteredOnly bool
+		expected     []int
+	}{
+		{"on sale", s.GetWatchersMatchingQuery, nil, false, []int{1}},
+		{"on sale, 2D", s.GetWatchersMatchingQuery, []Event{{Formats: []string{"2D"}}}, false, []int{1}},
+		{"on sale, IMAX", s.GetWatchersMatchingQuery, []Event{{Formats: []string{"IMAX"}}}, false, []int{1, 7}},
+		{"on sale, IMAX added", s.GetWatchersMatchingQuery, []Event{{Formats: []string{"IMAX"}}}, true, []int{7}},
+		{"announcement", s.GetAnnouncementWatchersMatchingQuery, nil, false, []int{6}},
+		{"new screenings", s.GetNewScreeningsWatchersMatchingQuery, []Event{{Formats: []string{"IMAX"}}}, false, []int{7}},
+	}
+
+	for _, table := range tables {
+		q.Events = table.events
+		q.FilteredOnly = table.filteredOnly
+		matches, err := table.match(q)
+		check(t, err)
+
+		var chats []int
+		got := make(map[int]bool)
+		for _, m := range matches {
+			chats = append(chats, m.ChatId)
+			got[m.ChatId] = true
+		}
+		expected := make(map[int]bool)
+		for _, chatId := range table.expected {
+			expected[chatId] = true
+		}
+
+		if len(chats) != len(got) || fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected chats %v, got %v", table.name, table.expected, chats)
+		}
+	}
+
+	q.Names = []string{"Dune", "Du"}
+	matches, err := s.GetWatchersMatchingQuery(q)
+	check(t, err)
+	if len(matches) != 0 {
+		t.Errorf("Expected no chats for another film, got %v", matches)
+	}
+}
+
+func testStoreMatchingTerms(t *testing.T, s Store) {
+	watchers := []struct {
+		chatId   int
+		keywords string
+	}{
+		{1, "Club"},
+		{1, "Fight Club"},
+		{2, "Fight Club, Clubul de lupte"},
+		{3, "Fight, fight  club, Fight Club"},
+		{5, "Clubul bătăuşilor"},
+		{6, "1917"},
+		// the terms too short for the prefilter's trigrams
+		{6, "F1 OR It"},
+	}
+	for _, w := range watchers {
+		_, err := s.UpdateChatStatus(w.chatId, w.chatId, ChatIdle)
+		check(t, err)
+		rowsAffected, err := s.InsertWatcher(w.chatId, w.keywords)
+		check(t, err)
+		if rowsAffected != 1 {
+			t.Fatalf("Expected watcher %q to be inserted", w.keywords)
+		}
+	}
+
+	rowsAffected, err := s.InsertWatcher(4, " , ,")
+	check(t, err)
+	if rowsAffected != 0 {
+		t.Errorf("Expected a watcher without terms not to be inserted")
+	}
+
+	q := MatchQuery{Provider: "cc", FilmId: "1", CinemaId: "10", Country: "ro"}
+
+	tables := []struct {
+		names    []string
+		expected string
+	}{
+		// each chat is reported once, along with its longest matching term
+		{[]string{"Fight Club"}, "[{1 Fight Club} {2 Fight Club} {3 fight club}]"},
+		// the terms are matched as whole words
+		{[]string{"Clubul de lupte"}, "[{2 Clubul de lupte}]"},
+		{[]string{"Fight Clubbing"}, "[{3 Fight}]"},
+		{[]string{"Avatar"}, "[]"},
+		// the diacritics are left out and the digits are kept
+		{[]string{"Clubul Bătăușilor"}, "[{5 Clubul bătăuşilor}]"},
+		{[]string{"1917"}, "[{6 1917}]"},
+		{[]string{"F1: The Movie"}, "[{6 F1}]"},
+		{[]string{"It", "Acesta"}, "[{6 It}]"},
+		{[]string{"Itinerary"}, "[]"},
+	}
+
+	for _, table := range tables {
+		q.Names = table.names
+		matches, err := s.GetWatchersMatchingQuery(q)
+		check(t, err)
+
+		if got := formatMatches(matches); got != table.expected {
+			t.Errorf("%v: expected matches %s, got %s", table.names, table.expected, got)
+		}
+	}
+
+	// the fuzzy watchers allow for typos, the exact ones want the whole name
+	_, err = s.InsertWatcher(7, "Oppenhimer, Avatr")
+	check(t, err)
+	_, err = s.SetWatcherStrictness(7, "oppenhimer, avatr", StrictnessFuzzy)
+	check(t, err)
+	_, err = s.InsertWatcher(8, "Avatr")
+	check(t, err)
+	_, err = s.InsertWatcher(9, "Avatar")
+	check(t, err)
+	rowsAffected, err = s.SetWatcherStrictness(9, "Avatar", StrictnessExact)
+	check(t, err)
+	if rowsAffected != 1 {
+		t.Errorf("Expected the watcher's strictness to be set")
+	}
+
+	list, err := s.GetWatcherList(9)
+	check(t, err)
+	if len(list) != 1 || list[0].Strictness != StrictnessExact {
+		t.Errorf("Expected the watcher's strictness to be listed, got %+v", list)
+	}
+
+	strictTables := []struct {
+		names    []string
+		expected string
+	}{
+		{[]string{"Oppenheimer"}, "[{7 Oppenhimer}]"},
+		{[]string{"Avatar"}, "[{7 Avatr} {9 Avatar}]"},
+		{[]string{"Avatar: The Way of Water"}, "[{7 Avatr}]"},
+		{[]string{"Aviator"}, "[]"},
+	}
+
+	for _, table := range strictTables {
+		q.Names = table.names
+		matches, err := s.GetWatchersMatchingQuery(q)
+		check(t, err)
+
+		if got := formatMatches(matches); got != table.expected {
+			t.Errorf("%v: expected matches %s, got %s", table.names, table.expected, got)
+		}
+
+		for _, m := range matches {
+			if m.ChatId == 7 && (m.Strictness != StrictnessFuzzy || m.Score < fuzzyThreshold || m.Score >= 1) {
+				t.Errorf("%v: expected a fuzzy match scoring less than 1, got %+v", table.names, m)
+			}
+		}
+	}
+
+	// the films having an excluded word in their names aren't matched
+	_, err = s.InsertWatcher(10, "Batman -lego OR Joker")
+	check(t, err)
+
+	exclusionTables := []struct {
+		names    []string
+		expected string
+	}{
+		{[]string{"The Batman"}, "[{10 Batman}]"},
+		{[]string{"The LEGO Batman Movie"}, "[]"},
+		{[]string{"Joker: Folie à Deux"}, "[{10 Joker}]"},
+		{[]string{"LEGO Joker"}, "[]"},
+	}
+
+	for _, table := range exclusionTables {
+		q.Names = table.names
+		matches, err := s.GetWatchersMatchingQuery(q)
+		check(t, err)
+
+		if got := formatMatches(matches); got != table.expected {
+			t.Errorf("%v: expected matches %s, got %s", table.names, table.expected, got)
+		}
+	}
+
+	rowsAffected, err = s.InsertWatcher(11, "-lego")
+	check(t, err)
+	if rowsAffected != 0 {
+		t.Errorf("Expected a watcher having only exclusions not to be inserted")
+	}
+
+	// the pattern watchers match either of the films' names against their regular expression, ignoring the case
+	for _, keywords := range []string{"re: ^Star Wars", "re: (Ghibli|Miyazaki)", "re: ^up$"} {
+		rowsAffected, err = s.InsertWatcher(12, keywords)
+		check(t, err)
+		if rowsAffected != 1 {
+			t.Errorf("Expected the pattern watcher %q to be inserted", keywords)
+		}
+	}
+
+	patternTables := []struct {
+		names    []string
+		expected string
+	}{
+		{[]string{"star wars: The Last Jedi", "Războiul stelelor: Ultimul Jedi"}, "[{12 ^Star Wars}]"},
+		{[]string{"The Star Wars Holiday Special"}, "[]"},
+		{[]string{"The Boy and the Heron", "Băiatul și bâtlanul (Studio Ghibli)"}, "[{12 (Ghibli|Miyazaki)}]"},
+		{[]string{"Up", "Sus"}, "[{12 ^up$}]"},
+	}
+
+	for _, table := range patternTables {
+		q.Names = table.names
+		matches, err := s.GetWatchersMatchingQuery(q)
+		check(t, err)
+
+		if got := formatMatches(matches); got != table.expected {
+			t.Errorf("%v: expected matches %s, got %s", table.names, table.expected, got)
+		}
+	}
+
+	count, err := s.CountPatternWatchers(12)
+	check(t, err)
+	if count != 3 {
+		t.Errorf("Expected 3 pattern watchers, got %d", count)
+	}
+
+	rowsAffected, err = s.InsertWatcher(12, "re: Dune")
+	check(t, err)
+	if rowsAffected != 0 {
+		t.Errorf("Expected no more than %d pattern watchers per chat", MaxPatternWatchers)
+	}
+
+	// a name only looking like a pattern is a term watcher, which doesn't count towards the pattern watchers
+	rowsAffected, err = s.InsertWatcher(12, "Re:Zero")
+	check(t, err)
+	if rowsAffected != 1 {
+		t.Errorf("Expected the term watcher %q to be inserted", "Re:Zero")
+	}
+
+	rowsAffected, err = s.InsertWatcher(13, "re: (Star Wars")
+	check(t, err)
+	if rowsAffected != 0 {
+		t.Errorf("Expected a watcher having an invalid pattern not to be inserted")
+	}
+
+	_, err = s.RemoveWatcher(2, "Fight Club, Clubul de lupte")
+	check(t, err)
+	q.Names = []string{"Clubul de lupte"}
+	matches, err := s.GetWatchersMatchingQuery(q)
+	check(t, err)
+	if len(matches) != 0 {
+		t.Errorf("Expected the removed watcher's terms not to match, got %+v", matches)
+	}
+}
+
+// formatMatches returns the chats and terms of the matches, ordered by chat.
+func formatMatches(matches []WatcherMatch) string {
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].ChatId < matches[j].ChatId
+	})
+
+	var data []string
+	for _, m := range matches {
+		data = append(data, fmt.Sprintf("{%d %s}", m.ChatId, m.Term))
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(data, " "))
+}
+
+func testStoreNotifications(t *testing.T, s Store) {
+	about := NotifiedFilm{Provider: "cc", FilmId: "1", CinemaId: "10", FilmName: "Fight Club", FilmLink: "l", Reason: ReasonOnSale}
+	match := WatcherMatch{ChatId: 1, WatcherId: 5, Keywords: "Fight Clb, Clubul de lupte", Strictness: StrictnessFuzzy, Term: "Fight Clb", Score: 0.9}
+
+	for i, expected := range []int64{1, 0} {
+		rowsAffected, err := s.InsertNotification(1, fmt.Sprintf(`{"n":%d}`, i), about, match)
+		check(t, err)
+		if rowsAffected != expected {
+			t.Errorf("Expected %d rows affected, got %d", expected, rowsAffected)
+		}
+	}
+
+	announcement := about
+	announcement.Reason = ReasonAnnouncement
+	_, err := s.InsertNotification(1, `{"n":2}`, announcement, match)
+	check(t, err)
+
+	claimed, err := s.ClaimNotifications(10)
+	check(t, err)
+	if len(claimed) != 2 || claimed[0].Payload != `{"n":0}` || claimed[1].Payload != `{"n":2}` || claimed[0].ChatId != 1 {
+		t.Fatalf("Expected both notifications to be claimed in order, got %+v", claimed)
+	}
+
+	again, err := s.ClaimNotifications(10)
+	check(t, err)
+	if len(again) != 0 {
+		t.Errorf("Expected no notifications left to claim, got %+v", again)
+	}
+
+	_, err = s.MarkNotificationSent(claimed[0].Id)
+	check(t, err)
+	_, err = s.MarkNotificationFailed(claimed[1].Id, "timeout", time.Now().Add(-time.Second))
+	check(t, err)
+
+	retried, err := s.ClaimNotifications(10)
+	check(t, err)
+	if len(retried) != 1 || retried[0].Id != claimed[1].Id || retried[0].Attempts != 1 {
+		t.Fatalf("Expected the failed notification to be retried, got %+v", retried)
+	}
+
+	released, err := s.ReleaseClaimedNotifications()
+	check(t, err)
+	if released != 1 {
+		t.Errorf("Expected the claimed notification to be released, got %d", released)
+	}
+
+	_, err = s.MarkNotificationFailed(claimed[1].Id, "bad request", time.Time{})
+	check(t, err)
+	given, err := s.ClaimNotifications(10)
+	check(t, err)
+	if len(given) != 0 {
+		t.Errorf("Expected the given up notification not to be claimed, got %+v", given)
+	}
+
+	history, err := s.GetNotificationHistory(1, 10)
+	check(t, err)
+	if len(history) != 1 || history[0].NotifiedFilm != about || history[0].Match != match || history[0].SentAt.IsZero() {
+		t.Errorf("Expected the sent notification, got %+v", history)
+	}
+
+	// the same film, once on sale at another cinema, and its screenings added in batches
+	elsewhere := about
+	elsewhere.CinemaId = "11"
+	first := NotifiedFilm{Provider: "cc", FilmId: "1", CinemaId: "10", Reason: ReasonNewScreenings([]Event{{Id: "a"}, {Id: "b"}})}
+	same := first
+	same.Reason = ReasonNewScreenings([]Event{{Id: "b"}, {Id: "a"}})
+	later := first
+	later.Reason = ReasonNewScreenings([]Event{{Id: "c"}})
+
+	others := []struct {
+		about    NotifiedFilm
+		expected int64
+	}{
+		{elsewhere, 1},
+		{first, 1},
+		{same, 0},
+		{later, 1},
+	}
+
+	for _, other := range others {
+		rowsAffected, err := s.InsertNotification(2, `{}`, other.about, match)
+		check(t, err)
+		if rowsAffected != other.expected {
+			t.Errorf("Expected %d rows affected for %+v, got %d", other.expected, other.about, rowsAffected)
+		}
+	}
+
+	// a restart puts back the claimed notifications, but not the one being sent
+	claimed, err = s.ClaimNotifications(10)
+	check(t, err)
+	if len(claimed) != 3 {
+		t.Fatalf("Expected 3 notifications to be claimed, got %+v", claimed)
+	}
+	_, err = s.MarkNotificationSending(claimed[0].Id)
+	check(t, err)
+
+	released, err = s.ReleaseClaimedNotifications()
+	check(t, err)
+	if released != 2 {
+		t.Errorf("Expected 2 notifications to be released, got %d", released)
+	}
+
+	resumed, err := s.ClaimNotifications(10)
+	check(t, err)
+	if len(resumed) != 2 || resumed[0].Id != claimed[1].Id || resumed[1].Id != claimed[2].Id {
+		t.Errorf("Expected the notifications not being sent to be resumed, got %+v", resumed)
+	}
+}
+
+func testStoreUpdatesOffset(t *testing.T, s Store) {
+	offset, err := s.GetUpdatesOffset()
+	check(t, err)
+	if offset != 0 {
+		t.Errorf("Expected no offset, got %d", offset)
+	}
+
+	for _, expected := range []int{42, 43} {
+		_, err = s.SetUpdatesOffset(expected)
+		check(t, err)
+		offset, err = s.GetUpdatesOffset()
+		check(t, err)
+		if offset != expected {
+			t.Errorf("Expected offset %d, got %d", expected, offset)
+		}
+	}
+}
+
+func testStoreProcessedUpdates(t *testing.T, s Store) {
+	processed, err := s.IsUpdateProcessed(42)
+	check(t, err)
+	if processed {
+		t.Errorf("Expected the update not to be processed")
+	}
+
+	for _, expected := range []int64{1, 0} {
+		rowsAffected, err := s.SetUpdateProcessed(42)
+		check(t, err)
+		if rowsAffected != expected {
+			t.Errorf("Expected %d updates marked as processed, got %d", expected, rowsAffected)
+		}
+	}
+
+	for _, table := range []struct {
+		updateId int
+		expected bool
+	}{
+		{42, true},
+		{43, false},
+	} {
+		processed, err = s.IsUpdateProcessed(table.updateId)
+		check(t, err)
+		if processed != table.expected {
+			t.Errorf("Expected update %d processed to be %v, got %v", table.updateId, table.expected, processed)
+		}
+	}
+}
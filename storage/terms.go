@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// watcherTerm is one of the terms of a watcher's keywords.
+type watcherTerm struct {
+	term       string
+	normalised string
+}
+
+// splitTerms returns the distinct terms of the keywords; the terms having nothing left once normalised are skipped.
+func splitTerms(keywords string) []watcherTerm {
+	parsed, _ := parseKeywords(keywords)
+
+	var terms []watcherTerm
+
+	seen := make(map[string]bool)
+
+	for _, term := range parsed {
+		normalised := NormaliseString(term)
+
+		if len(normalised) == 0 || seen[normalised] {
+			continue
+		}
+		seen[normalised] = true
+
+		terms = append(terms, watcherTerm{term: term, normalised: normalised})
+	}
+
+	return terms
+}
+
+// insertTerms stores the terms of the watcher having the given id.
+func insertTerms(tx *sql.Tx, watcherId int64, terms []watcherTerm) error {
+	for _, t := range terms {
+		_, err := tx.Exec("INSERT INTO watcher_terms (watcher_id, term, term_normalised) VALUES ($1, $2, $3)", watcherId, t.term, t.normalised)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitWatchersTerms is the data migration storing the terms of the watchers, whenever their parsing
+// or their normalisation changes; the pattern watchers have no terms.
+func splitWatchersTerms(tx *sql.Tx) error {
+	return splitTermsOfWatchers(tx, "SELECT id, keywords FROM watchers WHERE pattern = ''")
+}
+
+// splitLegacyWatchersTerms is splitWatchersTerms for the migrations preceding the pattern watchers,
+// which are applied before the `pattern` column exists.
+func splitLegacyWatchersTerms(tx *sql.Tx) error {
+	return splitTermsOfWatchers(tx, "SELECT id, keywords FROM watchers")
+}
+
+// splitTermsOfWatchers stores the terms of the watchers selected by the query, as their ids and keywords.
+func splitTermsOfWatchers(tx *sql.Tx, query string) error {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return err
+	}
+
+	keywords := make(map[int64]string)
+
+	for rows.Next() {
+		var id int64
+		var k string
+		err = rows.Scan(&id, &k)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		keywords[id] = k
+	}
+	rows.Close()
+
+	for id, k := range keywords {
+		err = insertTerms(tx, id, splitTerms(k))
+		if err != nil {
+			return fmt.Errorf("splitting the terms of watcher %d: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+// Strictness tells how closely the terms of a watcher have to match the films' names.
+type Strictness int8
+
+const (
+	// StrictnessPhrase matches the films having one of the terms, as a whole, in their names; it is the default.
+	StrictnessPhrase Strictness = iota
+	// StrictnessExact matches the films named exactly like one of the terms.
+	StrictnessExact
+	// StrictnessFuzzy is like StrictnessPhrase, but it allows for typos.
+	StrictnessFuzzy
+)
+
+// WatcherMatch is a chat's watcher matching a film, along with the term that matched.
+type WatcherMatch struct {
+	ChatId     int
+	WatcherId  int64
+	Keywords   string
+	Strictness Strictness
+	// Term is the matching term, as entered by the chat.
+	Term string
+	// Score tells how well the term matched, from 0 to 1; anything but the fuzzy matches scores 1.
+	Score float64
+}
+
+// matchCandidate is a watcher term found by a store's prefilter, which may or may not match the film.
+type matchCandidate struct {
+	WatcherMatch
+	termNormalised string
+	filters        WatcherFilters
+	// pattern is the compiled regular expression of a pattern watcher, whose term is the pattern.
+	pattern *regexp.Regexp
+}
+
+// selectMatches returns the candidates whose terms match one of the film's names, as required by their watcher's strictness,
+// whose exclusions match none of them and whose filters match its screenings; the pattern watchers' candidates
+// match if their pattern does. Each chat is returned once, along with its best scoring term, the longest one
+// if several score the same, which is the most telling reason for notifying it.
+func selectMatches(candidates []matchCandidate, q MatchQuery) []WatcherMatch {
+	var names []string
+	for _, name := range q.Names {
+		names = append(names, NormaliseString(name))
+	}
+
+	var matching []matchCandidate
+
+	excluded := make(map[int64]bool)
+
+	for _, c := range candidates {
+		if q.FilteredOnly && !c.filters.FiltersScreenings() {
+			continue
+		}
+
+		if c.pattern != nil {
+			// the patterns are written against the names as given, while they have no exclusions
+			if matchesPattern(c.pattern, q.Names) {
+				c.Score = 1
+				matching = append(matching, c)
+			}
+			continue
+		}
+
+		c.Score = termScore(names, c.termNormalised, c.Strictness)
+		if c.Score < 1 && (c.Strictness != StrictnessFuzzy || c.Score < fuzzyThreshold) {
+			continue
+		}
+
+		isExcluded, ok := excluded[c.WatcherId]
+		if !ok {
+			isExcluded = containsAnyPhrase(names, keywordsExclusions(c.Keywords))
+			excluded[c.WatcherId] = isExcluded
+		}
+
+		if !isExcluded {
+			matching = append(matching, c)
+		}
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		if matching[i].Score != matching[j].Score {
+			return matching[i].Score > matching[j].Score
+		}
+
+		if len(matching[i].termNormalised) != len(matching[j].termNormalised) {
+			return len(matching[i].termNormalised) > len(matching[j].termNormalised)
+		}
+
+		return matching[i].WatcherId < matching[j].WatcherId
+	})
+
+	var data []WatcherMatch
+
+	seen := make(map[int]bool)
+
+	for _, c := range matching {
+		if seen[c.ChatId] || !c.filters.Match(q.AgeRating, q.Events) {
+			continue
+		}
+		seen[c.ChatId] = true
+
+		data = append(data, c.WatcherMatch)
+	}
+
+	return data
+}
+
+// containsPhrase reports whether any of the normalised names contains the phrase as a whole.
+func containsPhrase(names []string, phrase string) bool {
+	for _, name := range names {
+		if strings.Contains(" "+name+" ", " "+phrase+" ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsAnyPhrase reports whether any of the normalised names contains any of the phrases as a whole.
+func containsAnyPhrase(names []string, phrases []string) bool {
+	for _, phrase := range phrases {
+		if containsPhrase(names, phrase) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trigramLength is the length of the substrings the stores' prefilters look up the terms by; the terms shorter than that,
+// e.g. `up` or `f1`, have none, so they are candidates for any film.
+const trigramLength = 3
+
+// matchingTrigrams returns the trigrams of the words of a normalised film name, which the watchers' terms are searched for,
+// before being scored; even a misspelled term is likely to have some of them.
+func matchingTrigrams(query string) []string {
+	var trigrams []string
+
+	seen := make(map[string]bool)
+
+	for _, word := range strings.Fields(query) {
+		runes := []rune(word)
+		for i := 0; i+trigramLength <= len(runes); i++ {
+			trigram := string(runes[i : i+trigramLength])
+			if !seen[trigram] {
+				seen[trigram] = true
+				trigrams = append(trigrams, trigram)
+			}
+		}
+	}
+
+	return trigrams
+}
+
+// isCandidateTerm reports whether the normalised term passes the stores' prefilter, either having any of the trigrams
+// or being too short for having one.
+func isCandidateTerm(term string, trigrams []string) bool {
+	if utf8.RuneCountInString(term) < trigramLength {
+		return true
+	}
+
+	for _, trigram := range trigrams {
+		if strings.Contains(term, trigram) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanMatchCandidates reads the candidates selected by a store's prefilter, as
+// `watcher id, chat id, keywords, strictness, term, normalised term` followed by the watcher's filters.
+func scanMatchCandidates(rows *sql.Rows) ([]matchCandidate, error) {
+	defer rows.Close()
+
+	var data []matchCandidate
+
+	for rows.Next() {
+		var c matchCandidate
+		err := rows.Scan(&c.WatcherId, &c.ChatId, &c.Keywords, &c.Strictness, &c.Term, &c.termNormalised,
+			&c.filters.Format, &c.filters.Audio, &c.filters.Subtitles, &c.filters.AgeRating)
+		if err != nil {
+			return nil, fmt.Errorf("reading watchers: %v", err)
+		}
+
+		data = append(data, c)
+	}
+
+	return data, nil
+}
+
+// SetWatcherStrictness sets how closely the terms of the chat's watcher have to match the films' names.
+func (s *SQLiteStore) SetWatcherStrictness(chatId int, keywords string, strictness Strictness) (int64, error) {
+	result, err := s.db.Exec("UPDATE watchers SET strictness = ? WHERE chat_id=? AND keywords=? COLLATE NOCASE", strictness, chatId, keywords)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	return rowsAffected, nil
+}
@@ -0,0 +1,158 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// maxRetries is how many times a call failing because of a transient error is repeated
+	maxRetries = 3
+	// retryBaseDelay is the delay before repeating a call failing because of a network or server error;
+	// it doubles with each retry
+	retryBaseDelay = time.Second
+	// requestTimeout must be longer than the timeout of the requests pulling updates
+	requestTimeout = 90 * time.Second
+)
+
+// Client calls the methods of the Telegram Bot API.
+type Client struct {
+	apiUrl     string
+	httpClient *http.Client
+	// sleep waits between retries, unless the context is done meanwhile
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func NewClient(botConfig BotConfig) *Client {
+	return &Client{
+		apiUrl:     botConfig.ApiUrl,
+		httpClient: &http.Client{Timeout: requestTimeout},
+		sleep:      sleepContext,
+	}
+}
+
+// sleepContext waits for the given duration, or until the context is done, returning the context's error then.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Error is an unsuccessful response of the Bot API.
+type Error struct {
+	Code        int
+	Description string
+	// RetryAfter is how many seconds to wait before repeating a call that exceeded the rate limits.
+	RetryAfter int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("telegram: %d %s", e.Code, e.Description)
+}
+
+// IsForbidden reports whether the error means that the bot can't message the chat anymore,
+// e.g. because the user blocked the bot.
+func IsForbidden(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == http.StatusForbidden
+}
+
+type response struct {
+	Ok          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// Call calls the API method described by `method`, one of the `Method...` types, and decodes its result into `result`, unless it's nil.
+// Calls exceeding the rate limits are repeated after the delay asked for by Telegram,
+// while calls failing because of network or server errors are repeated after an increasing delay.
+func (c *Client) Call(method interface{}, result interface{}) error {
+	return c.CallContext(context.Background(), method, result)
+}
+
+// CallContext is like Call, but the call is abandoned, without being repeated, once the context is done,
+// even while waiting to repeat it.
+func (c *Client) CallContext(ctx context.Context, method interface{}, result interface{}) error {
+	body, err := json.Marshal(method)
+	if err != nil {
+		return err
+	}
+
+	delay := retryBaseDelay
+
+	for attempt := 0; ; attempt++ {
+		err = c.call(ctx, body, result)
+		if err == nil || attempt == maxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		var apiErr *Error
+		var urlErr *url.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusTooManyRequests && apiErr.RetryAfter > 0 {
+			err = c.sleep(ctx, time.Duration(apiErr.RetryAfter)*time.Second)
+		} else if (apiErr != nil && (apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= 500)) || errors.As(err, &urlErr) {
+			err = c.sleep(ctx, delay)
+			delay *= 2
+		} else {
+			return err
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) call(ctx context.Context, body []byte, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var r response
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		if resp.StatusCode >= 500 {
+			// e.g. an error page served by a proxy
+			return &Error{Code: resp.StatusCode, Description: resp.Status}
+		}
+
+		return fmt.Errorf("telegram: reading response: %v", err)
+	}
+
+	if !r.Ok {
+		return &Error{Code: r.ErrorCode, Description: r.Description, RetryAfter: r.Parameters.RetryAfter}
+	}
+
+	if result != nil {
+		err = json.Unmarshal(r.Result, result)
+		if err != nil {
+			return fmt.Errorf("telegram: reading result: %v", err)
+		}
+	}
+
+	return nil
+}
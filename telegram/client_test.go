@@ -0,0 +1,119 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client calling a server that gives the provided responses in order, repeating the last one;
+// it also returns the number of requests received and the delays waited between them.
+func newTestClient(t *testing.T, statuses []int, bodies []string) (*Client, *int, *[]time.Duration) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := requests
+		if i >= len(statuses) {
+			i = len(statuses) - 1
+		}
+		requests++
+
+		w.WriteHeader(statuses[i])
+		fmt.Fprint(w, bodies[i])
+	}))
+	t.Cleanup(server.Close)
+
+	var delays []time.Duration
+	client := NewClient(BotConfig{ApiUrl: server.URL + "/"})
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	return client, &requests, &delays
+}
+
+func TestClientCall(t *testing.T) {
+	client, requests, delays := newTestClient(t, []int{200}, []string{`{"ok":true,"result":{"url":"https://example.com"}}`})
+
+	var info struct {
+		Url string `json:"url"`
+	}
+	err := client.Call(MethodGetWebhookInfo{Method: "getWebhookInfo"}, &info)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if info.Url != "https://example.com" || *requests != 1 || len(*delays) != 0 {
+		t.Errorf("Expected a single request returning the url, got %q after %d requests", info.Url, *requests)
+	}
+}
+
+func TestClientCallRetriesAfterTooManyRequests(t *testing.T) {
+	client, requests, delays := newTestClient(t,
+		[]int{429, 200},
+		[]string{`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 7","parameters":{"retry_after":7}}`, `{"ok":true,"result":true}`})
+
+	err := client.Call(NewCallbackAnswer("1", ""), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if *requests != 2 || len(*delays) != 1 || (*delays)[0] != 7*time.Second {
+		t.Errorf("Expected a retry after 7s, got %d requests and delays %v", *requests, *delays)
+	}
+}
+
+func TestClientCallCancelledWhileWaiting(t *testing.T) {
+	client, requests, _ := newTestClient(t,
+		[]int{429},
+		[]string{`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 30","parameters":{"retry_after":30}}`})
+	client.sleep = sleepContext
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := client.CallContext(ctx, NewCallbackAnswer("1", ""), nil)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the call to be cancelled, got %v", err)
+	}
+
+	if elapsed := time.Since(start); *requests != 1 || elapsed > time.Second {
+		t.Errorf("Expected the wait to end once cancelled, got %d requests in %v", *requests, elapsed)
+	}
+}
+
+func TestClientCallRetriesServerErrors(t *testing.T) {
+	client, requests, delays := newTestClient(t, []int{502}, []string{"<html>Bad Gateway</html>"})
+
+	err := client.Call(NewCallbackAnswer("1", ""), nil)
+
+	apiErr, ok := err.(*Error)
+	if !ok || apiErr.Code != 502 {
+		t.Fatalf("Expected a 502 error, got %v", err)
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	if *requests != maxRetries+1 || fmt.Sprint(*delays) != fmt.Sprint(expected) {
+		t.Errorf("Expected %d requests with delays %v, got %d requests with delays %v", maxRetries+1, expected, *requests, *delays)
+	}
+}
+
+func TestClientCallForbidden(t *testing.T) {
+	client, requests, _ := newTestClient(t, []int{403}, []string{`{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`})
+
+	err := client.Call(NewMessage(1, "hello"), nil)
+	if !IsForbidden(err) {
+		t.Errorf("Expected a forbidden error, got %v", err)
+	}
+
+	if *requests != 1 {
+		t.Errorf("Expected no retries, got %d requests", *requests)
+	}
+}
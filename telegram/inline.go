@@ -0,0 +1,184 @@
+package telegram
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Callback actions, sent as part of the callback data of the inline keyboard buttons.
+const (
+	CallbackDeleteWatcher = "del"
+	CallbackMuteFilm      = "mute"
+	CallbackUnmuteFilm    = "unmute"
+	CallbackMoreShowtimes = "more"
+	// the buttons of the announcements refer to the upcoming films instead
+	CallbackMuteUpcomingFilm      = "umute"
+	CallbackUnmuteUpcomingFilm    = "uunmute"
+	CallbackMoreUpcomingShowtimes = "umore"
+)
+
+// filmCallbacks are the callback actions of the buttons attached to the notifications about a film.
+type filmCallbacks struct {
+	mute   string
+	unmute string
+	more   string
+}
+
+var (
+	onSaleFilmCallbacks   = filmCallbacks{CallbackMuteFilm, CallbackUnmuteFilm, CallbackMoreShowtimes}
+	upcomingFilmCallbacks = filmCallbacks{CallbackMuteUpcomingFilm, CallbackUnmuteUpcomingFilm, CallbackMoreUpcomingShowtimes}
+)
+
+// IsUpcomingFilmCallback reports whether the callback action refers to an upcoming film, rather than to a film on sale.
+func IsUpcomingFilmCallback(action string) bool {
+	return action == CallbackMuteUpcomingFilm || action == CallbackUnmuteUpcomingFilm || action == CallbackMoreUpcomingShowtimes
+}
+
+const (
+	bookLabel          = "🎟 Book"
+	muteFilmLabel      = "🔇 Mute this film"
+	unmuteFilmLabel    = "🔔 Unmute this film"
+	moreShowtimesLabel = "🕒 More showtimes"
+)
+
+// MakeCallbackData builds the data sent back by a button when it is pressed, e.g. "del:42".
+func MakeCallbackData(action string, id int64) string {
+	return fmt.Sprintf("%s:%d", action, id)
+}
+
+// ParseCallbackData splits the data built by `MakeCallbackData` into its action and id.
+func ParseCallbackData(data string) (string, int64, bool) {
+	action, value, found := strings.Cut(data, ":")
+	if !found {
+		return "", 0, false
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return action, id, true
+}
+
+// NewNotificationKeyboard returns the buttons attached to the notifications about a film.
+func NewNotificationKeyboard(filmRowId int64, bookingLink string) InlineKeyboardMarkup {
+	return newFilmKeyboard(onSaleFilmCallbacks, filmRowId, bookingLink)
+}
+
+// NewAnnouncementKeyboard returns the buttons attached to the announcements of a film, given the row id of the upcoming film.
+func NewAnnouncementKeyboard(upcomingFilmRowId int64, filmLink string) InlineKeyboardMarkup {
+	return newFilmKeyboard(upcomingFilmCallbacks, upcomingFilmRowId, filmLink)
+}
+
+func newFilmKeyboard(callbacks filmCallbacks, rowId int64, bookingLink string) InlineKeyboardMarkup {
+	var firstRow []InlineKeyboardButton
+	if len(bookingLink) > 0 {
+		firstRow = append(firstRow, InlineKeyboardButton{Text: bookLabel, Url: bookingLink})
+	}
+	firstRow = append(firstRow, makeMuteButton(callbacks, rowId, false))
+
+	return InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{
+			firstRow,
+			{{Text: moreShowtimesLabel, CallbackData: MakeCallbackData(callbacks.more, rowId)}},
+		},
+	}
+}
+
+func makeMuteButton(callbacks filmCallbacks, rowId int64, muted bool) InlineKeyboardButton {
+	if muted {
+		return InlineKeyboardButton{Text: unmuteFilmLabel, CallbackData: MakeCallbackData(callbacks.unmute, rowId)}
+	}
+
+	return InlineKeyboardButton{Text: muteFilmLabel, CallbackData: MakeCallbackData(callbacks.mute, rowId)}
+}
+
+// bookingLink returns the booking link of the first screening, falling back to the film's page.
+func bookingLink(filmLink string, screenings []Screening) string {
+	if len(screenings) > 0 && len(screenings[0].BookingLink) > 0 {
+		return screenings[0].BookingLink
+	}
+
+	return filmLink
+}
+
+// MakeResponseForFilmMuteToggled flips the mute button of a notification, leaving the other buttons as they were.
+func MakeResponseForFilmMuteToggled(chatId int, messageId int, keyboard InlineKeyboardMarkup, filmRowId int64, muted bool) MethodEditMessageReplyMarkup {
+	rows := make([][]InlineKeyboardButton, len(keyboard.InlineKeyboard))
+	for i, row := range keyboard.InlineKeyboard {
+		for _, button := range row {
+			switch action, _, _ := ParseCallbackData(button.CallbackData); action {
+			case CallbackMuteFilm, CallbackUnmuteFilm:
+				button = makeMuteButton(onSaleFilmCallbacks, filmRowId, muted)
+			case CallbackMuteUpcomingFilm, CallbackUnmuteUpcomingFilm:
+				button = makeMuteButton(upcomingFilmCallbacks, filmRowId, muted)
+			}
+
+			rows[i] = append(rows[i], button)
+		}
+	}
+
+	return MethodEditMessageReplyMarkup{
+		Method:      "editMessageReplyMarkup",
+		ChatId:      chatId,
+		MessageId:   messageId,
+		ReplyMarkup: InlineKeyboardMarkup{InlineKeyboard: rows},
+	}
+}
+
+// MakeResponseForMoreShowtimes replaces the text of a notification with the film's upcoming screenings
+// and drops the button that requested them. Photo notifications get their caption replaced instead.
+func MakeResponseForMoreShowtimes(chatId int, messageId int, isPhoto bool, keyboard InlineKeyboardMarkup, filmName string, filmLink string, cinemaName string, screenings []Screening) interface{} {
+	messageText := fmt.Sprintf("🎬 %s at %s\n\n", link(filmName, filmLink), italic(cinemaName))
+	if len(screenings) > 0 {
+		messageText += "Upcoming screenings:\n" + formatScreenings(screenings)
+	} else {
+		messageText += "There are no upcoming screenings."
+	}
+
+	var rows [][]InlineKeyboardButton
+	for _, row := range keyboard.InlineKeyboard {
+		var r []InlineKeyboardButton
+		for _, button := range row {
+			if action, _, _ := ParseCallbackData(button.CallbackData); action != CallbackMoreShowtimes && action != CallbackMoreUpcomingShowtimes {
+				r = append(r, button)
+			}
+		}
+
+		if len(r) > 0 {
+			rows = append(rows, r)
+		}
+	}
+	markup := &InlineKeyboardMarkup{InlineKeyboard: rows}
+
+	if isPhoto {
+		return MethodEditMessageCaption{
+			Method:      "editMessageCaption",
+			ChatId:      chatId,
+			MessageId:   messageId,
+			Caption:     messageText,
+			ParseMode:   "markdown",
+			ReplyMarkup: markup,
+		}
+	}
+
+	return MethodEditMessageText{
+		Method:      "editMessageText",
+		ChatId:      chatId,
+		MessageId:   messageId,
+		Text:        messageText,
+		ParseMode:   "markdown",
+		ReplyMarkup: markup,
+	}
+}
+
+// NewCallbackAnswer acknowledges a button press, optionally showing a short notice to the user.
+func NewCallbackAnswer(callbackQueryId string, text string) MethodAnswerCallbackQuery {
+	return MethodAnswerCallbackQuery{
+		Method:          "answerCallbackQuery",
+		CallbackQueryId: callbackQueryId,
+		Text:            text,
+	}
+}
@@ -0,0 +1,48 @@
+package telegram
+
+import (
+	"testing"
+)
+
+func TestParseCallbackData(t *testing.T) {
+	tables := []struct {
+		data   string
+		action string
+		id     int64
+		ok     bool
+	}{
+		{MakeCallbackData(CallbackDeleteWatcher, 42), CallbackDeleteWatcher, 42, true},
+		{"more:7", CallbackMoreShowtimes, 7, true},
+		{"more", "", 0, false},
+		{"more:x", "", 0, false},
+		{"", "", 0, false},
+	}
+
+	for _, table := range tables {
+		action, id, ok := ParseCallbackData(table.data)
+
+		if action != table.action || id != table.id || ok != table.ok {
+			t.Errorf("Expected %q, %d, %v for %q, got %q, %d, %v", table.action, table.id, table.ok, table.data, action, id, ok)
+		}
+	}
+}
+
+func TestMakeResponseForFilmMuteToggled(t *testing.T) {
+	keyboard := NewNotificationKeyboard(3, "https://example.com/book")
+
+	muted := MakeResponseForFilmMuteToggled(1, 2, keyboard, 3, true).ReplyMarkup
+	if got := muted.InlineKeyboard[0][1].CallbackData; got != "unmute:3" {
+		t.Errorf("Expected the mute button to be replaced by an unmute one, got %q", got)
+	}
+	if got := muted.InlineKeyboard[0][0].Url; got != "https://example.com/book" {
+		t.Errorf("Expected the booking button to be kept, got %q", got)
+	}
+	if got := len(muted.InlineKeyboard[1]); got != 1 {
+		t.Errorf("Expected the more showtimes button to be kept, got %d buttons", got)
+	}
+
+	unmuted := MakeResponseForFilmMuteToggled(1, 2, muted, 3, false).ReplyMarkup
+	if got := unmuted.InlineKeyboard[0][1].CallbackData; got != "mute:3" {
+		t.Errorf("Expected the unmute button to be replaced by a mute one, got %q", got)
+	}
+}
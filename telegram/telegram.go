@@ -3,9 +3,9 @@ package telegram
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
+	"strings"
 )
 
 type BotConfig struct {
@@ -24,6 +24,26 @@ type MethodSetMyCommands struct {
 	Commands []Command `json:"commands"`
 }
 
+type MethodSetWebhook struct {
+	Method             string `json:"method"`
+	Url                string `json:"url"`
+	DropPendingUpdates bool   `json:"drop_pending_updates"`
+}
+
+type MethodDeleteWebhook struct {
+	Method string `json:"method"`
+}
+
+type MethodGetUpdates struct {
+	Method  string `json:"method"`
+	Offset  int    `json:"offset"`
+	Timeout int    `json:"timeout"`
+}
+
+type MethodGetWebhookInfo struct {
+	Method string `json:"method"`
+}
+
 type ReplyMarkupWithKeyboard struct {
 	Keyboard        [][]string `json:"keyboard"`
 	OneTimeKeyboard bool       `json:"one_time_keyboard"`
@@ -34,12 +54,62 @@ type ReplyMarkupWithoutKeyboard struct {
 	RemoveKeyboard bool `json:"remove_keyboard"`
 }
 
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	Url          string `json:"url,omitempty"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
 type MethodSendPhoto struct {
-	Method    string `json:"method"`
-	ChatId    int    `json:"chat_id"`
-	Photo     string `json:"photo"`
-	Caption   string `json:"caption"`
-	ParseMode string `json:"parse_mode"`
+	Method      string                `json:"method"`
+	ChatId      int                   `json:"chat_id"`
+	Photo       string                `json:"photo"`
+	Caption     string                `json:"caption"`
+	ParseMode   string                `json:"parse_mode"`
+	ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type MethodSendMessageWithInlineKeyboard struct {
+	Method      string               `json:"method"`
+	ChatId      int                  `json:"chat_id"`
+	Text        string               `json:"text"`
+	ParseMode   string               `json:"parse_mode"`
+	ReplyMarkup InlineKeyboardMarkup `json:"reply_markup"`
+}
+
+type MethodEditMessageText struct {
+	Method      string                `json:"method"`
+	ChatId      int                   `json:"chat_id"`
+	MessageId   int                   `json:"message_id"`
+	Text        string                `json:"text"`
+	ParseMode   string                `json:"parse_mode"`
+	ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type MethodEditMessageCaption struct {
+	Method      string                `json:"method"`
+	ChatId      int                   `json:"chat_id"`
+	MessageId   int                   `json:"message_id"`
+	Caption     string                `json:"caption"`
+	ParseMode   string                `json:"parse_mode"`
+	ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type MethodEditMessageReplyMarkup struct {
+	Method      string               `json:"method"`
+	ChatId      int                  `json:"chat_id"`
+	MessageId   int                  `json:"message_id"`
+	ReplyMarkup InlineKeyboardMarkup `json:"reply_markup"`
+}
+
+type MethodAnswerCallbackQuery struct {
+	Method          string `json:"method"`
+	CallbackQueryId string `json:"callback_query_id"`
+	Text            string `json:"text,omitempty"`
 }
 
 type MethodSendMessageWithKeyboard struct {
@@ -77,16 +147,24 @@ type WebhookUpdateMessage struct {
 	Chat      WebhookUpdateMessageChat `json:"chat"`
 	Date      int                      `json:"date"`
 	Text      string                   `json:"text"`
+	Caption   string                   `json:"caption"`
+	// ReplyMarkup is the inline keyboard attached to the message, if any.
+	ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup"`
 }
 
-type WebhookUpdate struct {
-	UpdateId int                  `json:"update_id"`
-	Message  WebhookUpdateMessage `json:"message"`
+type CallbackQuery struct {
+	Id      string                   `json:"id"`
+	From    WebhookUpdateMessageFrom `json:"from"`
+	Message *WebhookUpdateMessage    `json:"message"`
+	Data    string                   `json:"data"`
 }
 
-type WebhookUpdateEdited struct {
-	UpdateId int                  `json:"update_id"`
-	Message  WebhookUpdateMessage `json:"edited_message"`
+// WebhookUpdate is an update received from Telegram; only one of its optional fields is set.
+type WebhookUpdate struct {
+	UpdateId      int                   `json:"update_id"`
+	Message       *WebhookUpdateMessage `json:"message"`
+	EditedMessage *WebhookUpdateMessage `json:"edited_message"`
+	CallbackQuery *CallbackQuery        `json:"callback_query"`
 }
 
 func NewBotConfig(token string, webhookUrl string) BotConfig {
@@ -123,17 +201,40 @@ func NewMessageWithKeyboard(chatId int, text string, keyboard [][]string) Method
 	}
 }
 
-func SetWebhook(botConfig BotConfig) error {
-	_, err := http.Get(botConfig.ApiUrl + "SetWebhook?drop_pending_updates=true&url=" + botConfig.WebhookUrl)
+// SetWebhook has Telegram push the updates to the webhook URL, dropping the ones not delivered yet.
+func (c *Client) SetWebhook(webhookUrl string) error {
+	return c.Call(MethodSetWebhook{
+		Method:             "setWebhook",
+		Url:                webhookUrl,
+		DropPendingUpdates: true,
+	}, nil)
+}
+
+// DeleteWebhook stops Telegram from pushing updates, which is needed before pulling them with `GetUpdates`.
+func (c *Client) DeleteWebhook() error {
+	return c.Call(MethodDeleteWebhook{Method: "deleteWebhook"}, nil)
+}
+
+// GetUpdates pulls the updates having an id of at least `offset`, waiting up to `timeout` seconds for one to arrive.
+// Requesting an offset acknowledges the updates preceding it, so they aren't returned again.
+func (c *Client) GetUpdates(ctx context.Context, offset int, timeout int) ([]WebhookUpdate, error) {
+	var updates []WebhookUpdate
+
+	err := c.CallContext(ctx, MethodGetUpdates{
+		Method:  "getUpdates",
+		Offset:  offset,
+		Timeout: timeout,
+	}, &updates)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("fetching updates: %w", err)
 	}
 
-	return nil
+	return updates, nil
 }
 
-func SetCommands(botConfig BotConfig) error {
-	c := MethodSetMyCommands{
+// SetCommands sets the list of commands suggested to the users.
+func (c *Client) SetCommands() error {
+	m := MethodSetMyCommands{
 		Method: "setMyCommands",
 		Commands: []Command{
 			{
@@ -156,21 +257,34 @@ func SetCommands(botConfig BotConfig) error {
 				Command:     "list",
 				Description: "List the active watchers",
 			},
+			{
+				Command:     "updates",
+				Description: "Get notified about new showtimes",
+			},
+			{
+				Command:     "matching",
+				Description: "Choose how closely films must match a watcher",
+			},
+			{
+				Command:     "alerts",
+				Description: "Choose when to be notified",
+			},
+			{
+				Command:     "country",
+				Description: "Choose your country",
+			},
+			{
+				Command:     "cinemas",
+				Description: "Choose the cinemas you care about",
+			},
+			{
+				Command:     "history",
+				Description: "List the films you were notified about",
+			},
 		},
 	}
 
-	jsonData, err := json.Marshal(c)
-	if err != nil {
-		return err
-	}
-
-	_, err = http.Post(botConfig.ApiUrl, "application/json", bytes.NewBuffer(jsonData))
-
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return c.Call(m, nil)
 }
 
 func MakeResponseForStartCommand(chatId int) MethodSendMessageWithoutKeyboard {
@@ -181,24 +295,141 @@ func MakeResponseForStopCommand(chatId int) MethodSendMessageWithoutKeyboard {
 	return NewMessage(chatId, "You are now unsubscribed.")
 }
 
-func MakeResponseForListCommand(watchers *[]string, chatId int) MethodSendMessageWithoutKeyboard {
+// ListedWatcher is a watcher as shown by the `/list` command.
+type ListedWatcher struct {
+	Id       int64
+	Keywords string
+	// Filters is the description of the watcher's filters, if any.
+	Filters string
+}
+
+// MakeResponseForListCommand lists the watchers, each followed by the description of its filters, if any,
+// and attaches a delete button for each of them.
+func MakeResponseForListCommand(watchers []ListedWatcher, chatId int) MethodSendMessageWithInlineKeyboard {
+	return MethodSendMessageWithInlineKeyboard{
+		Method:      "sendMessage",
+		ChatId:      chatId,
+		Text:        makeWatcherListText(watchers),
+		ParseMode:   "markdown",
+		ReplyMarkup: makeWatcherListKeyboard(watchers),
+	}
+}
+
+// MakeResponseForWatcherDeleted updates the `/list` message after one of the watchers was deleted from it.
+func MakeResponseForWatcherDeleted(watchers []ListedWatcher, chatId int, messageId int) MethodEditMessageText {
+	keyboard := makeWatcherListKeyboard(watchers)
+
+	return MethodEditMessageText{
+		Method:      "editMessageText",
+		ChatId:      chatId,
+		MessageId:   messageId,
+		Text:        makeWatcherListText(watchers),
+		ParseMode:   "markdown",
+		ReplyMarkup: &keyboard,
+	}
+}
+
+func makeWatcherListText(watchers []ListedWatcher) string {
 	var buf bytes.Buffer
 
-	for _, watcher := range *watchers {
-		buf.WriteString(fmt.Sprintf("✔︎ _%s_\n", watcher))
+	for _, watcher := range watchers {
+		if len(watcher.Filters) > 0 {
+			buf.WriteString(fmt.Sprintf("✔︎ %s (%s)\n", italic(watcher.Keywords), EscapeMarkdown(watcher.Filters)))
+		} else {
+			buf.WriteString(fmt.Sprintf("✔︎ %s\n", italic(watcher.Keywords)))
+		}
+	}
+
+	if buf.Len() == 0 {
+		return "You have no watchers. Use `/add` to add one now."
 	}
 
-	responseText := "You have no watchers. Use `/add` to add one now."
+	return fmt.Sprintf("These are your watchers:\n\n%s\nTap a watcher below to delete it, or use `/add` to add another one.", buf.String())
+}
 
-	if len(buf.String()) > 0 {
-		responseText = fmt.Sprintf("These are your watchers:\n\n%s\nUse `/add` and `/remove` commands to manage them.", buf.String())
+func makeWatcherListKeyboard(watchers []ListedWatcher) InlineKeyboardMarkup {
+	keyboard := [][]InlineKeyboardButton{}
+
+	for _, watcher := range watchers {
+		keyboard = append(keyboard, []InlineKeyboardButton{{
+			Text:         "🗑 " + watcher.Keywords,
+			CallbackData: MakeCallbackData(CallbackDeleteWatcher, watcher.Id),
+		}})
 	}
 
-	return NewMessage(chatId, responseText)
+	return InlineKeyboardMarkup{InlineKeyboard: keyboard}
 }
 
 func MakeResponseForAddCommand(chatId int) MethodSendMessageWithoutKeyboard {
-	return NewMessage(chatId, "What's the film name? \n\nYou can add multiple keywords separated by commas, like this:\n_Fight Club, Clubul batausilor, Fight_.")
+	return NewMessage(chatId, "What's the film name? \n\nYou can add multiple names separated by commas or OR, like this:\n_Fight Club, Clubul batausilor_.\n\n"+
+		"Each of them is looked up on its own, as a whole, in the films' names. To skip the films having a word in their names, add the word with a dash in front; "+
+		"the names having commas or dashes in them go in double quotes, like this:\n_Batman -lego, \"Tick, Tick... Boom!\"_.\n\n"+
+		"For matching the names against a regular expression instead, start with re: followed by a space, like this:\n_re: ^Star Wars_.")
+}
+
+// AnyOptionLabel is the keyboard button for not filtering a watcher by some attribute.
+const AnyOptionLabel = "Any"
+
+// FormatOptions are the formats a watcher can be filtered by.
+var FormatOptions = []string{"2D", "3D", "IMAX", "4DX", "ScreenX"}
+
+const (
+	AudioOriginalLabel = "Original language"
+	AudioDubbedLabel   = "Dubbed"
+	SubtitlesYesLabel  = "With subtitles"
+	SubtitlesNoLabel   = "Without subtitles"
+)
+
+// MakeResponseForFormatFilter asks for the format the new watcher is restricted to; `intro` precedes the question.
+func MakeResponseForFormatFilter(chatId int, intro string) MethodSendMessageWithKeyboard {
+	return makeFilterQuestion(chatId, intro, "Which format do you want to watch it in?", FormatOptions)
+}
+
+func MakeResponseForAudioFilter(chatId int, intro string) MethodSendMessageWithKeyboard {
+	return makeFilterQuestion(chatId, intro, "Original language or dubbed?", []string{AudioOriginalLabel, AudioDubbedLabel})
+}
+
+func MakeResponseForSubtitlesFilter(chatId int, intro string) MethodSendMessageWithKeyboard {
+	return makeFilterQuestion(chatId, intro, "Subtitles?", []string{SubtitlesYesLabel, SubtitlesNoLabel})
+}
+
+func MakeResponseForAgeRatingFilter(chatId int, intro string, ratings []string) MethodSendMessageWithKeyboard {
+	return makeFilterQuestion(chatId, intro, "Which age rating?", ratings)
+}
+
+func makeFilterQuestion(chatId int, intro string, question string, options []string) MethodSendMessageWithKeyboard {
+	text := question
+	if len(intro) > 0 {
+		text = intro + "\n\n" + question
+	}
+
+	buttonRows := [][]string{{AnyOptionLabel}}
+
+	var row []string
+
+	maxCharsPerRow := 30
+
+	for _, v := range options {
+		if charsInSliceOfStrings(row) >= maxCharsPerRow {
+			buttonRows = append(buttonRows, row)
+			row = []string{}
+		}
+
+		row = append(row, v)
+	}
+
+	buttonRows = append(buttonRows, row)
+
+	return NewMessageWithKeyboard(chatId, text, buttonRows)
+}
+
+func MakeResponseForWatcherFiltersSet(chatId int, watcher string, filters string) MethodSendMessageWithoutKeyboard {
+	msg := fmt.Sprintf("All set ✨ You will be notified about films matching %s", italic(watcher))
+	if len(filters) > 0 {
+		msg += fmt.Sprintf(" (%s)", EscapeMarkdown(filters))
+	}
+
+	return NewMessage(chatId, msg+". Use `/list` to list your watchers.")
 }
 
 func MakeResponseForRemoveCommand(watchers *[]string, chatId int) MethodSendMessageWithKeyboard {
@@ -247,22 +478,448 @@ func MakeResponseForWatcherRemoved(chatId int, msg string) MethodSendMessageWith
 	return NewMessage(chatId, responseMessage)
 }
 
+// NewScreeningsMark prefixes the keyboard buttons of the watchers that notify about new screenings.
+const NewScreeningsMark = "🔔 "
+
+// MakeResponseForUpdatesCommand lists the chat's watchers as keyboard buttons;
+// the ones that also notify about new screenings are marked with `NewScreeningsMark`.
+func MakeResponseForUpdatesCommand(watchers *[]string, enabled map[string]bool, chatId int) MethodSendMessageWithKeyboard {
+	if len(*watchers) == 0 {
+		return NewMessageWithKeyboard(chatId, "You have no watchers, add some using `/add`", [][]string{})
+	}
+
+	var buttonRows [][]string
+
+	for _, watcher := range *watchers {
+		if enabled[watcher] {
+			watcher = NewScreeningsMark + watcher
+		}
+
+		buttonRows = append(buttonRows, []string{watcher})
+	}
+
+	return NewMessageWithKeyboard(chatId, "Watchers marked with 🔔 also let you know when new showtimes are added for films that were already announced.\n\nClick a watcher below to switch this on or off.", buttonRows)
+}
+
+func MakeResponseForWatcherUpdatesToggled(chatId int, watcher string, enabled bool, msg string) MethodSendMessageWithoutKeyboard {
+	if len(msg) == 0 {
+		if enabled {
+			msg = fmt.Sprintf("You will be notified when new showtimes are added for films matching %s. 🔔", italic(watcher))
+		} else {
+			msg = fmt.Sprintf("You will no longer be notified about new showtimes for films matching %s.", italic(watcher))
+		}
+	}
+
+	return NewMessage(chatId, msg)
+}
+
+const (
+	StrictnessExactLabel  = "Exact name"
+	StrictnessPhraseLabel = "Anywhere in the name"
+	StrictnessFuzzyLabel  = "Allow typos"
+)
+
+// MakeResponseForMatchingCommand lists the chat's watchers as keyboard buttons, for picking the one whose matching is changed.
+func MakeResponseForMatchingCommand(watchers *[]string, chatId int) MethodSendMessageWithKeyboard {
+	if len(*watchers) == 0 {
+		return NewMessageWithKeyboard(chatId, "You have no watchers, add some using `/add`", [][]string{})
+	}
+
+	var buttonRows [][]string
+
+	for _, watcher := range *watchers {
+		buttonRows = append(buttonRows, []string{watcher})
+	}
+
+	return NewMessageWithKeyboard(chatId, "Which watcher do you want to change the matching of? Click one of the buttons below.", buttonRows)
+}
+
+// MakeResponseForStrictnessQuestion asks how closely the films' names have to match the watcher; `current` is the label of its current setting.
+func MakeResponseForStrictnessQuestion(chatId int, watcher string, current string, intro string) MethodSendMessageWithKeyboard {
+	text := fmt.Sprintf("How closely should the films' names match %s? It's currently set to _%s_.\n\n"+
+		"*%s*: a film's name is one of your names.\n"+
+		"*%s*: a film's name has one of your names in it, as a whole.\n"+
+		"*%s*: like the above, even if some letters are wrong or missing.",
+		italic(watcher), current, StrictnessExactLabel, StrictnessPhraseLabel, StrictnessFuzzyLabel)
+	if len(intro) > 0 {
+		text = intro + "\n\n" + text
+	}
+
+	return NewMessageWithKeyboard(chatId, text, [][]string{{StrictnessExactLabel}, {StrictnessPhraseLabel}, {StrictnessFuzzyLabel}})
+}
+
+func MakeResponseForStrictnessSet(chatId int, watcher string, label string, msg string) MethodSendMessageWithoutKeyboard {
+	if len(msg) == 0 {
+		msg = fmt.Sprintf("%s is now matched by: _%s_. ✨", italic(watcher), label)
+	}
+
+	return NewMessage(chatId, msg)
+}
+
+const (
+	// AnnouncementAlertsLabel starts the keyboard button toggling the alerts about announced films.
+	AnnouncementAlertsLabel = "📣 Announcements"
+	// OnSaleAlertsLabel starts the keyboard button toggling the alerts about films available for booking.
+	OnSaleAlertsLabel = "🎟 Booking opens"
+)
+
+// MakeResponseForAlertsCommand shows the chat's alert preferences as keyboard buttons.
+func MakeResponseForAlertsCommand(chatId int, announcements bool, onSale bool) MethodSendMessageWithKeyboard {
+	buttonRows := [][]string{
+		{fmt.Sprintf("%s: %s", AnnouncementAlertsLabel, onOff(announcements))},
+		{fmt.Sprintf("%s: %s", OnSaleAlertsLabel, onOff(onSale))},
+	}
+
+	text := "Your watchers can notify you once a matching film is announced as coming soon, and again when its booking opens.\n\nClick an option below to switch it on or off."
+
+	return NewMessageWithKeyboard(chatId, text, buttonRows)
+}
+
+func MakeResponseForAlertToggled(chatId int, label string, enabled bool, msg string) MethodSendMessageWithoutKeyboard {
+	if len(msg) == 0 {
+		msg = fmt.Sprintf("%s alerts are now %s. Use `/alerts` to change them.", label, onOff(enabled))
+	}
+
+	return NewMessage(chatId, msg)
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+
+	return "off"
+}
+
+// AllCountriesLabel is the keyboard button for following the cinemas in all the countries.
+const AllCountriesLabel = "🌍 All countries"
+
+var countryLabels = map[string]string{
+	"bg": "🇧🇬 Bulgaria",
+	"cz": "🇨🇿 Czechia",
+	"hu": "🇭🇺 Hungary",
+	"pl": "🇵🇱 Poland",
+	"ro": "🇷🇴 Romania",
+	"sk": "🇸🇰 Slovakia",
+}
+
+// CountryLabel returns the keyboard button label of the country having the given code.
+func CountryLabel(code string) string {
+	if len(code) == 0 {
+		return AllCountriesLabel
+	}
+
+	if label, ok := countryLabels[code]; ok {
+		return label
+	}
+
+	return strings.ToUpper(code)
+}
+
+// MakeResponseForCountryCommand lists the given countries as keyboard buttons.
+func MakeResponseForCountryCommand(chatId int, countries []string, current string) MethodSendMessageWithKeyboard {
+	buttonRows := [][]string{{AllCountriesLabel}}
+
+	for _, code := range countries {
+		buttonRows = append(buttonRows, []string{CountryLabel(code)})
+	}
+
+	text := fmt.Sprintf("You are getting notifications for: _%s_.\n\nWhich country do you want notifications for?", CountryLabel(current))
+
+	return NewMessageWithKeyboard(chatId, text, buttonRows)
+}
+
+func MakeResponseForCountrySet(chatId int, country string, msg string) MethodSendMessageWithoutKeyboard {
+	if len(msg) == 0 {
+		msg = fmt.Sprintf("You will get notifications for: _%s_. Use `/cinemas` to pick your cinemas.", CountryLabel(country))
+	}
+
+	return NewMessage(chatId, msg)
+}
+
+// SelectedCinemaMark prefixes the keyboard buttons of the cinemas a chat has picked.
+const SelectedCinemaMark = "✅ "
+
+// MakeResponseForCinemasCommand lists the available cinemas as keyboard buttons;
+// the ones picked by the chat are marked with `SelectedCinemaMark`.
+func MakeResponseForCinemasCommand(chatId int, cinemas []string, selected map[string]bool) MethodSendMessageWithKeyboard {
+	var buttonRows [][]string
+
+	for _, cinema := range cinemas {
+		if selected[cinema] {
+			cinema = SelectedCinemaMark + cinema
+		}
+
+		buttonRows = append(buttonRows, []string{cinema})
+	}
+
+	text := "You are following all the cinemas."
+	if len(selected) > 0 {
+		text = "You are following the cinemas marked with ✅."
+	}
+
+	text += "\n\nClick a cinema below to add it to or remove it from your selection. When no cinema is selected, you get notifications for all of them."
+
+	return NewMessageWithKeyboard(chatId, text, buttonRows)
+}
+
+func MakeResponseForCinemaToggled(chatId int, cinema string, selected bool, msg string) MethodSendMessageWithoutKeyboard {
+	if len(msg) == 0 {
+		if selected {
+			msg = fmt.Sprintf("You will get notifications for films playing at _%s_. Use `/cinemas` to change your selection.", cinema)
+		} else {
+			msg = fmt.Sprintf("_%s_ was removed from your selection. Use `/cinemas` to change it further.", cinema)
+		}
+	}
+
+	return NewMessage(chatId, msg)
+}
+
+// HistoryEntry is a notification listed by the `/history` command.
+type HistoryEntry struct {
+	FilmName   string
+	FilmLink   string
+	CinemaName string
+	// Reason tells why the notification was sent, e.g. "on sale".
+	Reason string
+	Date   string
+}
+
+func MakeResponseForHistoryCommand(chatId int, entries []HistoryEntry) MethodSendMessageWithoutKeyboard {
+	if len(entries) == 0 {
+		return NewMessage(chatId, "You haven't been notified about any film yet.")
+	}
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		buf.WriteString(fmt.Sprintf("%s · %s at %s (%s)\n", e.Date, link(e.FilmName, e.FilmLink), italic(e.CinemaName), e.Reason))
+	}
+
+	return NewMessage(chatId, fmt.Sprintf("These are the films you were recently notified about:\n\n%s", buf.String()))
+}
+
+// MakeResponseForFailedUpdate lets the user know that their message couldn't be handled, after trying a few times.
+func MakeResponseForFailedUpdate(chatId int) MethodSendMessageWithoutKeyboard {
+	return NewMessage(chatId, "Sorry, something went wrong and I couldn't handle your message. 😕 Please try again later.")
+}
+
 func MakeResponseForUnknownCommand(chatId int) MethodSendMessageWithoutKeyboard {
 	return NewMessage(chatId, "Sorry, I didn't understand that. Type `/` to list the available commands.")
 }
 
-func NewNotification(chatId int, filmName string, filmLink string, filmPosterLink string) MethodSendPhoto {
-	messageText := fmt.Sprintf("🎉 Tickets for a film matching one of your watchers are now on sale:\n\n[%s](%s)", filmName, filmLink)
+// WatcherMatch is the reason for notifying a chat about a film: the term of its watcher found in the film's names.
+type WatcherMatch struct {
+	Keywords string
+	Term     string
+	// Approximate tells that the term was found despite some typos.
+	Approximate bool
+}
+
+// markdownEscaper escapes the characters the legacy Markdown parse mode would take for the start of an entity.
+var markdownEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+// EscapeMarkdown makes the text entered by the user, e.g. a watcher's keywords, safe to send outside any entity
+// in a Markdown message; Telegram refuses the message otherwise.
+func EscapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// italic formats the text entered by the user in italics; since an entity can't have its own delimiter escaped in it,
+// the underscores are put between the italic parts instead.
+func italic(text string) string {
+	parts := strings.Split(text, "_")
+	for i, part := range parts {
+		if len(part) > 0 {
+			parts[i] = "_" + part + "_"
+		}
+	}
+
+	return strings.Join(parts, "\\_")
+}
+
+// link formats the text of a link coming from a provider, e.g. a film's name; the text of a link ends at the first
+// closing bracket, so the closing brackets are put between the linked parts instead, like in italic.
+func link(text string, url string) string {
+	parts := strings.Split(text, "]")
+	for i, part := range parts {
+		if len(part) > 0 {
+			parts[i] = fmt.Sprintf("[%s](%s)", part, url)
+		}
+	}
+
+	return strings.Join(parts, "]")
+}
+
+// formatWatcherMatch returns the line telling the chat which of its watchers matched the film.
+func formatWatcherMatch(m WatcherMatch) string {
+	if len(m.Term) == 0 {
+		return ""
+	}
+
+	text := fmt.Sprintf("\n\n🔎 Matched %s from your watcher %s", italic(m.Term), italic(m.Keywords))
+	if m.Term == m.Keywords {
+		text = fmt.Sprintf("\n\n🔎 Matched your watcher %s", italic(m.Term))
+	}
+
+	if m.Approximate {
+		text += ", allowing for typos"
+	}
+
+	return text
+}
+
+// NewAnnouncementNotification lets the user know that a film was announced; `upcomingFilmRowId` identifies the upcoming film
+// in the callbacks of the buttons attached to the notification.
+func NewAnnouncementNotification(chatId int, upcomingFilmRowId int64, filmName string, filmLink string, filmPosterLink string, cinemaName string, releaseDate string, match WatcherMatch) MethodSendPhoto {
+	messageText := fmt.Sprintf("📣 A film matching one of your watchers was announced at %s:\n\n%s", italic(cinemaName), link(filmName, filmLink))
+
+	if len(releaseDate) > 0 {
+		messageText += fmt.Sprintf("\n\nRelease date: %s", EscapeMarkdown(releaseDate))
+	}
+
+	messageText += formatWatcherMatch(match)
+
+	keyboard := NewAnnouncementKeyboard(upcomingFilmRowId, filmLink)
 
 	return MethodSendPhoto{
-		Method:    "sendPhoto",
-		ChatId:    chatId,
-		Photo:     filmPosterLink,
-		Caption:   messageText,
-		ParseMode: "markdown",
+		Method:      "sendPhoto",
+		ChatId:      chatId,
+		Photo:       filmPosterLink,
+		Caption:     messageText,
+		ParseMode:   "markdown",
+		ReplyMarkup: &keyboard,
+	}
+}
+
+// Screening is a film's showtime, as listed in notifications.
+type Screening struct {
+	Time        string
+	BookingLink string
+	Auditorium  string
+}
+
+// FilmDetails are the film properties listed in notifications; languages are given as ISO 639-1 codes.
+type FilmDetails struct {
+	Length            int
+	ReleaseYear       string
+	Genres            []string
+	AgeRating         string
+	Formats           []string
+	OriginalLanguage  string
+	DubbedLanguages   []string
+	SubtitleLanguages []string
+}
+
+// NewNotification lets the user know that a film went on sale; `filmRowId` identifies the film in the callbacks
+// of the buttons attached to the notification.
+func NewNotification(chatId int, filmRowId int64, filmName string, filmLink string, filmPosterLink string, cinemaName string, details FilmDetails, screenings []Screening, match WatcherMatch) MethodSendPhoto {
+	messageText := fmt.Sprintf("🎉 Tickets for a film matching one of your watchers are now on sale at %s:\n\n%s", italic(cinemaName), link(filmName, filmLink))
+
+	if d := formatFilmDetails(details); len(d) > 0 {
+		messageText += "\n" + d
+	}
+
+	if len(screenings) > 0 {
+		messageText += "\n\nNext screenings:\n" + formatScreenings(screenings)
+	}
+
+	messageText += formatWatcherMatch(match)
+
+	keyboard := NewNotificationKeyboard(filmRowId, bookingLink(filmLink, screenings))
+
+	return MethodSendPhoto{
+		Method:      "sendPhoto",
+		ChatId:      chatId,
+		Photo:       filmPosterLink,
+		Caption:     messageText,
+		ParseMode:   "markdown",
+		ReplyMarkup: &keyboard,
 	}
 }
 
+// NewScreeningsNotification lets the user know about screenings added for an already announced film;
+// `more` is the number of new screenings that didn't fit in the message.
+func NewScreeningsNotification(chatId int, filmRowId int64, filmName string, filmLink string, cinemaName string, screenings []Screening, more int, match WatcherMatch) MethodSendMessageWithInlineKeyboard {
+	messageText := fmt.Sprintf("🆕 New showtimes added at %s for %s:\n\n%s", italic(cinemaName), link(filmName, filmLink), formatScreenings(screenings))
+
+	if more > 0 {
+		messageText += fmt.Sprintf("\n…and %d more.", more)
+	}
+
+	messageText += formatWatcherMatch(match)
+
+	return MethodSendMessageWithInlineKeyboard{
+		Method:      "sendMessage",
+		ChatId:      chatId,
+		Text:        messageText,
+		ParseMode:   "markdown",
+		ReplyMarkup: NewNotificationKeyboard(filmRowId, bookingLink(filmLink, screenings)),
+	}
+}
+
+func formatFilmDetails(d FilmDetails) string {
+	var lines []string
+
+	var facts []string
+	if d.Length > 0 {
+		facts = append(facts, fmt.Sprintf("⏱ %dh %02dm", d.Length/60, d.Length%60))
+	}
+	if len(d.ReleaseYear) > 0 {
+		facts = append(facts, fmt.Sprintf("📅 %s", d.ReleaseYear))
+	}
+	if len(d.AgeRating) > 0 {
+		facts = append(facts, fmt.Sprintf("🔞 %s", d.AgeRating))
+	}
+	if len(facts) > 0 {
+		lines = append(lines, strings.Join(facts, " · "))
+	}
+
+	if len(d.Genres) > 0 {
+		lines = append(lines, "🎭 "+strings.Join(d.Genres, ", "))
+	}
+
+	if len(d.Formats) > 0 {
+		lines = append(lines, "🎞 "+strings.Join(d.Formats, ", "))
+	}
+
+	var languages []string
+	if len(d.OriginalLanguage) > 0 {
+		languages = append(languages, strings.ToUpper(d.OriginalLanguage))
+	}
+	if len(d.DubbedLanguages) > 0 {
+		languages = append(languages, "dubbed: "+strings.ToUpper(strings.Join(d.DubbedLanguages, ", ")))
+	}
+	if len(d.SubtitleLanguages) > 0 {
+		languages = append(languages, "subtitles: "+strings.ToUpper(strings.Join(d.SubtitleLanguages, ", ")))
+	}
+	if len(languages) > 0 {
+		lines = append(lines, "🗣 "+strings.Join(languages, " · "))
+	}
+
+	// the details come as they are from the provider
+	return EscapeMarkdown(strings.Join(lines, "\n"))
+}
+
+func formatScreenings(screenings []Screening) string {
+	var buf bytes.Buffer
+
+	for _, s := range screenings {
+		if len(s.BookingLink) > 0 {
+			buf.WriteString(fmt.Sprintf("🎟 [%s](%s)", s.Time, s.BookingLink))
+		} else {
+			buf.WriteString(fmt.Sprintf("🎟 %s", s.Time))
+		}
+
+		if len(s.Auditorium) > 0 {
+			buf.WriteString(fmt.Sprintf(" · %s", EscapeMarkdown(s.Auditorium)))
+		}
+
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
 func charsInSliceOfStrings(s []string) int {
 	var l int
 	for _, v := range s {
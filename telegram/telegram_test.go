@@ -0,0 +1,65 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatWatcherMatch(t *testing.T) {
+	tables := []struct {
+		match    WatcherMatch
+		expected string
+	}{
+		{WatcherMatch{Keywords: "Dune OR Arrival", Term: "Dune"}, "\n\n🔎 Matched _Dune_ from your watcher _Dune OR Arrival_"},
+		{WatcherMatch{Keywords: "dune_2", Term: "dune_2"}, "\n\n🔎 Matched your watcher _dune_\\__2_"},
+		{WatcherMatch{Keywords: "re: ^star_wars_", Term: "re: ^star_wars_"}, "\n\n🔎 Matched your watcher _re: ^star_\\__wars_\\_"},
+		{WatcherMatch{Keywords: "*Dune* OR [Rec]", Term: "[Rec]", Approximate: true}, "\n\n🔎 Matched _[Rec]_ from your watcher _*Dune* OR [Rec]_, allowing for typos"},
+		{WatcherMatch{}, ""},
+	}
+
+	for _, table := range tables {
+		text := formatWatcherMatch(table.match)
+
+		if text != table.expected {
+			t.Errorf("Expected %q for %+v, got %q", table.expected, table.match, text)
+		}
+	}
+}
+
+func TestMakeWatcherListTextEscapesKeywords(t *testing.T) {
+	text := makeWatcherListText([]ListedWatcher{{Keywords: "_Dune_", Filters: "Format: 4D_X"}})
+
+	if expected := "✔︎ \\__Dune_\\_ (Format: 4D\\_X)\n"; !strings.Contains(text, expected) {
+		t.Errorf("Expected the list to have %q, got %q", expected, text)
+	}
+}
+
+func TestNotificationsEscapeProviderNames(t *testing.T) {
+	screenings := []Screening{{Time: "20:30", BookingLink: "https://example.com/b/1", Auditorium: "Sala_4"}}
+	details := FilmDetails{AgeRating: "AG_12", Genres: []string{"*Action*"}}
+
+	notification := NewNotification(1, 7, "Mission: Impossible_*", "https://example.com/f/1", "", "Cinema_City", details, screenings, WatcherMatch{})
+	announcement := NewAnnouncementNotification(1, 7, "[Rec]", "https://example.com/f/2", "", "Cinema_City", "", WatcherMatch{})
+	newScreenings := NewScreeningsNotification(1, 7, "Mission: Impossible_*", "https://example.com/f/1", "Cinema_City", screenings, 0, WatcherMatch{})
+	moreShowtimes := MakeResponseForMoreShowtimes(1, 2, false, InlineKeyboardMarkup{}, "Mission: Impossible_*", "https://example.com/f/1", "Cinema_City", screenings).(MethodEditMessageText)
+	history := MakeResponseForHistoryCommand(1, []HistoryEntry{{FilmName: "Mission: Impossible_*", FilmLink: "https://example.com/f/1", CinemaName: "Cinema_City", Date: "16 Oct"}})
+
+	tables := []struct {
+		text     string
+		expected []string
+	}{
+		{notification.Caption, []string{"on sale at _Cinema_\\__City_:", "[Mission: Impossible_*](https://example.com/f/1)", "AG\\_12", "\\*Action\\*", "· Sala\\_4"}},
+		{announcement.Caption, []string{"announced at _Cinema_\\__City_:", "[[Rec](https://example.com/f/2)]"}},
+		{newScreenings.Text, []string{"added at _Cinema_\\__City_ for [Mission: Impossible_*](https://example.com/f/1):", "· Sala\\_4"}},
+		{moreShowtimes.Text, []string{"🎬 [Mission: Impossible_*](https://example.com/f/1) at _Cinema_\\__City_"}},
+		{history.Text, []string{"16 Oct · [Mission: Impossible_*](https://example.com/f/1) at _Cinema_\\__City_"}},
+	}
+
+	for _, table := range tables {
+		for _, expected := range table.expected {
+			if !strings.Contains(table.text, expected) {
+				t.Errorf("Expected %q to have %q", table.text, expected)
+			}
+		}
+	}
+}